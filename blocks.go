@@ -0,0 +1,194 @@
+package stone
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/ellcrys/util"
+)
+
+// MetaBlock is the typed form of the `meta` block
+type MetaBlock struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+	NotBefore int64  `json:"not_before,omitempty"`
+}
+
+// SoleOwner is the owner of a `sole` ownership
+type SoleOwner struct {
+	AddressID string `json:"address_id"`
+}
+
+// OwnerGroup lists the owners of a `joint` or `threshold` ownership.
+// Required is only used by `threshold` ownerships.
+type OwnerGroup struct {
+	AddressIDs []string `json:"address_ids"`
+	Required   int      `json:"required,omitempty"`
+}
+
+// TransferRecord links a transferred ownership to the previous owner
+type TransferRecord struct {
+	From     string `json:"from"`
+	PrevHash string `json:"prev_hash"`
+}
+
+// OwnershipBlock is the typed form of the `ownership` block.
+// Only the owner field matching Type is set.
+type OwnershipBlock struct {
+	RefID     string          `json:"ref_id"`
+	Type      string          `json:"type"`
+	Sole      *SoleOwner      `json:"sole,omitempty"`
+	Joint     *OwnerGroup     `json:"joint,omitempty"`
+	Threshold *OwnerGroup     `json:"threshold,omitempty"`
+	Status    string          `json:"status,omitempty"`
+	Transfer  *TransferRecord `json:"transfer,omitempty"`
+}
+
+// AttributesBlock is the typed form of the `attributes` block.
+// Data holds any JSON value; numbers are json.Number.
+type AttributesBlock struct {
+	RefID string      `json:"ref_id"`
+	Data  interface{} `json:"data"`
+}
+
+// EmbedsBlock is the typed form of the `embeds` block.
+// Each element of Data is the map form of an embedded stone.
+type EmbedsBlock struct {
+	RefID string                   `json:"ref_id"`
+	Data  []map[string]interface{} `json:"data"`
+}
+
+// Decodes the map form of a block into a typed block. Unknown
+// properties and mismatched value types are reported as errors.
+func blockFromMap(block map[string]interface{}, blockName string, dst interface{}) error {
+
+	blockJSON, err := util.MapToJSON(block)
+	if err != nil {
+		return errors.New("malformed " + blockName + " block")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(blockJSON)))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		return errors.New("malformed " + blockName + " block: " + err.Error())
+	}
+
+	return nil
+}
+
+// Converts a typed block to its map form, the form signed by Sign.
+// Numbers are represented as json.Number, as in a decoded stone.
+func blockToMap(block interface{}) map[string]interface{} {
+	blockJSON, _ := json.Marshal(block)
+	m, _ := util.JSONToMap(string(blockJSON))
+	return m
+}
+
+// Create a MetaBlock from the map form of a `meta` block
+func MetaBlockFromMap(meta map[string]interface{}) (*MetaBlock, error) {
+	var block MetaBlock
+	if err := blockFromMap(meta, "meta", &block); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// Returns the map form of the block
+func (self *MetaBlock) ToMap() map[string]interface{} {
+	return blockToMap(self)
+}
+
+// Create an OwnershipBlock from the map form of an `ownership` block
+func OwnershipBlockFromMap(ownership map[string]interface{}) (*OwnershipBlock, error) {
+	var block OwnershipBlock
+	if err := blockFromMap(ownership, "ownership", &block); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// Returns the map form of the block
+func (self *OwnershipBlock) ToMap() map[string]interface{} {
+	return blockToMap(self)
+}
+
+// Returns the address ids of the owners
+func (self *OwnershipBlock) Owners() []string {
+	return OwnerAddressIDs(self.ToMap())
+}
+
+// Create an AttributesBlock from the map form of an `attributes` block
+func AttributesBlockFromMap(attributes map[string]interface{}) (*AttributesBlock, error) {
+	var block AttributesBlock
+	if err := blockFromMap(attributes, "attributes", &block); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// Returns the map form of the block
+func (self *AttributesBlock) ToMap() map[string]interface{} {
+	return blockToMap(self)
+}
+
+// Create an EmbedsBlock from the map form of an `embeds` block
+func EmbedsBlockFromMap(embeds map[string]interface{}) (*EmbedsBlock, error) {
+	var block EmbedsBlock
+	if err := blockFromMap(embeds, "embeds", &block); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// Returns the map form of the block
+func (self *EmbedsBlock) ToMap() map[string]interface{} {
+	return blockToMap(self)
+}
+
+// Returns the embedded stones. Validation is not performed.
+func (self *EmbedsBlock) Stones() ([]*Stone, error) {
+	var stones []*Stone
+	for _, data := range self.Data {
+		stone, err := loadMap(data)
+		if err != nil {
+			return nil, err
+		}
+		stones = append(stones, stone)
+	}
+	return stones, nil
+}
+
+// Returns the typed `meta` block
+func (self *Stone) MetaBlock() (*MetaBlock, error) {
+	if len(self.Meta) == 0 {
+		return nil, errors.New("`meta` block is empty")
+	}
+	return MetaBlockFromMap(self.Meta)
+}
+
+// Returns the typed `ownership` block
+func (self *Stone) OwnershipBlock() (*OwnershipBlock, error) {
+	if !self.HasOwnership() {
+		return nil, errors.New("`ownership` block is empty")
+	}
+	return OwnershipBlockFromMap(self.Ownership)
+}
+
+// Returns the typed `attributes` block
+func (self *Stone) AttributesBlock() (*AttributesBlock, error) {
+	if !self.HasAttributes() {
+		return nil, errors.New("`attributes` block is empty")
+	}
+	return AttributesBlockFromMap(self.Attributes)
+}
+
+// Returns the typed `embeds` block
+func (self *Stone) EmbedsBlock() (*EmbedsBlock, error) {
+	if !self.HasEmbeds() {
+		return nil, errors.New("`embeds` block is empty")
+	}
+	return EmbedsBlockFromMap(self.Embeds)
+}
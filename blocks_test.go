@@ -0,0 +1,106 @@
+package stone
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"github.com/ellcrys/util"
+)
+
+// TestMetaBlockRoundTrip tests that a meta block converts to a typed block and back without loss
+func TestMetaBlockRoundTrip(t *testing.T) {
+	sh := NewValidStone()
+	meta, err := sh.MetaBlock()
+	assert.Nil(t, err)
+	assert.Equal(t, sh.Meta["id"], meta.ID)
+	assert.Equal(t, "some_stone", meta.Type)
+	assert.Equal(t, sh.Meta["created_at"], meta.CreatedAt)
+
+	expected, _ := util.MapToJSON(sh.Meta)
+	actual, _ := util.MapToJSON(meta.ToMap())
+	assert.Equal(t, expected, actual)
+	assert.Nil(t, ValidateMetaBlock(meta.ToMap()))
+}
+
+// TestMetaBlockWithInvalidValueType tests that a mistyped value is reported instead of panicking
+func TestMetaBlockWithInvalidValueType(t *testing.T) {
+	_, err := MetaBlockFromMap(map[string]interface{}{
+		"id": 1234,
+		"type": "coupon",
+		"created_at": time.Now().Unix(),
+	})
+	assert.NotNil(t, err)
+	_, err = MetaBlockFromMap(map[string]interface{}{
+		"id": util.NewID(),
+		"unknown": "abc",
+	})
+	assert.NotNil(t, err)
+}
+
+// TestOwnershipBlockRoundTrip tests that a signed ownership block converts to a typed block and back
+// and that the converted block produces the same signature
+func TestOwnershipBlockRoundTrip(t *testing.T) {
+	sh := NewOwnedStone()
+	err := sh.Transfer("bob", util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	assert.Nil(t, err)
+
+	ownership, err := sh.OwnershipBlock()
+	assert.Nil(t, err)
+	assert.Equal(t, "sole", ownership.Type)
+	assert.Equal(t, "bob", ownership.Sole.AddressID)
+	assert.Equal(t, "alice", ownership.Transfer.From)
+	assert.Equal(t, []string{ "bob" }, ownership.Owners())
+
+	clone, _ := Load(sh.JSON())
+	clone.Ownership = ownership.ToMap()
+	_, err = clone.Sign("ownership", util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.Nil(t, err)
+	_, err = sh.Sign("ownership", util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, sh.Signatures["ownership"], clone.Signatures["ownership"])
+}
+
+// TestThresholdOwnershipBlock tests that a threshold ownership block is typed correctly
+func TestThresholdOwnershipBlock(t *testing.T) {
+	sh := NewGroupStone("threshold", map[string]interface{}{ "required": 2 })
+	ownership, err := sh.OwnershipBlock()
+	assert.Nil(t, err)
+	assert.Nil(t, ownership.Sole)
+	assert.Equal(t, 2, ownership.Threshold.Required)
+	assert.Equal(t, []string{ "alice", "bob", "carol" }, ownership.Threshold.AddressIDs)
+	assert.Nil(t, ValidateOwnershipBlock(ownership.ToMap(), sh.Meta["id"].(string)))
+}
+
+// TestAttributesBlockKeepsNumbers tests that attribute numbers are kept as json.Number
+func TestAttributesBlockKeepsNumbers(t *testing.T) {
+	sh := NewValidStone()
+	err := sh.AddAttributes(map[string]interface{}{
+		"ref_id": sh.Meta["id"],
+		"data": map[string]interface{}{ "amount": 10.50 },
+	}, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.Nil(t, err)
+	attrs, err := sh.AttributesBlock()
+	assert.Nil(t, err)
+	assert.Equal(t, json.Number("10.5"), attrs.Data.(map[string]interface{})["amount"])
+}
+
+// TestEmbedsBlockStones tests that embedded stones can be read from a typed embeds block
+func TestEmbedsBlockStones(t *testing.T) {
+	sh, err := Load(util.ReadFromFixtures("tests/fixtures/stone_5.json"))
+	assert.Nil(t, err)
+	embeds, err := sh.EmbedsBlock()
+	assert.Nil(t, err)
+	stones, err := embeds.Stones()
+	assert.Nil(t, err)
+	assert.Len(t, stones, 1)
+	assert.Equal(t, "4417781906fb0a89c295959b0df01782dbc4dc9b", stones[0].Meta["id"])
+}
+
+// TestEmptyBlockHasNoTypedBlock tests that an empty block is reported as an error
+func TestEmptyBlockHasNoTypedBlock(t *testing.T) {
+	sh := NewValidStone()
+	_, err := sh.OwnershipBlock()
+	assert.NotNil(t, err)
+	assert.Equal(t, "`ownership` block is empty", err.Error())
+}
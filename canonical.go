@@ -0,0 +1,199 @@
+package stone
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Returns the RFC 8785 (JCS) canonical JSON serialization of a value.
+// Blocks are signed in this form so that a block decoded from its
+// signature and signed again produces the same payload, and so that
+// other implementations can reproduce it.
+//
+// Object keys are sorted by their UTF-16 code units, no whitespace is
+// emitted, strings are minimally escaped and numbers (including
+// json.Number) are written the way ECMAScript writes doubles. Integers
+// a double cannot hold exactly (above 2^53, see I-JSON, RFC 7493) are an
+// error rather than signed as a different value.
+func CanonicalJSON(v interface{}) ([]byte, error) {
+
+	// reduce any Go value to the generic JSON types
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, generic); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Write the canonical form of a generic JSON value
+func writeCanonical(buf *bytes.Buffer, v interface{}) error {
+	switch val := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(val))
+	case string:
+		writeCanonicalString(buf, val)
+	case json.Number:
+		f, err := strconv.ParseFloat(val.String(), 64)
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid number %s", val.String()))
+		}
+		num, err := canonicalNumber(f)
+		if err != nil {
+			return err
+		}
+		if isIntegerLiteral(val.String()) && !sameNumber(val.String(), num) {
+			return errors.New(fmt.Sprintf("number %s cannot be represented exactly", val.String()))
+		}
+		buf.WriteString(num)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range val {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for key, _ := range val {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return lessUTF16(keys[i], keys[j])
+		})
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, key)
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, val[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return errors.New(fmt.Sprintf("unsupported value type %T", v))
+	}
+	return nil
+}
+
+// Compares two strings by their UTF-16 code units
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+// Write a string, escaping only what JSON requires
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// Format a number the way ECMAScript's Number.prototype.toString does
+func canonicalNumber(f float64) (string, error) {
+
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", errors.New("NaN and Infinity are not valid JSON numbers")
+	}
+
+	if f == 0 {
+		return "0", nil
+	}
+
+	var sign string
+	if f < 0 {
+		sign, f = "-", -f
+	}
+
+	var format byte = 'e'
+	if f >= 1e-6 && f < 1e21 {
+		format = 'f'
+	}
+
+	// Go writes exponents with at least two digits (1e+07), ECMAScript does not
+	num := strconv.FormatFloat(f, format, -1, 64)
+	if i := strings.IndexByte(num, 'e'); i > 0 && num[i+2] == '0' {
+		num = num[:i+2] + num[i+3:]
+	}
+
+	return sign + num, nil
+}
+
+// Checks whether a JSON number is written as an integer
+func isIntegerLiteral(num string) bool {
+	return !strings.ContainsAny(num, ".eE")
+}
+
+// Checks whether two JSON numbers have the same value
+func sameNumber(a, b string) bool {
+	x, okX := new(big.Rat).SetString(a)
+	y, okY := new(big.Rat).SetString(b)
+	return okX && okY && x.Cmp(y) == 0
+}
+
+// Returns the canonical JSON of a block as a string. Blocks
+// that cannot be serialized produce an error.
+func canonicalBlock(block map[string]interface{}) (string, error) {
+	data, err := CanonicalJSON(block)
+	if err != nil {
+		return "", errors.New("block cannot be serialized: " + err.Error())
+	}
+	return string(data), nil
+}
@@ -0,0 +1,113 @@
+package stone
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/ellcrys/util"
+)
+
+// TestCanonicalJSONExample tests the example of RFC 8785 section 3.2.2
+func TestCanonicalJSONExample(t *testing.T) {
+	input := `{
+		"numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+		"string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+		"literals": [null, true, false]
+	}`
+	data, _ := util.JSONToMap(input)
+	canonical, err := CanonicalJSON(data)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`, string(canonical))
+}
+
+// TestCanonicalJSONSortsByUTF16 tests the property sorting example of RFC 8785 section 3.2.3
+func TestCanonicalJSONSortsByUTF16(t *testing.T) {
+	data, _ := util.JSONToMap(`{ "\u20ac": 0, "\r": 1, "\ufb33": 2, "1": 3, "\ud83d\ude00": 4, "\u0080": 5, "\u00f6": 6 }`)
+	canonical, err := CanonicalJSON(data)
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"\\r\":1,\"1\":3,\"\u0080\":5,\"\u00f6\":6,\"\u20ac\":0,\"\U0001F600\":4,\"\ufb33\":2}", string(canonical))
+}
+
+// TestCanonicalNumbers tests the ECMAScript formatting of numbers
+func TestCanonicalNumbers(t *testing.T) {
+	for input, expected := range map[string]string{
+		"0": "0",
+		"-0": "0",
+		"1453975575": "1453975575",
+		"1.46e9": "1460000000",
+		"10.50": "10.5",
+		"-1.5": "-1.5",
+		"0.000001": "0.000001",
+		"1e-7": "1e-7",
+		"1e21": "1e+21",
+		"9007199254740992": "9007199254740992",
+	} {
+		canonical, err := CanonicalJSON(json.Number(input))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, string(canonical), input)
+	}
+}
+
+// TestCanonicalInexactNumbers tests that integers a double cannot hold exactly are rejected
+func TestCanonicalInexactNumbers(t *testing.T) {
+	for _, input := range []string{ "9007199254740993", "-9007199254740993", "18446744073709551616" } {
+		_, err := CanonicalJSON(json.Number(input))
+		assert.NotNil(t, err, input)
+		assert.Equal(t, "number " + input + " cannot be represented exactly", err.Error())
+	}
+
+	sh := NewValidStone()
+	sh.Attributes = map[string]interface{}{ "ref_id": sh.Meta["id"], "data": map[string]interface{}{ "n": json.Number("9007199254740993") } }
+	_, err := sh.Sign("attributes", util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.NotNil(t, err)
+}
+
+// TestCanonicalJSONDoesNotEscapeHTML tests that only characters JSON requires are escaped
+func TestCanonicalJSONDoesNotEscapeHTML(t *testing.T) {
+	canonical, err := CanonicalJSON(map[string]interface{}{ "a": "<b>&" })
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":"<b>&"}`, string(canonical))
+}
+
+// TestSignFloatCreatedAt tests that a whole number stored as a float is signed as an integer
+func TestSignFloatCreatedAt(t *testing.T) {
+	sh, err := Create(map[string]interface{}{
+		"id": util.NewID(),
+		"type": "coupon",
+		"created_at": float64(1460000000),
+	}, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.Nil(t, err)
+	payload, _ := util.GetJWSPayload(sh.Signatures["meta"].(string))
+	blockJSON, _ := b64Decode(payload)
+	assert.True(t, strings.Contains(string(blockJSON), `"created_at":1460000000`))
+}
+
+// TestResignDecodedStone tests that signing a decoded block again produces the same signature
+func TestResignDecodedStone(t *testing.T) {
+	issuerKey := util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt")
+	sh := NewValidStone()
+	err := sh.AddAttributes(map[string]interface{}{
+		"ref_id": sh.Meta["id"],
+		"data": map[string]interface{}{ "amount": 10.50, "tags": []string{ "<new>", "€" } },
+	}, issuerKey)
+	assert.Nil(t, err)
+
+	decoded, err := Decode(sh.Encode())
+	assert.Nil(t, err)
+	assert.Equal(t, json.Number("10.5"), decoded.Attributes["data"].(map[string]interface{})["amount"])
+
+	signature := decoded.Signatures["attributes"]
+	_, err = decoded.Sign("attributes", issuerKey)
+	assert.Nil(t, err)
+	assert.Equal(t, signature, decoded.Signatures["attributes"])
+	assert.Equal(t, sh.Encode(), decoded.Encode())
+}
+
+// TestSignUnserializableBlock tests that a block holding a value that has no JSON form cannot be signed
+func TestSignUnserializableBlock(t *testing.T) {
+	sh := NewValidStone()
+	sh.Attributes = map[string]interface{}{ "ref_id": sh.Meta["id"], "data": json.Number("abc") }
+	_, err := sh.Sign("attributes", util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,431 @@
+package stone
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// CBOR (RFC 8949) major types
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTagged = 6
+	cborSimple = 7
+)
+
+// The deepest nesting of arrays and maps accepted when decoding
+const cborMaxDepth = 64
+
+// cborTag is a tagged CBOR data item
+type cborTag struct {
+	Number  uint64
+	Content interface{}
+}
+
+// cborMapItem is a key and value of a CBOR map with non-text keys.
+// Maps with text keys are represented by map[string]interface{}.
+type cborMapItem struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// Encode a value as CBOR. Lengths use the shortest form and map keys
+// are sorted by their encoded bytes, so a value has a single encoding.
+// Supported values are nil, bool, string, []byte, integers, float64,
+// json.Number, []interface{}, map[string]interface{}, []cborMapItem
+// and cborTag.
+func cborMarshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeCBOR(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Writes the head of a data item: its major type and argument
+func writeCBORHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major << 5 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(major << 5 | 24)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(major << 5 | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major << 5 | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major << 5 | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+func writeCBORInt(buf *bytes.Buffer, n int64) {
+	if n < 0 {
+		writeCBORHead(buf, cborNegInt, uint64(-1 - n))
+		return
+	}
+	writeCBORHead(buf, cborUint, uint64(n))
+}
+
+func writeCBORFloat(buf *bytes.Buffer, f float64) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return errors.New("NaN and infinite numbers are not supported")
+	}
+	if float64(float32(f)) == f {
+		buf.WriteByte(cborSimple << 5 | 26)
+		binary.Write(buf, binary.BigEndian, math.Float32bits(float32(f)))
+		return nil
+	}
+	buf.WriteByte(cborSimple << 5 | 27)
+	binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+	return nil
+}
+
+// Writes map entries sorted by their encoded keys
+func writeCBORMap(buf *bytes.Buffer, items []cborMapItem) error {
+
+	type entry struct {
+		key   []byte
+		value interface{}
+	}
+
+	var entries []entry
+	for _, item := range items {
+		key, err := cborMarshal(item.Key)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{ key, item.Value })
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+
+	writeCBORHead(buf, cborMap, uint64(len(entries)))
+	for i, e := range entries {
+		if i > 0 && bytes.Equal(e.key, entries[i-1].key) {
+			return errors.New("duplicate map key")
+		}
+		buf.Write(e.key)
+		if err := writeCBOR(buf, e.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeCBOR(buf *bytes.Buffer, v interface{}) error {
+	switch val := v.(type) {
+	case nil:
+		buf.WriteByte(cborSimple << 5 | 22)
+	case bool:
+		if val {
+			buf.WriteByte(cborSimple << 5 | 21)
+		} else {
+			buf.WriteByte(cborSimple << 5 | 20)
+		}
+	case string:
+		writeCBORHead(buf, cborText, uint64(len(val)))
+		buf.WriteString(val)
+	case []byte:
+		writeCBORHead(buf, cborBytes, uint64(len(val)))
+		buf.Write(val)
+	case int:
+		writeCBORInt(buf, int64(val))
+	case int64:
+		writeCBORInt(buf, val)
+	case uint64:
+		writeCBORHead(buf, cborUint, val)
+	case float64:
+		if val == math.Trunc(val) && math.Abs(val) < 1 << 53 {
+			writeCBORInt(buf, int64(val))
+			return nil
+		}
+		return writeCBORFloat(buf, val)
+	case json.Number:
+		if n, err := val.Int64(); err == nil {
+			writeCBORInt(buf, n)
+			return nil
+		}
+		if n, err := strconv.ParseUint(string(val), 10, 64); err == nil {
+			writeCBORHead(buf, cborUint, n)
+			return nil
+		}
+		f, err := val.Float64()
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid number %s", val))
+		}
+		return writeCBOR(buf, f)
+	case []interface{}:
+		writeCBORHead(buf, cborArray, uint64(len(val)))
+		for _, item := range val {
+			if err := writeCBOR(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		var items []cborMapItem
+		for key, value := range val {
+			items = append(items, cborMapItem{ key, value })
+		}
+		return writeCBORMap(buf, items)
+	case []cborMapItem:
+		return writeCBORMap(buf, val)
+	case cborTag:
+		writeCBORHead(buf, cborTagged, val.Number)
+		return writeCBOR(buf, val.Content)
+	default:
+		return errors.New(fmt.Sprintf("unsupported value type %T", v))
+	}
+	return nil
+}
+
+// cborDecoder decodes CBOR data items
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+// Decode a CBOR data item. Integers are decoded as int64 (uint64 if
+// too large), floating point numbers as float64 and maps as
+// map[string]interface{} if all keys are text, []cborMapItem otherwise.
+// Indefinite lengths, duplicate map keys and trailing data are rejected.
+func cborUnmarshal(data []byte) (interface{}, error) {
+	d := &cborDecoder{ data: data }
+	v, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, errors.New("cbor: unexpected data after item")
+	}
+	return v, nil
+}
+
+// Reads n bytes
+func (self *cborDecoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(self.data) - self.pos) {
+		return nil, errors.New("cbor: unexpected end of data")
+	}
+	b := self.data[self.pos:self.pos + int(n)]
+	self.pos += int(n)
+	return b, nil
+}
+
+// Reads the head of a data item
+func (self *cborDecoder) head() (byte, byte, uint64, error) {
+
+	b, err := self.read(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	major, info := b[0] >> 5, b[0] & 0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		arg, err := self.read(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		var n uint64
+		for _, c := range arg {
+			n = n << 8 | uint64(c)
+		}
+		return major, info, n, nil
+	}
+
+	return 0, 0, 0, errors.New("cbor: indefinite lengths are not supported")
+}
+
+func (self *cborDecoder) decode(depth int) (interface{}, error) {
+
+	if depth > cborMaxDepth {
+		return nil, errors.New("cbor: data is nested too deeply")
+	}
+
+	major, info, n, err := self.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUint:
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+
+	case cborNegInt:
+		if n > math.MaxInt64 {
+			return nil, errors.New("cbor: negative integer is too large")
+		}
+		return -1 - int64(n), nil
+
+	case cborBytes:
+		b, err := self.read(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, b...), nil
+
+	case cborText:
+		b, err := self.read(n)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+
+	case cborArray:
+		if n > uint64(len(self.data) - self.pos) {
+			return nil, errors.New("cbor: unexpected end of data")
+		}
+		var items = make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			item, err := self.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+
+	case cborMap:
+		if n > uint64(len(self.data) - self.pos) / 2 {
+			return nil, errors.New("cbor: unexpected end of data")
+		}
+		var items []cborMapItem
+		var textKeys = true
+		var seen = make(map[string]bool)
+		for i := uint64(0); i < n; i++ {
+			start := self.pos
+			key, err := self.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			encodedKey := string(self.data[start:self.pos])
+			if seen[encodedKey] {
+				return nil, errors.New("cbor: duplicate map key")
+			}
+			seen[encodedKey] = true
+			value, err := self.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := key.(string); !ok {
+				textKeys = false
+			}
+			items = append(items, cborMapItem{ key, value })
+		}
+		if !textKeys {
+			return items, nil
+		}
+		var m = make(map[string]interface{})
+		for _, item := range items {
+			m[item.Key.(string)] = item.Value
+		}
+		return m, nil
+
+	case cborTagged:
+		content, err := self.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return cborTag{ n, content }, nil
+	}
+
+	// major type 7: simple values and floats
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22:
+		return nil, nil
+	case 25:
+		return float16ToFloat64(uint16(n)), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(n))), nil
+	case 27:
+		return math.Float64frombits(n), nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("cbor: unsupported simple value %d", n))
+}
+
+// Converts an IEEE 754 half precision number to float64
+func float16ToFloat64(h uint16) float64 {
+	sign := 1.0
+	if h & 0x8000 != 0 {
+		sign = -1.0
+	}
+	exp := int(h >> 10 & 0x1f)
+	frac := float64(h & 0x3ff)
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 31:
+		if frac == 0 {
+			return math.Inf(int(sign))
+		}
+		return math.NaN()
+	}
+	return sign * math.Ldexp(frac + 1024, exp - 25)
+}
+
+// Converts a decoded CBOR value to the form of a decoded JSON value:
+// numbers become json.Number. Byte strings, tags and maps with non-text
+// keys have no JSON form and are rejected.
+func cborToJSONValue(v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case nil, bool, string:
+		return val, nil
+	case int64:
+		return json.Number(strconv.FormatInt(val, 10)), nil
+	case uint64:
+		return json.Number(strconv.FormatUint(val, 10)), nil
+	case float64:
+		n, err := canonicalNumber(val)
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(n), nil
+	case []interface{}:
+		var items = make([]interface{}, len(val))
+		for i, item := range val {
+			converted, err := cborToJSONValue(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = converted
+		}
+		return items, nil
+	case map[string]interface{}:
+		var m = make(map[string]interface{})
+		for key, value := range val {
+			converted, err := cborToJSONValue(value)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = converted
+		}
+		return m, nil
+	}
+	return nil, errors.New(fmt.Sprintf("cbor: %T has no JSON form", v))
+}
@@ -0,0 +1,75 @@
+package stone
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCBORMarshal tests encoding against the examples of RFC 8949 Appendix A
+func TestCBORMarshal(t *testing.T) {
+	var cases = []struct {
+		value    interface{}
+		expected string
+	}{
+		{ 0, "00" },
+		{ 23, "17" },
+		{ 24, "1818" },
+		{ 1000000, "1a000f4240" },
+		{ int64(-1000), "3903e7" },
+		{ json.Number("18446744073709551615"), "1bffffffffffffffff" },
+		{ 1.5, "fa3fc00000" },
+		{ 1.1, "fb3ff199999999999a" },
+		{ json.Number("100.0"), "1864" },
+		{ false, "f4" },
+		{ nil, "f6" },
+		{ "IETF", "6449455446" },
+		{ []byte{ 1, 2, 3, 4 }, "4401020304" },
+		{ []interface{}{ 1, []interface{}{ 2, 3 } }, "8201820203" },
+		{ map[string]interface{}{ "b": 1, "a": 2, "aa": 3 }, "a3616102616201626161" + "03" },
+		{ cborTag{ 1, 1363896240 }, "c11a514b67b0" },
+	}
+	for _, c := range cases {
+		data, err := cborMarshal(c.value)
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, hex.EncodeToString(data))
+	}
+}
+
+// TestCBORUnmarshal tests that encoded values decode to the same value
+func TestCBORUnmarshal(t *testing.T) {
+	value := map[string]interface{}{
+		"amount": int64(-25),
+		"rate": 0.25,
+		"tags": []interface{}{ "gold", true, nil },
+		"raw": []byte{ 0xff },
+	}
+	data, err := cborMarshal(value)
+	assert.Nil(t, err)
+	decoded, err := cborUnmarshal(data)
+	assert.Nil(t, err)
+	assert.Equal(t, value, decoded)
+
+	half, err := cborUnmarshal([]byte{ 0xf9, 0x3c, 0x00 })
+	assert.Nil(t, err)
+	assert.Equal(t, 1.0, half)
+}
+
+// TestCBORUnmarshalInvalid tests that malformed and non-deterministic data is rejected
+func TestCBORUnmarshalInvalid(t *testing.T) {
+	var cases = map[string]string{
+		"1a000f42": "cbor: unexpected end of data",
+		"9f0102ff": "cbor: indefinite lengths are not supported",
+		"a2616101616102": "cbor: duplicate map key",
+		"0000": "cbor: unexpected data after item",
+		"9bffffffffffffffff": "cbor: unexpected end of data",
+		"f7": "cbor: unsupported simple value 23",
+	}
+	for input, expected := range cases {
+		data, _ := hex.DecodeString(input)
+		_, err := cborUnmarshal(data)
+		assert.NotNil(t, err)
+		assert.Equal(t, expected, err.Error())
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	gocrypto "crypto"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+	"github.com/ellcrys/crypto"
+	"github.com/ellcrys/util"
+	"github.com/stonedoc/stone"
+)
+
+// Create a flag set for a command. Errors and usage go to stderr.
+func newFlagSet(e *env, name, args string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(e.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: stone %s [flags] %s\n", name, args)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// Read a stone from the input. The input can be a stone
+// in JSON form or an encoded stone.
+func readStone(e *env, args []string) (*stone.Stone, error) {
+	input, err := readInput(e, args)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(input, "{") {
+		return stone.Load(input)
+	}
+	return stone.Decode(input)
+}
+
+// Write a value as indented JSON
+func printJSON(w io.Writer, v interface{}) error {
+	bs, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, string(bs))
+	return nil
+}
+
+// Generate an RSA key pair. The keys are printed or, with -out,
+// written to <out> (private key) and <out>.pub (public key).
+func keygen(e *env, args []string) error {
+
+	flags := newFlagSet(e, "keygen", "")
+	out := flags.String("out", "", "write the private key to `file` and the public key to file.pub")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	keys, err := crypto.GenerateKeyPair()
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		fmt.Fprint(e.stdout, keys["private_key"] + keys["public_key"])
+		return nil
+	}
+
+	if err := ioutil.WriteFile(*out, []byte(keys["private_key"]), 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(*out + ".pub", []byte(keys["public_key"]), 0644)
+}
+
+// Create a stone. The meta block is built from -type and -id or,
+// without -type, read from the input.
+func create(e *env, args []string) error {
+
+	flags := newFlagSet(e, "create", "[meta.json]")
+	keyFile := flags.String("key", "", "issuer private key `file`")
+	stoneType := flags.String("type", "", "stone type; the meta block is read from the input if not set")
+	id := flags.String("id", "", "stone id (default: a new id)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	key, err := readKey(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	var meta map[string]interface{}
+	if *stoneType != "" {
+		if *id == "" {
+			*id = util.NewID()
+		}
+		meta = map[string]interface{}{
+			"id": *id,
+			"type": *stoneType,
+			"created_at": time.Now().Unix(),
+		}
+	} else {
+		input, err := readInput(e, flags.Args())
+		if err != nil {
+			return err
+		}
+		if meta, err = util.JSONToMap(input); err != nil {
+			return err
+		}
+	}
+
+	s, err := stone.Create(meta, key)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(e.stdout, s.JSON())
+	return nil
+}
+
+// Sign a block of a stone. With -data, the block is set to the content
+// of the data file first; otherwise the existing block is re-signed.
+func sign(e *env, args []string) error {
+
+	flags := newFlagSet(e, "sign", "[stone]")
+	keyFile := flags.String("key", "", "issuer private key `file`")
+	blockName := flags.String("block", "", "name of the block to sign")
+	dataFile := flags.String("data", "", "JSON `file` holding the new block")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	key, err := readKey(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	s, err := readStone(e, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	if *dataFile == "" {
+		if _, err := s.Sign(*blockName, key); err != nil {
+			return err
+		}
+		fmt.Fprintln(e.stdout, s.JSON())
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(*dataFile)
+	if err != nil {
+		return err
+	}
+
+	block, err := util.JSONToMap(string(data))
+	if err != nil {
+		return err
+	}
+
+	switch *blockName {
+	case "meta":
+		err = s.AddMeta(block, key)
+	case "ownership":
+		err = s.AddOwnership(block, key)
+	case "attributes":
+		err = s.AddAttributes(block, key)
+	case "embeds":
+		err = s.AddEmbed(block, key)
+	default:
+		err = s.SetBlock(*blockName, block, key)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(e.stdout, s.JSON())
+	return nil
+}
+
+// Verify a stone with the issuer public key the way DecodeAndVerifyWith
+// does. Every block of the input must be signed and match its signature,
+// as blocks loaded from JSON may have been changed next to their signature.
+func verifyStone(s *stone.Stone, key string) error {
+
+	publicKey, err := stone.ParsePublicKey(key)
+	if err != nil {
+		return err
+	}
+
+	blocks := s.ToMap()
+	for _, name := range stone.BlockNames() {
+		block, _ := blocks[name].(map[string]interface{})
+		if !s.HasSignature(name) {
+			if len(block) > 0 || name == "meta" {
+				return errors.New(fmt.Sprintf("`%s` block has no signature", name))
+			}
+			continue
+		}
+		if err := s.CheckBlock(name); err != nil {
+			return err
+		}
+	}
+
+	_, err = stone.DecodeAndVerifyWith(s.Encode(), stone.PublicKeyResolverFunc(func(issuer, keyID string) (gocrypto.PublicKey, error) {
+		return publicKey, nil
+	}))
+	return err
+}
+
+// Verify a stone with the issuer public key. The stone is verified and
+// validated as a whole; the verified blocks, or only -block, are printed.
+func verify(e *env, args []string) error {
+
+	flags := newFlagSet(e, "verify", "[stone]")
+	keyFile := flags.String("key", "", "issuer public key `file`")
+	blockName := flags.String("block", "", "print only this block")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	key, err := readKey(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	s, err := readStone(e, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	if err := verifyStone(s, key); err != nil {
+		return err
+	}
+
+	blockNames := stone.BlockNames()
+	if *blockName != "" {
+		if !s.HasSignature(*blockName) {
+			return errors.New(fmt.Sprintf("`%s` block has no signature", *blockName))
+		}
+		blockNames = []string{ *blockName }
+	}
+
+	for _, name := range blockNames {
+		if s.HasSignature(name) {
+			fmt.Fprintf(e.stdout, "%s: verified\n", name)
+		}
+	}
+
+	return nil
+}
+
+// Encode a stone
+func encode(e *env, args []string) error {
+
+	flags := newFlagSet(e, "encode", "[stone]")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	s, err := readStone(e, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(e.stdout, s.Encode())
+	return nil
+}
+
+// Decode an encoded stone and print it as JSON
+func decode(e *env, args []string) error {
+
+	flags := newFlagSet(e, "decode", "[encoded stone]")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	input, err := readInput(e, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	s, err := stone.Decode(input)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(e.stdout, s.ToMap())
+}
+
+// Validate a stone in JSON form and print every error found
+func validate(e *env, args []string) error {
+
+	flags := newFlagSet(e, "validate", "[stone.json]")
+	schemaDir := flags.String("schemas", "", "`dir` of <type>.json attribute schemas")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	validator := stone.NewValidator()
+	if *schemaDir != "" {
+		validator.Schemas = stone.NewSchemaRegistry()
+		if err := validator.Schemas.LoadDir(*schemaDir); err != nil {
+			return err
+		}
+	}
+
+	input, err := readInput(e, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	errs, ok := validator.ValidateAll(input).(stone.ValidationErrors)
+	if !ok {
+		fmt.Fprintln(e.stdout, "valid")
+		return nil
+	}
+
+	for _, err := range errs {
+		fmt.Fprintf(e.stdout, "%s [%s] %s\n", err.Pointer, err.Code, err.Error())
+	}
+
+	return errors.New(fmt.Sprintf("%d validation errors", len(errs)))
+}
+
+// Print the blocks of a stone with the header of their signatures.
+// With -key, the stone is verified (see verifyStone) and the status of
+// each signature and of the stone is printed.
+func inspect(e *env, args []string) error {
+
+	flags := newFlagSet(e, "inspect", "[stone]")
+	keyFile := flags.String("key", "", "issuer public key `file` to verify signatures with")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var key string
+	var err error
+	if *keyFile != "" {
+		if key, err = readKey(*keyFile); err != nil {
+			return err
+		}
+	}
+
+	s, err := readStone(e, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	// blocks are only reported as verified if the whole stone is
+	var stoneErr error
+	if key != "" {
+		stoneErr = verifyStone(s, key)
+	}
+
+	blocks := s.ToMap()
+	for _, name := range stone.BlockNames() {
+
+		block, _ := blocks[name].(map[string]interface{})
+		if len(block) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(e.stdout, "== %s ==\n", name)
+		if err := printJSON(e.stdout, block); err != nil {
+			return err
+		}
+
+		if !s.HasSignature(name) {
+			fmt.Fprintln(e.stdout, "signature: none")
+			continue
+		}
+
+		header, err := s.SignatureHeader(name)
+		if err != nil {
+			fmt.Fprintf(e.stdout, "signature: %s\n", err.Error())
+			continue
+		}
+
+		fmt.Fprint(e.stdout, "signature header: ")
+		if err := printJSON(e.stdout, header); err != nil {
+			return err
+		}
+
+		switch {
+		case key == "":
+			fmt.Fprintln(e.stdout, "signature: not verified")
+		case s.Verify(name, key) != nil:
+			fmt.Fprintln(e.stdout, "signature: INVALID")
+		case s.CheckBlock(name) != nil:
+			fmt.Fprintln(e.stdout, "signature: INVALID (block does not match its signature)")
+		case stoneErr != nil:
+			fmt.Fprintln(e.stdout, "signature: not verified (stone is INVALID)")
+		default:
+			fmt.Fprintln(e.stdout, "signature: verified")
+		}
+	}
+
+	if stoneErr != nil {
+		fmt.Fprintf(e.stdout, "stone: INVALID (%s)\n", stoneErr.Error())
+	} else if key != "" {
+		fmt.Fprintln(e.stdout, "stone: verified")
+	}
+
+	return nil
+}
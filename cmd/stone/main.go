@@ -0,0 +1,119 @@
+// Command stone issues, inspects and verifies stones.
+//
+//  Usage:
+//
+//  stone <command> [flags] [file]
+//
+// Commands read the stone (or encoded stone) from the file
+// argument or, when it is omitted or `-`, from stdin.
+// Run `stone <command> -h` for the flags of a command.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// A command is a subcommand of the tool
+type command struct {
+	usage string
+	run   func(env *env, args []string) error
+}
+
+// env holds the standard streams of an invocation
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+var commands = map[string]command{
+	"keygen": { "generate an RSA key pair", keygen },
+	"create": { "create a stone with a signed meta block", create },
+	"sign": { "set and sign a block, or re-sign an existing block", sign },
+	"verify": { "verify the signatures of a stone", verify },
+	"encode": { "encode a stone", encode },
+	"decode": { "decode an encoded stone", decode },
+	"validate": { "validate a stone and list every error", validate },
+	"inspect": { "print the blocks and signature headers of a stone", inspect },
+}
+
+func main() {
+	if err := run(os.Args[1:], &env{ os.Stdin, os.Stdout, os.Stderr }); err != nil {
+		fmt.Fprintln(os.Stderr, "stone: " + err.Error())
+		os.Exit(1)
+	}
+}
+
+// Run the command named by the first argument
+func run(args []string, e *env) error {
+
+	if len(args) == 0 || args[0] == "-h" || args[0] == "help" {
+		printUsage(e.stderr)
+		if len(args) == 0 {
+			return errors.New("command is required")
+		}
+		return nil
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		printUsage(e.stderr)
+		return errors.New(fmt.Sprintf("unknown command `%s`", args[0]))
+	}
+
+	return cmd.run(e, args[1:])
+}
+
+// Print the list of commands
+func printUsage(w io.Writer) {
+	var names []string
+	for name, _ := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "Usage: stone <command> [flags] [file]\n\nCommands:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].usage)
+	}
+}
+
+// Read the input of a command: the file named by the only
+// positional argument or stdin if there is none or it is `-`.
+func readInput(e *env, args []string) (string, error) {
+
+	var data []byte
+	var err error
+
+	switch {
+	case len(args) > 1:
+		return "", errors.New("too many arguments")
+	case len(args) == 0 || args[0] == "-":
+		data, err = ioutil.ReadAll(e.stdin)
+	default:
+		data, err = ioutil.ReadFile(args[0])
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Read a key file
+func readKey(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("key file is required")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
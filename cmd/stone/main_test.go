@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"github.com/ellcrys/util"
+	"github.com/stretchr/testify/assert"
+)
+
+var issuerPrivKey = "../../tests/fixtures/rsa_priv_1.txt"
+var issuerPubKey = "../../tests/fixtures/rsa_pub_1.txt"
+
+// Run a command with the given stdin and return its stdout
+func runCommand(t *testing.T, stdin string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	err := run(args, &env{ strings.NewReader(stdin), &stdout, &stderr })
+	return stdout.String(), err
+}
+
+// TestCreateSignEncodeVerify tests the commands used to issue and verify a stone
+func TestCreateSignEncodeVerify(t *testing.T) {
+
+	created, err := runCommand(t, "", "create", "-key", issuerPrivKey, "-type", "coupon")
+	assert.Nil(t, err)
+
+	dir, _ := ioutil.TempDir("", "stone")
+	defer os.RemoveAll(dir)
+	meta, _ := util.JSONToMap(created)
+	metaID := meta["meta"].(map[string]interface{})["id"].(string)
+	dataFile := filepath.Join(dir, "attributes.json")
+	ioutil.WriteFile(dataFile, []byte(`{ "ref_id": "` + metaID + `", "data": { "value": 10 } }`), 0644)
+
+	signed, err := runCommand(t, created, "sign", "-key", issuerPrivKey, "-block", "attributes", "-data", dataFile)
+	assert.Nil(t, err)
+
+	encoded, err := runCommand(t, signed, "encode")
+	assert.Nil(t, err)
+
+	out, err := runCommand(t, encoded, "verify", "-key", issuerPubKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "meta: verified\nattributes: verified\n", out)
+
+	_, err = runCommand(t, encoded, "verify", "-key", "../../tests/fixtures/rsa_pub_2.txt")
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block signature could not be verified", err.Error())
+
+	decoded, err := runCommand(t, encoded, "decode")
+	assert.Nil(t, err)
+	assert.Contains(t, decoded, metaID)
+}
+
+// TestCreateFromMetaFile tests that the meta block can be read from the input
+func TestCreateFromMetaFile(t *testing.T) {
+	meta := `{ "id": "` + util.NewID() + `", "type": "ticket", "created_at": 1460000000 }`
+	out, err := runCommand(t, meta, "create", "-key", issuerPrivKey, "-")
+	assert.Nil(t, err)
+	assert.Contains(t, out, `"type":"ticket"`)
+}
+
+// TestInspect tests that inspect prints blocks, signature headers and verification status
+func TestInspect(t *testing.T) {
+	stone, err := runCommand(t, "", "create", "-key", issuerPrivKey, "-type", "coupon")
+	assert.Nil(t, err)
+	out, err := runCommand(t, stone, "inspect")
+	assert.Nil(t, err)
+	assert.Contains(t, out, "== meta ==")
+	assert.Contains(t, out, `"alg": "RS256"`)
+	assert.Contains(t, out, "signature: not verified")
+
+	out, err = runCommand(t, stone, "inspect", "-key", issuerPubKey)
+	assert.Nil(t, err)
+	assert.Contains(t, out, "signature: verified")
+	assert.Contains(t, out, "stone: verified")
+}
+
+// TestVerifyUnsignedStone tests that a stone without a meta signature is not verified
+func TestVerifyUnsignedStone(t *testing.T) {
+	unsigned := `{"meta":{"id":"` + util.NewID() + `","type":"coupon","created_at":1460000000}}`
+	out, err := runCommand(t, unsigned, "verify", "-key", issuerPubKey)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block has no signature", err.Error())
+	assert.Equal(t, "", out)
+}
+
+// TestVerifyTransplantedBlock tests that a block signed for another stone with the same meta id is rejected
+func TestVerifyTransplantedBlock(t *testing.T) {
+	metaID := util.NewID()
+	created, err := runCommand(t, `{ "id": "` + metaID + `", "type": "coupon", "created_at": 1460000000 }`, "create", "-key", issuerPrivKey, "-")
+	assert.Nil(t, err)
+	other, err := runCommand(t, `{ "id": "` + metaID + `", "type": "ticket", "created_at": 1460000000 }`, "create", "-key", issuerPrivKey, "-")
+	assert.Nil(t, err)
+
+	dir, _ := ioutil.TempDir("", "stone")
+	defer os.RemoveAll(dir)
+	dataFile := filepath.Join(dir, "ownership.json")
+	ioutil.WriteFile(dataFile, []byte(`{ "ref_id": "` + metaID + `", "type": "sole", "sole": { "address_id": "alice" } }`), 0644)
+	other, err = runCommand(t, other, "sign", "-key", issuerPrivKey, "-block", "ownership", "-data", dataFile)
+	assert.Nil(t, err)
+
+	stone, _ := util.JSONToMap(created)
+	otherStone, _ := util.JSONToMap(other)
+	stone["ownership"] = otherStone["ownership"]
+	stone["signatures"].(map[string]interface{})["ownership"] = otherStone["signatures"].(map[string]interface{})["ownership"]
+	transplanted, _ := util.MapToJSON(stone)
+
+	_, err = runCommand(t, transplanted, "verify", "-key", issuerPubKey)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`ownership` block signature is linked to another `meta` signature", err.Error())
+
+	out, err := runCommand(t, transplanted, "inspect", "-key", issuerPubKey)
+	assert.Nil(t, err)
+	assert.Contains(t, out, "signature: not verified (stone is INVALID)")
+	assert.Contains(t, out, "stone: INVALID (`ownership` block signature is linked to another `meta` signature)")
+}
+
+// TestVerifyEditedBlock tests that a block edited next to its signature is not reported as verified
+func TestVerifyEditedBlock(t *testing.T) {
+	created, err := runCommand(t, "", "create", "-key", issuerPrivKey, "-type", "coupon")
+	assert.Nil(t, err)
+	edited := strings.Replace(created, `"type":"coupon"`, `"type":"ticket"`, 1)
+	assert.NotEqual(t, created, edited)
+
+	_, err = runCommand(t, edited, "verify", "-key", issuerPubKey)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block does not match its signature", err.Error())
+
+	out, err := runCommand(t, edited, "inspect", "-key", issuerPubKey)
+	assert.Nil(t, err)
+	assert.Contains(t, out, "signature: INVALID (block does not match its signature)")
+}
+
+// TestValidateListsErrors tests that validate prints every error
+func TestValidateListsErrors(t *testing.T) {
+	out, err := runCommand(t, `{ "meta": { "id": 1, "type": 2, "created_at": 1460000000 } }`, "validate")
+	assert.NotNil(t, err)
+	assert.Equal(t, "2 validation errors", err.Error())
+	assert.Equal(t, "/meta/id [invalid_type] `meta.id` value type is invalid. Expects a string\n/meta/type [invalid_type] `meta.type` value type is invalid. Expects a string\n", out)
+}
+
+// TestValidateWithSchemas tests that attributes are validated against the schema of the stone type
+func TestValidateWithSchemas(t *testing.T) {
+	input := `{ "meta": { "id": "` + util.Sha1("abcd") + `", "type": "currency", "created_at": 1460000000 }, "attributes": { "ref_id": "` + util.Sha1("abcd") + `", "data": { "currency": "USD" } } }`
+	out, err := runCommand(t, input, "validate", "-schemas", "../../tests/fixtures/schemas")
+	assert.NotNil(t, err)
+	assert.Equal(t, "1 validation errors", err.Error())
+	assert.Equal(t, "/attributes/data/amount [schema_violation] `attributes.data` does not satisfy the `currency` schema: property `/amount` is required\n", out)
+}
+
+// TestUnknownCommand tests that an unknown command is rejected
+func TestUnknownCommand(t *testing.T) {
+	_, err := runCommand(t, "", "mint")
+	assert.NotNil(t, err)
+	assert.Equal(t, "unknown command `mint`", err.Error())
+}
+
+// TestKeygen tests that keygen writes a key pair usable for signing
+func TestKeygen(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stone")
+	defer os.RemoveAll(dir)
+	key := filepath.Join(dir, "issuer")
+	_, err := runCommand(t, "", "keygen", "-out", key)
+	assert.Nil(t, err)
+
+	created, err := runCommand(t, "", "create", "-key", key, "-type", "coupon")
+	assert.Nil(t, err)
+	out, err := runCommand(t, created, "verify", "-key", key + ".pub")
+	assert.Nil(t, err)
+	assert.Equal(t, "meta: verified\n", out)
+}
@@ -0,0 +1,688 @@
+package stone
+
+import (
+	gocrypto "crypto"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"github.com/ellcrys/util"
+)
+
+// COSE (RFC 9052) header labels and the COSE_Sign1 tag
+const (
+	coseHeaderAlg       = 1
+	coseHeaderKid       = 4
+	coseHeaderCWTClaims = 15
+	cwtClaimIss         = 1
+	coseSign1Tag        = 18
+
+	// links to the stone (see VerifyLinks)
+	coseHeaderLinked   = "linked"
+	coseHeaderMetaHash = "meta_hash"
+)
+
+// COSE algorithm identifiers of the signature algorithms (RFC 9053, RFC 8812)
+var coseAlgorithms = map[string]int64{ ES256: -7, ES384: -35, EdDSA: -8, RS256: -257 }
+
+// coseSign1 is a decoded COSE_Sign1 structure
+type coseSign1 struct {
+	protected []byte
+	alg       string
+	kid       string
+	iss       string
+	payload   []byte
+	signature []byte
+	linked    bool
+	metaHash  string
+}
+
+// Returns the COSE_Sign1 Sig_structure signed for a protected header and payload
+func coseSigStructure(protected, payload []byte) ([]byte, error) {
+	return cborMarshal([]interface{}{ "Signature1", protected, []byte{}, payload })
+}
+
+// Sign a payload and return a tagged COSE_Sign1 structure. The protected
+// header carries the algorithm, the signer's key id (its thumbprint unless
+// the signer is an IdentifiedSigner with its own key id) and, if set, its
+// issuer as a CWT claim, followed by params.
+func signCOSE(signer Signer, payload []byte, params ...cborMapItem) (cborTag, error) {
+
+	alg := signer.Algorithm()
+	coseAlg, ok := coseAlgorithms[alg]
+	if !ok || !util.InStringSlice(AllowedAlgorithms, alg) {
+		return cborTag{}, fmt.Errorf("algorithm %s is not allowed", alg)
+	}
+
+	var keyID, issuer string
+	if identified, ok := signer.(IdentifiedSigner); ok {
+		keyID = identified.KeyID()
+		issuer = identified.Issuer()
+	}
+	if keyID == "" {
+		var err error
+		if keyID, err = Thumbprint(signer.Public()); err != nil {
+			return cborTag{}, err
+		}
+	}
+
+	header := []cborMapItem{
+		{ coseHeaderAlg, coseAlg },
+		{ coseHeaderKid, []byte(keyID) },
+	}
+	if issuer != "" {
+		header = append(header, cborMapItem{ coseHeaderCWTClaims, []cborMapItem{ { cwtClaimIss, issuer } } })
+	}
+	header = append(header, params...)
+
+	protected, err := cborMarshal(header)
+	if err != nil {
+		return cborTag{}, err
+	}
+
+	toBeSigned, err := coseSigStructure(protected, payload)
+	if err != nil {
+		return cborTag{}, err
+	}
+
+	sig, err := signer.SignInput(toBeSigned)
+	if err != nil {
+		return cborTag{}, err
+	}
+
+	return cborTag{ coseSign1Tag, []interface{}{ protected, map[string]interface{}{}, payload, sig } }, nil
+}
+
+// Parse a decoded COSE_Sign1 structure
+func parseCOSE(v interface{}) (*coseSign1, error) {
+
+	var invalid = errors.New("invalid COSE_Sign1 structure")
+
+	tag, ok := v.(cborTag)
+	if !ok || tag.Number != coseSign1Tag {
+		return nil, invalid
+	}
+
+	parts, ok := tag.Content.([]interface{})
+	if !ok || len(parts) != 4 {
+		return nil, invalid
+	}
+
+	var sign1 = &coseSign1{}
+	if sign1.protected, ok = parts[0].([]byte); !ok {
+		return nil, invalid
+	}
+	if sign1.payload, ok = parts[2].([]byte); !ok {
+		return nil, invalid
+	}
+	if sign1.signature, ok = parts[3].([]byte); !ok {
+		return nil, invalid
+	}
+
+	decoded, err := cborUnmarshal(sign1.protected)
+	if err != nil {
+		return nil, invalid
+	}
+	header, ok := decoded.([]cborMapItem)
+	if !ok {
+		return nil, invalid
+	}
+
+	for _, item := range header {
+		switch item.Key {
+		case int64(coseHeaderAlg):
+			for alg, coseAlg := range coseAlgorithms {
+				if item.Value == coseAlg {
+					sign1.alg = alg
+				}
+			}
+		case int64(coseHeaderKid):
+			kid, _ := item.Value.([]byte)
+			sign1.kid = string(kid)
+		case int64(coseHeaderCWTClaims):
+			claims, _ := item.Value.([]cborMapItem)
+			for _, claim := range claims {
+				if claim.Key == int64(cwtClaimIss) {
+					sign1.iss, _ = claim.Value.(string)
+				}
+			}
+		case coseHeaderLinked:
+			sign1.linked, _ = item.Value.(bool)
+		case coseHeaderMetaHash:
+			sign1.metaHash, _ = item.Value.(string)
+		}
+	}
+
+	if sign1.alg == "" {
+		return nil, errors.New("COSE_Sign1 algorithm is missing or not supported")
+	}
+
+	return sign1, nil
+}
+
+// Verify the signature with a public key. The algorithm must
+// be allowed and must match the type of the key.
+func (self *coseSign1) verify(publicKey gocrypto.PublicKey) error {
+
+	if !util.InStringSlice(AllowedAlgorithms, self.alg) {
+		return fmt.Errorf("algorithm %q is not allowed", self.alg)
+	}
+
+	keyAlg, err := algorithmForKey(publicKey)
+	if err != nil {
+		return err
+	}
+	if keyAlg != self.alg {
+		return fmt.Errorf("algorithm %q does not match key", self.alg)
+	}
+
+	toBeSigned, err := coseSigStructure(self.protected, self.payload)
+	if err != nil {
+		return err
+	}
+
+	if !verifySignature(self.alg, publicKey, toBeSigned, self.signature) {
+		return errors.New("failed to verify signature")
+	}
+
+	return nil
+}
+
+// Returns the block carried by the payload
+func (self *coseSign1) block(blockName string) (map[string]interface{}, error) {
+	decoded, err := cborUnmarshal(self.payload)
+	if err != nil {
+		return nil, errors.New("malformed " + blockName + " block")
+	}
+	value, err := cborToJSONValue(decoded)
+	if err != nil {
+		return nil, errors.New("malformed " + blockName + " block")
+	}
+	block, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("malformed " + blockName + " block")
+	}
+	return block, nil
+}
+
+// Returns the CBOR encoding of a block
+func cborBlock(block map[string]interface{}) ([]byte, error) {
+
+	// normalize the block to the values of decoded JSON
+	blockJSON, err := json.Marshal(block)
+	if err != nil {
+		return nil, errors.New("block cannot be serialized: " + err.Error())
+	}
+	var normalized interface{}
+	decoder := json.NewDecoder(bytes.NewReader(blockJSON))
+	decoder.UseNumber()
+	if err := decoder.Decode(&normalized); err != nil {
+		return nil, errors.New("block cannot be serialized: " + err.Error())
+	}
+
+	return cborMarshal(normalized)
+}
+
+// Encode the stone as CBOR. The ownership history, owner signatures and
+// disclosures are kept as JWS. Signed blocks are encoded in one of two forms:
+//
+// Without signers, each block is carried with its JWS signature: an array
+// of the protected header, payload and signature bytes. No key is needed,
+// the stone decoded with DecodeCBOR has the same JWS signatures and can be
+// encoded with Encode again, and owner signatures and transfers can still
+// be verified. A stone decoded from COSE signatures keeps them.
+//
+// With signers, each block is a COSE_Sign1 structure whose payload is the
+// CBOR encoding of the block, which is smaller. The blocks encoded are the
+// ones signed by the JWS signatures (or carried by the COSE signatures of a
+// stone decoded with DecodeCBOR). Blocks without a COSE signature for their
+// signed content are signed with the Signer the resolver returns for the
+// issuer and key id of their JWS signature, which must verify with the
+// Signer's public key. In format version 3, the COSE signatures are linked
+// to the COSE meta signature like JWS signatures are linked to the JWS meta
+// signature; links between other blocks are not supported. Owner signatures
+// and the ownership history are bound to the JWS signature of the ownership
+// block, so a stone that has them cannot be encoded with COSE signatures.
+// A stone decoded from COSE signatures has no JWS signatures and cannot be
+// converted back to the JSON form; see EncodeJSON.
+func (self *Stone) EncodeCBOR(signers SignerResolver) ([]byte, error) {
+
+	var envelope = make(map[string]interface{})
+	var cose = make(map[string][]byte)
+	var metaHash string
+
+	// blocks keep their JWS signatures unless they are to be COSE signed
+	useJWS := signers == nil && self.HasSignature("meta")
+	if !useJWS && (len(self.OwnerSignatures()) > 0 || len(self.OwnershipHistory()) > 0) {
+		return nil, errors.New("owner signatures and ownership history are bound to the JWS signatures and cannot be COSE signed. Encode without signers")
+	}
+
+	// the meta block comes first so other blocks link to its signature
+	for _, blockName := range BlockNames() {
+
+		if useJWS {
+			entry, err := self.jwsEntry(blockName)
+			if err != nil {
+				return nil, err
+			}
+			if entry != nil {
+				envelope[blockName] = entry
+			}
+			continue
+		}
+
+		sign1, err := self.coseSignature(blockName, signers, metaHash)
+		if err != nil {
+			return nil, err
+		}
+		if sign1 == nil {
+			continue
+		}
+
+		encoded, err := cborMarshal(*sign1)
+		if err != nil {
+			return nil, err
+		}
+		envelope[blockName] = *sign1
+		cose[blockName] = encoded
+		if blockName == "meta" {
+			metaHash = SignatureHash(string(encoded))
+		}
+	}
+
+	if envelope["meta"] == nil {
+		return nil, errors.New("`meta` block has no signature")
+	}
+
+	if history := self.OwnershipHistory(); len(history) > 0 {
+		var tokens []interface{}
+		for _, token := range history {
+			tokens = append(tokens, token)
+		}
+		envelope["ownership_history"] = tokens
+	}
+
+	if disclosures := self.disclosures(); len(disclosures) > 0 {
+		var encoded []interface{}
+		for _, d := range disclosures {
+			encoded = append(encoded, d)
+		}
+		envelope["disclosures"] = encoded
+	}
+
+	if owners := self.OwnerSignatures(); len(owners) > 0 {
+		var tokens = make(map[string]interface{})
+		for addressID, token := range owners {
+			tokens[addressID] = token
+		}
+		envelope["owners"] = tokens
+	}
+
+	if self.Version > 0 {
+		envelope["version"] = self.Version
+	}
+
+	data, err := cborMarshal(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	// keep the signatures so the stone can be encoded again without keys
+	if self.CoseSignatures == nil {
+		self.CoseSignatures = make(map[string][]byte)
+	}
+	for blockName, encoded := range cose {
+		self.CoseSignatures[blockName] = encoded
+	}
+
+	return data, nil
+}
+
+// Returns the CBOR form of the JWS signature of a block: the array of
+// its protected header, payload and signature bytes. Nil is returned
+// for unsigned blocks.
+func (self *Stone) jwsEntry(blockName string) ([]interface{}, error) {
+
+	if !self.HasSignature(blockName) {
+		if self.CoseSignatures[blockName] != nil {
+			return nil, errors.New(fmt.Sprintf("`%s` block only has a COSE signature and cannot be encoded with JWS signatures", blockName))
+		}
+		return nil, nil
+	}
+
+	jws, err := self.blockSignature(blockName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(jws.Signatures) > 1 {
+		return nil, errors.New(fmt.Sprintf("`%s` block is counter-signed and cannot be CBOR encoded", blockName))
+	}
+
+	var entry []interface{}
+	for _, part := range []string{ jws.Signatures[0].Protected, jws.Payload, jws.Signatures[0].Signature } {
+		decoded, err := b64Decode(part)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("`%s` block signature is malformed", blockName))
+		}
+		entry = append(entry, decoded)
+	}
+
+	return entry, nil
+}
+
+// Returns the compact JWS carried by the CBOR form of a JWS signature
+func parseJWSEntry(v interface{}) (string, error) {
+
+	var invalid = errors.New("invalid JWS structure")
+
+	parts, ok := v.([]interface{})
+	if !ok || len(parts) != 3 {
+		return "", invalid
+	}
+
+	var encoded []string
+	for _, part := range parts {
+		bs, ok := part.([]byte)
+		if !ok || len(bs) == 0 {
+			return "", invalid
+		}
+		encoded = append(encoded, b64Encode(bs))
+	}
+
+	return strings.Join(encoded, "."), nil
+}
+
+// Returns the COSE signature of a block, signing the block if it has
+// a JWS signature but no COSE signature over the same content. Nil is
+// returned for unsigned blocks. metaHash is the hash of the
+// COSE meta signature that other blocks are linked to.
+func (self *Stone) coseSignature(blockName string, signers SignerResolver, metaHash string) (*cborTag, error) {
+
+	var existing *coseSign1
+	var existingTag cborTag
+	if encoded, ok := self.CoseSignatures[blockName]; ok {
+		decoded, err := cborUnmarshal(encoded)
+		if err != nil {
+			return nil, err
+		}
+		if existing, err = parseCOSE(decoded); err != nil {
+			return nil, err
+		}
+		existingTag = decoded.(cborTag)
+	}
+
+	if !self.HasSignature(blockName) {
+		if existing == nil {
+			return nil, nil
+		}
+		return &existingTag, nil
+	}
+
+	jws, err := self.blockSignature(blockName)
+	if err != nil {
+		return nil, err
+	}
+
+	// a COSE_Sign1 message carries a single signature
+	if len(jws.Signatures) > 1 {
+		return nil, errors.New(fmt.Sprintf("`%s` block is counter-signed and cannot be CBOR encoded", blockName))
+	}
+
+	token := jws.token(0)
+
+	block, err := TokenToBlock(token, blockName)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := cborBlock(block)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := self.SignatureHeader(blockName)
+	if err != nil {
+		return nil, err
+	}
+
+	if header["links"] != nil {
+		return nil, errors.New(fmt.Sprintf("`%s` block is linked to other blocks and cannot be CBOR encoded", blockName))
+	}
+
+	var params []cborMapItem
+	var linked bool
+	if self.Version >= FormatVersion3 {
+		if blockName == "meta" {
+			linked = true
+			params = append(params, cborMapItem{ coseHeaderLinked, true })
+		} else if metaHash != "" {
+			params = append(params, cborMapItem{ coseHeaderMetaHash, metaHash })
+		}
+	}
+
+	// the COSE signature is reused if it signs the same block with the same links
+	if existing != nil && bytes.Equal(existing.payload, payload) && existing.linked == linked {
+		if blockName == "meta" || self.Version < FormatVersion3 || existing.metaHash == metaHash {
+			return &existingTag, nil
+		}
+	}
+
+	if signers == nil {
+		return nil, errors.New("signer resolver is required")
+	}
+
+	issuer, _ := header["iss"].(string)
+	keyID, _ := header["kid"].(string)
+	signer, err := signers.ResolveSigner(issuer, keyID)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to resolve signer for `%s` block: %s", blockName, err.Error()))
+	}
+	if signer == nil {
+		return nil, errors.New(fmt.Sprintf("unable to resolve signer for `%s` block", blockName))
+	}
+
+	if _, err := verifyJWS(token, signer.Public()); err != nil {
+		return nil, errors.New(fmt.Sprintf("`%s` block signature could not be verified with the signer's key", blockName))
+	}
+
+	sign1, err := signCOSE(WithIdentity(signer, issuer, keyID), payload, params...)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("failed to sign `%s` block", blockName))
+	}
+
+	return &sign1, nil
+}
+
+// Decode a CBOR encoded stone. The blocks are loaded from their JWS
+// signatures, which are kept in Signatures, or from their COSE signatures,
+// which are kept in CoseSignatures; a stone decoded from COSE signatures
+// has no JWS signatures except the ownership history, owner signatures
+// and disclosures. Signatures are not verified; see DecodeAndVerifyCBOR.
+func DecodeCBOR(data []byte) (*Stone, error) {
+
+	decoded, err := cborUnmarshal(data)
+	if err != nil {
+		return &Stone{}, errors.New("failed to decode token")
+	}
+
+	envelope, ok := decoded.(map[string]interface{})
+	if !ok {
+		return &Stone{}, errors.New("failed to parse token")
+	}
+
+	var stone = Empty()
+
+	version, ok := formatVersion(envelope["version"])
+	if !ok {
+		return &Stone{}, errors.New("format version is not supported")
+	}
+	stone.Version = version
+
+	// load the disclosures of selectively disclosable attributes
+	if envelope["disclosures"] != nil {
+		if !isStringSlice(envelope["disclosures"]) {
+			return &Stone{}, errors.New("malformed disclosures")
+		}
+		stone.Signatures["disclosures"] = envelope["disclosures"]
+	}
+
+	var hasJWS bool
+	for _, blockName := range BlockNames() {
+
+		if envelope[blockName] == nil {
+			continue
+		}
+
+		// a block carried with its JWS signature
+		if _, isCOSE := envelope[blockName].(cborTag); !isCOSE {
+
+			token, err := parseJWSEntry(envelope[blockName])
+			if err != nil {
+				return &Stone{}, errors.New(fmt.Sprintf("`%s` block signature is malformed", blockName))
+			}
+
+			block, err := TokenToBlock(token, blockName)
+			if err != nil {
+				return &Stone{}, err
+			}
+
+			if err := stone.setSignedBlock(blockName, block); err != nil {
+				return &Stone{}, err
+			}
+			stone.Signatures[blockName] = token
+			hasJWS = true
+			continue
+		}
+
+		sign1, err := parseCOSE(envelope[blockName])
+		if err != nil {
+			return &Stone{}, errors.New(fmt.Sprintf("`%s` block signature is malformed", blockName))
+		}
+
+		block, err := sign1.block(blockName)
+		if err != nil {
+			return &Stone{}, err
+		}
+
+		encoded, err := cborMarshal(envelope[blockName])
+		if err != nil {
+			return &Stone{}, err
+		}
+
+		if err := stone.setSignedBlock(blockName, block); err != nil {
+			return &Stone{}, err
+		}
+		stone.CoseSignatures[blockName] = encoded
+	}
+
+	// blocks are either all carried with JWS signatures or all with COSE signatures
+	if hasJWS && len(stone.CoseSignatures) > 0 {
+		return &Stone{}, errors.New("blocks must all have JWS signatures or all have COSE signatures")
+	}
+
+	// load previous ownership signatures
+	if envelope["ownership_history"] != nil {
+		if !isStringSlice(envelope["ownership_history"]) {
+			return &Stone{}, errors.New("malformed ownership history")
+		}
+		stone.Signatures["ownership_history"] = envelope["ownership_history"]
+	}
+
+	// load owner signatures
+	if envelope["owners"] != nil {
+		if !isStringMap(envelope["owners"]) {
+			return &Stone{}, errors.New("malformed owner signatures")
+		}
+		stone.Signatures["owners"] = envelope["owners"]
+	}
+
+	return stone, nil
+}
+
+// Decode a CBOR encoded stone, verify the JWS or COSE signature of every
+// block and validate the resulting stone. Public keys are obtained from the
+// resolver with the issuer and key id of each signature.
+func DecodeAndVerifyCBOR(data []byte, resolver PublicKeyResolver) (*Stone, error) {
+	return defaultValidator().DecodeAndVerifyCBOR(data, resolver)
+}
+
+// Decode, verify and validate a CBOR encoded stone according to the
+// validator's policy. See the package level DecodeAndVerifyCBOR.
+func (self *Validator) DecodeAndVerifyCBOR(data []byte, resolver PublicKeyResolver) (*Stone, error) {
+
+	if resolver == nil {
+		return &Stone{}, errors.New("key resolver is required")
+	}
+
+	stone, err := DecodeCBOR(data)
+	if err != nil {
+		return &Stone{}, err
+	}
+
+	// blocks carried with their JWS signatures are verified like Decode'd ones
+	if stone.HasSignature("meta") {
+		if err := stone.verifyBlocks(resolver); err != nil {
+			return &Stone{}, err
+		}
+	} else if err := stone.verifyCOSEBlocks(resolver); err != nil {
+		return &Stone{}, err
+	}
+
+	if err := self.Validate(stone.ToMap()); err != nil {
+		return &Stone{}, err
+	}
+
+	if err := self.checkRevocation(stone); err != nil {
+		return &Stone{}, err
+	}
+
+	return stone, nil
+}
+
+// Verify the COSE signature of every block and its link to the COSE meta signature
+func (self *Stone) verifyCOSEBlocks(resolver PublicKeyResolver) error {
+
+	if self.CoseSignatures["meta"] == nil {
+		return errors.New("`meta` block has no signature")
+	}
+
+	// the meta block comes first
+	var metaLinked bool
+	var metaHash string
+	for _, blockName := range BlockNames() {
+
+		encoded, ok := self.CoseSignatures[blockName]
+		if !ok {
+			continue
+		}
+
+		decoded, _ := cborUnmarshal(encoded)
+		sign1, _ := parseCOSE(decoded)
+		publicKey, err := resolver.ResolvePublicKey(sign1.iss, sign1.kid)
+		if err != nil {
+			return errors.New(fmt.Sprintf("unable to resolve key for `%s` block: %s", blockName, err.Error()))
+		}
+
+		if err := sign1.verify(publicKey); err != nil {
+			return errors.New(fmt.Sprintf("`%s` block signature could not be verified", blockName))
+		}
+
+		if blockName == "meta" {
+			metaLinked = sign1.linked
+			metaHash = SignatureHash(string(encoded))
+			continue
+		}
+
+		// blocks must be linked to the meta signature
+		if sign1.metaHash == "" && (self.Version >= FormatVersion3 || metaLinked) {
+			return errors.New(fmt.Sprintf("`%s` block signature is not linked to the `meta` signature", blockName))
+		}
+		if sign1.metaHash != "" && sign1.metaHash != metaHash {
+			return errors.New(fmt.Sprintf("`%s` block signature is linked to another `meta` signature", blockName))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package stone
+
+import (
+	gocrypto "crypto"
+	"errors"
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"github.com/ellcrys/util"
+)
+
+// ecStone returns a stone with meta, ownership and attributes blocks signed with an ES256 key
+func ecStone(t *testing.T, signer Signer) *Stone {
+	sh, err := CreateWith(map[string]interface{}{
+		"id": util.NewID(),
+		"type": "coupon",
+		"created_at": time.Now().Unix(),
+	}, signer)
+	assert.Nil(t, err)
+	assert.Nil(t, sh.AddOwnershipWith(map[string]interface{}{
+		"ref_id": sh.Meta["id"],
+		"type": "sole",
+		"sole": map[string]interface{}{ "address_id": "alice" },
+	}, signer))
+	assert.Nil(t, sh.AddAttributesWith(map[string]interface{}{
+		"ref_id": sh.Meta["id"],
+		"data": map[string]interface{}{ "discount": 0.15, "codes": []interface{}{ "A1", "B2" } },
+	}, signer))
+	return sh
+}
+
+// staticSigner returns a resolver that always returns the signer
+func staticSigner(signer Signer) SignerResolver {
+	return SignerResolverFunc(func(issuer, keyID string) (Signer, error) {
+		return signer, nil
+	})
+}
+
+// TestEncodeCBOR tests that a CBOR encoded stone decodes and verifies to the same blocks
+func TestEncodeCBOR(t *testing.T) {
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	sh := ecStone(t, signer)
+
+	data, err := sh.EncodeCBOR(staticSigner(signer))
+	assert.Nil(t, err)
+	assert.True(t, len(data) < len(sh.Encode()) / 2)
+
+	decStone, err := DecodeAndVerifyCBOR(data, PublicKeyResolverFunc(func(issuer, keyID string) (gocrypto.PublicKey, error) {
+		return signer.Public(), nil
+	}))
+	assert.Nil(t, err)
+	expected, _ := CanonicalJSON(sh.ToMap())
+	decStone.Signatures = sh.Signatures
+	actual, _ := CanonicalJSON(decStone.ToMap())
+	assert.Equal(t, string(expected), string(actual))
+}
+
+// TestEncodeCBORWithoutKeys tests that a decoded CBOR stone is encoded again to the same bytes without keys
+func TestEncodeCBORWithoutKeys(t *testing.T) {
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	data, err := ecStone(t, signer).EncodeCBOR(staticSigner(signer))
+	assert.Nil(t, err)
+
+	decStone, err := DecodeCBOR(data)
+	assert.Nil(t, err)
+	again, err := decStone.EncodeCBOR(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, data, again)
+}
+
+// TestEncodeCBORWrongSigner tests that blocks are only signed again with the key of their JWS signature
+func TestEncodeCBORWrongSigner(t *testing.T) {
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	otherSigner, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	sh := ecStone(t, signer)
+
+	_, err := sh.EncodeCBOR(staticSigner(otherSigner))
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block signature could not be verified with the signer's key", err.Error())
+
+	_, err = sh.EncodeCBOR(SignerResolverFunc(func(issuer, keyID string) (Signer, error) {
+		return nil, errors.New("key not found")
+	}))
+	assert.NotNil(t, err)
+	assert.Equal(t, "unable to resolve signer for `meta` block: key not found", err.Error())
+}
+
+// TestDecodeAndVerifyCBORWrongKey tests that a COSE signature is rejected with another key
+func TestDecodeAndVerifyCBORWrongKey(t *testing.T) {
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	data, err := ecStone(t, signer).EncodeCBOR(staticSigner(signer))
+	assert.Nil(t, err)
+
+	_, err = DecodeAndVerifyCBOR(data, PublicKeyResolverFunc(func(issuer, keyID string) (gocrypto.PublicKey, error) {
+		return ParsePublicKey(util.ReadFromFixtures("tests/fixtures/ec_p384_pub_1.txt"))
+	}))
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block signature could not be verified", err.Error())
+}
+
+// TestDecodeAndVerifyCBORTampered tests that a modified payload fails verification
+func TestDecodeAndVerifyCBORTampered(t *testing.T) {
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	data, err := ecStone(t, signer).EncodeCBOR(staticSigner(signer))
+	assert.Nil(t, err)
+
+	// "coupon" becomes "coupoN" in the meta payload
+	tampered := []byte(string(data))
+	for i := 0; i < len(tampered) - 6; i++ {
+		if string(tampered[i:i+6]) == "coupon" {
+			tampered[i+5] = 'N'
+		}
+	}
+	_, err = DecodeAndVerifyCBOR(tampered, PublicKeyResolverFunc(func(issuer, keyID string) (gocrypto.PublicKey, error) {
+		return signer.Public(), nil
+	}))
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block signature could not be verified", err.Error())
+}
+
+// TestEncodeCBORWithJWS tests that a stone encoded without signers keeps its JWS signatures
+func TestEncodeCBORWithJWS(t *testing.T) {
+	sh := NewGroupStone("joint", map[string]interface{}{})
+	assert.Nil(t, sh.SignAsOwner("alice", util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt")))
+	assert.Nil(t, sh.SignAsOwner("bob", util.ReadFromFixtures("tests/fixtures/ed25519_priv_1.txt")))
+	assert.Nil(t, sh.SignAsOwner("carol", util.ReadFromFixtures("tests/fixtures/rsa_priv_2.txt")))
+
+	data, err := sh.EncodeCBOR(nil)
+	assert.Nil(t, err)
+	assert.True(t, len(data) < len(sh.Encode()))
+
+	decStone, err := DecodeAndVerifyCBOR(data, PublicKeyResolverFunc(func(issuer, keyID string) (gocrypto.PublicKey, error) {
+		return ParsePublicKey(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt"))
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, sh.Encode(), decStone.Encode())
+	assert.Nil(t, decStone.VerifyOwnerSignatures(ownerKeys))
+
+	_, err = sh.EncodeCBOR(staticSigner(nil))
+	assert.NotNil(t, err)
+	assert.Equal(t, "owner signatures and ownership history are bound to the JWS signatures and cannot be COSE signed. Encode without signers", err.Error())
+}
+
+// TestCBORToJSONRoundTrip tests that a stone decoded from CBOR converts back to the JSON form only with JWS signatures
+func TestCBORToJSONRoundTrip(t *testing.T) {
+	sh := NewValidStone()
+	data, err := sh.EncodeCBOR(nil)
+	assert.Nil(t, err)
+	decStone, err := DecodeCBOR(data)
+	assert.Nil(t, err)
+	token, err := decStone.EncodeJSON()
+	assert.Nil(t, err)
+	assert.Equal(t, sh.Encode(), token)
+	jsonStone, err := Decode(token)
+	assert.Nil(t, err)
+	assert.Equal(t, sh.JSON(), jsonStone.JSON())
+
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	data, err = ecStone(t, signer).EncodeCBOR(staticSigner(signer))
+	assert.Nil(t, err)
+	decStone, err = DecodeCBOR(data)
+	assert.Nil(t, err)
+	_, err = decStone.EncodeJSON()
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block only has a COSE signature and cannot be encoded with JWS signatures", err.Error())
+}
+
+// TestEncodeCBORWithJWSTransfers tests that transfers can be verified on a stone decoded from CBOR
+func TestEncodeCBORWithJWSTransfers(t *testing.T) {
+	sh := NewOwnedStone()
+	assert.Nil(t, sh.Transfer("bob", util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt")))
+
+	data, err := sh.EncodeCBOR(nil)
+	assert.Nil(t, err)
+	decStone, err := DecodeCBOR(data)
+	assert.Nil(t, err)
+	assert.Nil(t, decStone.VerifyTransfers(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt"), ownerKeys))
+}
+
+// TestDecodeAndVerifyCBORWithJWSTampered tests that a modified JWS payload fails verification
+func TestDecodeAndVerifyCBORWithJWSTampered(t *testing.T) {
+	sh := NewValidStone()
+	data, err := sh.EncodeCBOR(nil)
+	assert.Nil(t, err)
+
+	tampered := []byte(string(data))
+	for i := 0; i < len(tampered) - 10; i++ {
+		if string(tampered[i:i+10]) == "some_stone" {
+			tampered[i] = 'S'
+		}
+	}
+	_, err = DecodeAndVerifyCBOR(tampered, PublicKeyResolverFunc(func(issuer, keyID string) (gocrypto.PublicKey, error) {
+		return ParsePublicKey(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt"))
+	}))
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block signature could not be verified", err.Error())
+}
+
+// TestDecodeCBORMixedSignatures tests that blocks carried with JWS and COSE signatures cannot be mixed
+func TestDecodeCBORMixedSignatures(t *testing.T) {
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	sh := ecStone(t, signer)
+	coseData, err := sh.EncodeCBOR(staticSigner(signer))
+	assert.Nil(t, err)
+	jwsData, err := sh.EncodeCBOR(nil)
+	assert.Nil(t, err)
+
+	envelope, _ := cborUnmarshal(coseData)
+	jwsEnvelope, _ := cborUnmarshal(jwsData)
+	envelope.(map[string]interface{})["attributes"] = jwsEnvelope.(map[string]interface{})["attributes"]
+	data, _ := cborMarshal(envelope)
+	_, err = DecodeCBOR(data)
+	assert.NotNil(t, err)
+	assert.Equal(t, "blocks must all have JWS signatures or all have COSE signatures", err.Error())
+}
@@ -0,0 +1,338 @@
+package stone
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"github.com/ellcrys/util"
+)
+
+// The hash algorithm of selective disclosure digests (`_sd_alg`)
+const SDAlgorithm = "sha-256"
+
+// disclosure is a decoded selective disclosure: a salted property of `attributes.data`
+type disclosure struct {
+	encoded string
+	salt    string
+	name    string
+	value   interface{}
+}
+
+// Returns the digest of an encoded disclosure as listed in `_sd`
+func disclosureDigest(encoded string) string {
+	h := sha256.Sum256([]byte(encoded))
+	return b64Encode(h[:])
+}
+
+// Create a disclosure of a property with a random salt. A disclosure is
+// the base64url encoded JSON array of the salt, the name and the value.
+func newDisclosure(name string, value interface{}) (string, error) {
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	disclosureJSON, err := json.Marshal([]interface{}{ b64Encode(salt), name, value })
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("`attributes.data.%s` cannot be serialized", name))
+	}
+
+	return b64Encode(disclosureJSON), nil
+}
+
+// Decode a disclosure
+func parseDisclosure(encoded string) (*disclosure, error) {
+
+	var malformed = errors.New("disclosure is malformed")
+
+	disclosureJSON, err := b64Decode(encoded)
+	if err != nil {
+		return nil, malformed
+	}
+
+	var parts []interface{}
+	decoder := json.NewDecoder(bytes.NewReader(disclosureJSON))
+	decoder.UseNumber()
+	if err := decoder.Decode(&parts); err != nil || len(parts) != 3 {
+		return nil, malformed
+	}
+
+	salt, _ := parts[0].(string)
+	name, _ := parts[1].(string)
+	if salt == "" || name == "" || name == "_sd" {
+		return nil, malformed
+	}
+
+	return &disclosure{ encoded: encoded, salt: salt, name: name, value: parts[2] }, nil
+}
+
+// Returns the encoded disclosures of the stone
+func (self *Stone) disclosures() []string {
+	var disclosures []string
+	switch d := self.Signatures["disclosures"].(type) {
+	case []string:
+		disclosures = append(disclosures, d...)
+	case []interface{}:
+		for _, encoded := range d {
+			if s, ok := encoded.(string); ok {
+				disclosures = append(disclosures, s)
+			}
+		}
+	}
+	return disclosures
+}
+
+// Returns the attributes block revealed by disclosures. The signed block
+// lists the digests of its selectively disclosable properties in
+// `attributes.data._sd`; each disclosure must match one of them and adds
+// its property to `data`. `_sd` and `_sd_alg` are removed. A block
+// without `_sd_alg` has no selectively disclosable properties and is
+// returned as is, even if its data has an `_sd` property.
+func discloseAttributes(block map[string]interface{}, disclosures []string) (map[string]interface{}, error) {
+
+	if block["_sd_alg"] == nil {
+		if len(disclosures) > 0 {
+			return nil, errors.New("`attributes` block has no selectively disclosable data")
+		}
+		return block, nil
+	}
+
+	if block["_sd_alg"] != SDAlgorithm {
+		return nil, errors.New("selective disclosure algorithm is not supported")
+	}
+
+	data, _ := block["data"].(map[string]interface{})
+	if data == nil || !isStringSlice(data["_sd"]) {
+		return nil, errors.New("`attributes.data._sd` value type is invalid. Expects an array of strings")
+	}
+
+	var digests []string
+	switch sd := data["_sd"].(type) {
+	case []string:
+		digests = sd
+	case []interface{}:
+		for _, digest := range sd {
+			digests = append(digests, digest.(string))
+		}
+	}
+
+	var disclosed = make(map[string]interface{})
+	for name, value := range data {
+		if name != "_sd" {
+			disclosed[name] = value
+		}
+	}
+
+	var seen []string
+	for _, encoded := range disclosures {
+
+		d, err := parseDisclosure(encoded)
+		if err != nil {
+			return nil, err
+		}
+
+		digest := disclosureDigest(encoded)
+		if !util.InStringSlice(digests, digest) || util.InStringSlice(seen, digest) {
+			return nil, errors.New(fmt.Sprintf("disclosure of `attributes.data.%s` does not match a digest of the signed block", d.name))
+		}
+		seen = append(seen, digest)
+
+		if _, ok := disclosed[d.name]; ok {
+			return nil, errors.New(fmt.Sprintf("`attributes.data.%s` is disclosed more than once", d.name))
+		}
+		disclosed[d.name] = d.value
+	}
+
+	var revealed = make(map[string]interface{})
+	for name, value := range block {
+		if name != "_sd_alg" {
+			revealed[name] = value
+		}
+	}
+	revealed["data"] = disclosed
+
+	return revealed, nil
+}
+
+// Sets a block from the block its signature signed. A signed attributes
+// block with selectively disclosable data is replaced by the block
+// the stone's disclosures reveal.
+func (self *Stone) setSignedBlock(blockName string, block map[string]interface{}) error {
+
+	if blockName == "attributes" {
+		revealed, err := discloseAttributes(block, self.disclosures())
+		if err != nil {
+			return err
+		}
+		block = revealed
+	}
+
+	self.setBlock(blockName, block)
+	return nil
+}
+
+// Set and sign the attributes block, making the named properties of
+// `attributes.data` selectively disclosable (SD-JWT style). The signed
+// block replaces each of them with the digest of a disclosure holding a
+// random salt, the name and the value; the disclosures are kept in the
+// `signatures` block. A holder can then reveal only some of the properties
+// to a verifier with Disclose. `data` must be a JSON object.
+func (self *Stone) AddDisclosableAttributes(attributes map[string]interface{}, disclosable []string, issuerPrivateKey string) error {
+
+	signer, err := parseSigner(issuerPrivateKey)
+	if err != nil {
+		return err
+	}
+
+	return self.AddDisclosableAttributesWith(attributes, disclosable, signer)
+}
+
+// Set and sign the attributes block with selectively disclosable data
+// using the issuer's signer. See AddDisclosableAttributes.
+func (self *Stone) AddDisclosableAttributesWith(attributes map[string]interface{}, disclosable []string, issuer Signer) error {
+
+	metaID, err := self.metaID()
+	if err != nil {
+		return err
+	}
+
+	// validate
+	if err := ValidateAttributesBlock(attributes, metaID); err != nil {
+		return err
+	}
+
+	if len(disclosable) == 0 {
+		return self.AddAttributesWith(attributes, issuer)
+	}
+
+	data, ok := attributes["data"].(map[string]interface{})
+	if !ok {
+		return errors.New("`attributes.data` must be a JSON object to be selectively disclosed")
+	}
+
+	// replace the disclosable properties with the digests of their disclosures
+	var signedData = make(map[string]interface{})
+	for name, value := range data {
+		signedData[name] = value
+	}
+
+	var disclosures []string
+	var digests []string
+	for _, name := range disclosable {
+		value, ok := signedData[name]
+		if !ok {
+			return errors.New(fmt.Sprintf("`attributes.data.%s` is not set", name))
+		}
+		encoded, err := newDisclosure(name, value)
+		if err != nil {
+			return err
+		}
+		delete(signedData, name)
+		disclosures = append(disclosures, encoded)
+		digests = append(digests, disclosureDigest(encoded))
+	}
+
+	// digests are sorted so their order does not reveal the properties
+	sort.Strings(digests)
+	sort.Strings(disclosures)
+	var sd []interface{}
+	for _, digest := range digests {
+		sd = append(sd, digest)
+	}
+	signedData["_sd"] = sd
+
+	var signed = make(map[string]interface{})
+	for name, value := range attributes {
+		signed[name] = value
+	}
+	signed["data"] = signedData
+	signed["_sd_alg"] = SDAlgorithm
+
+	// sign the block with digests, then keep the revealed block
+	prevAttributes := self.Attributes
+	self.Attributes = signed
+	if _, err := self.SignWith("attributes", issuer); err != nil {
+		self.Attributes = prevAttributes
+		return err
+	}
+
+	self.Attributes = attributes
+	self.Signatures["disclosures"] = disclosures
+
+	return nil
+}
+
+// Returns the names of the selectively disclosable attributes revealed
+// by the stone, in sorted order
+func (self *Stone) DisclosedAttributes() []string {
+	var names []string
+	for _, encoded := range self.disclosures() {
+		if d, err := parseDisclosure(encoded); err == nil {
+			names = append(names, d.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns a copy of the stone revealing only the named selectively
+// disclosable attributes. The disclosures of the other ones are dropped
+// and their properties removed from `attributes.data`; the signatures
+// remain valid. The stone itself is not changed.
+func (self *Stone) Disclose(names ...string) (*Stone, error) {
+
+	var kept []string
+	var available []string
+	for _, encoded := range self.disclosures() {
+		d, err := parseDisclosure(encoded)
+		if err != nil {
+			return &Stone{}, err
+		}
+		available = append(available, d.name)
+		if util.InStringSlice(names, d.name) {
+			kept = append(kept, encoded)
+		}
+	}
+
+	for _, name := range names {
+		if !util.InStringSlice(available, name) {
+			return &Stone{}, errors.New(fmt.Sprintf("`attributes.data.%s` is not a disclosed attribute", name))
+		}
+	}
+
+	token, err := self.SignatureToken("attributes")
+	if err != nil {
+		return &Stone{}, err
+	}
+
+	signed, err := TokenToBlock(token, "attributes")
+	if err != nil {
+		return &Stone{}, err
+	}
+
+	var stone = *self
+	stone.Signatures = make(map[string]interface{})
+	for name, signature := range self.Signatures {
+		stone.Signatures[name] = signature
+	}
+	delete(stone.Signatures, "disclosures")
+	if len(kept) > 0 {
+		stone.Signatures["disclosures"] = kept
+	}
+
+	stone.CoseSignatures = make(map[string][]byte)
+	for name, signature := range self.CoseSignatures {
+		stone.CoseSignatures[name] = signature
+	}
+
+	if err := stone.setSignedBlock("attributes", signed); err != nil {
+		return &Stone{}, err
+	}
+
+	return &stone, nil
+}
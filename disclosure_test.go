@@ -0,0 +1,171 @@
+package stone
+
+import (
+	gocrypto "crypto"
+	"encoding/json"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/ellcrys/util"
+)
+
+// disclosableStone returns a stone whose `name` and `age` attributes are selectively disclosable
+func disclosableStone(t *testing.T) *Stone {
+	sh := NewValidStone()
+	err := sh.AddDisclosableAttributes(map[string]interface{}{
+		"ref_id": sh.Meta["id"],
+		"data": map[string]interface{}{ "name": "alice", "age": 30, "country": "NG" },
+	}, []string{ "name", "age" }, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.Nil(t, err)
+	return sh
+}
+
+// TestAddDisclosableAttributes tests that the issuer's stone keeps all attributes and signs their digests
+func TestAddDisclosableAttributes(t *testing.T) {
+	sh := disclosableStone(t)
+	data := sh.Attributes["data"].(map[string]interface{})
+	assert.Equal(t, "alice", data["name"])
+	assert.Equal(t, "NG", data["country"])
+	assert.Equal(t, []string{ "age", "name" }, sh.DisclosedAttributes())
+	assert.Nil(t, sh.Verify("attributes", util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt")))
+
+	token, _ := sh.SignatureToken("attributes")
+	signed, _ := TokenToBlock(token, "attributes")
+	assert.Equal(t, SDAlgorithm, signed["_sd_alg"])
+	signedData := signed["data"].(map[string]interface{})
+	assert.Nil(t, signedData["name"])
+	assert.Equal(t, "NG", signedData["country"])
+	assert.Equal(t, 2, len(signedData["_sd"].([]interface{})))
+
+	err := sh.AddDisclosableAttributes(map[string]interface{}{
+		"ref_id": sh.Meta["id"],
+		"data": map[string]interface{}{ "name": "alice" },
+	}, []string{ "email" }, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.NotNil(t, err)
+	assert.Equal(t, "`attributes.data.email` is not set", err.Error())
+
+	err = sh.AddDisclosableAttributes(map[string]interface{}{ "ref_id": sh.Meta["id"], "data": "abc" }, []string{ "name" }, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.NotNil(t, err)
+	assert.Equal(t, "`attributes.data` must be a JSON object to be selectively disclosed", err.Error())
+}
+
+// TestDisclose tests that a holder can reveal a subset of the disclosable attributes to a verifier
+func TestDisclose(t *testing.T) {
+	sh := disclosableStone(t)
+
+	disclosed, err := sh.Disclose("age")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ "age", "name" }, sh.DisclosedAttributes())
+
+	decStone, err := DecodeAndVerify(disclosed.Encode(), staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ "age" }, decStone.DisclosedAttributes())
+	data := decStone.Attributes["data"].(map[string]interface{})
+	assert.Equal(t, json.Number("30"), data["age"])
+	assert.Equal(t, "NG", data["country"])
+	_, hasName := data["name"]
+	assert.False(t, hasName)
+	_, hasDigests := data["_sd"]
+	assert.False(t, hasDigests)
+
+	concealed, err := sh.Disclose()
+	assert.Nil(t, err)
+	decStone, err = DecodeAndVerify(concealed.Encode(), staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt")))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(decStone.DisclosedAttributes()))
+	assert.Equal(t, map[string]interface{}{ "country": "NG" }, decStone.Attributes["data"])
+
+	_, err = sh.Disclose("country")
+	assert.NotNil(t, err)
+	assert.Equal(t, "`attributes.data.country` is not a disclosed attribute", err.Error())
+}
+
+// TestForeignDisclosureIsRejected tests that disclosures not matching a signed digest are rejected
+func TestForeignDisclosureIsRejected(t *testing.T) {
+	sh := disclosableStone(t)
+	other := disclosableStone(t)
+
+	forged, _ := newDisclosure("age", 18)
+	sh.Signatures["disclosures"] = []string{ forged }
+	_, err := Decode(sh.Encode())
+	assert.NotNil(t, err)
+	assert.Equal(t, "disclosure of `attributes.data.age` does not match a digest of the signed block", err.Error())
+
+	for _, encoded := range other.disclosures() {
+		if d, _ := parseDisclosure(encoded); d.name == "age" {
+			sh.Signatures["disclosures"] = []string{ encoded }
+		}
+	}
+	_, err = Decode(sh.Encode())
+	assert.NotNil(t, err)
+	assert.Equal(t, "disclosure of `attributes.data.age` does not match a digest of the signed block", err.Error())
+
+	sh.Signatures["disclosures"] = []string{ "abc" }
+	_, err = Decode(sh.Encode())
+	assert.NotNil(t, err)
+	assert.Equal(t, "disclosure is malformed", err.Error())
+}
+
+// TestDisclosedAttributesMustMatchSignature tests that changing a disclosed attribute is detected
+func TestDisclosedAttributesMustMatchSignature(t *testing.T) {
+	sh := disclosableStone(t)
+	sh.Attributes["data"].(map[string]interface{})["name"] = "bob"
+	err := sh.VerifyPolicy("attributes", staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt")), SignaturePolicy{})
+	assert.NotNil(t, err)
+	assert.Equal(t, "`attributes` block does not match its signature", err.Error())
+}
+
+// TestSignAttributesDropsDisclosures tests that signing the attributes block again drops its disclosures
+func TestSignAttributesDropsDisclosures(t *testing.T) {
+	sh := disclosableStone(t)
+	assert.Nil(t, sh.AddAttributes(map[string]interface{}{ "ref_id": sh.Meta["id"], "data": "abc" }, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt")))
+	assert.Nil(t, sh.Signatures["disclosures"])
+	_, err := DecodeAndVerify(sh.Encode(), staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt")))
+	assert.Nil(t, err)
+}
+
+// TestAttributesWithSDPropertyAreNotDisclosable tests that an `_sd` data property is ordinary data without `_sd_alg`
+func TestAttributesWithSDPropertyAreNotDisclosable(t *testing.T) {
+	sh := NewValidStone()
+	assert.Nil(t, sh.AddAttributes(map[string]interface{}{
+		"ref_id": sh.Meta["id"],
+		"data": map[string]interface{}{ "_sd": "abc", "name": "alice" },
+	}, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt")))
+
+	decStone, err := DecodeAndVerify(sh.Encode(), staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt")))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{ "_sd": "abc", "name": "alice" }, decStone.Attributes["data"])
+	assert.Equal(t, 0, len(decStone.DisclosedAttributes()))
+}
+
+// TestDisclosedStoneRoundTrip tests that disclosures survive JSON and CBOR encoding
+func TestDisclosedStoneRoundTrip(t *testing.T) {
+	sh := disclosableStone(t)
+	disclosed, err := sh.Disclose("name")
+	assert.Nil(t, err)
+
+	loaded, err := LoadJSON(disclosed.JSON())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ "name" }, loaded.DisclosedAttributes())
+	assert.Equal(t, "alice", loaded.Attributes["data"].(map[string]interface{})["name"])
+
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	data, err := disclosed.EncodeCBOR(staticSigner(signer))
+	assert.Nil(t, err)
+	decStone, err := DecodeAndVerifyCBOR(data, PublicKeyResolverFunc(func(issuer, keyID string) (gocrypto.PublicKey, error) {
+		return signer.Public(), nil
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ "name" }, decStone.DisclosedAttributes())
+	_, hasAge := decStone.Attributes["data"].(map[string]interface{})["age"]
+	assert.False(t, hasAge)
+}
+
+// TestValidateDisclosures tests that disclosures must be an array of strings
+func TestValidateDisclosures(t *testing.T) {
+	sh := disclosableStone(t)
+	assert.Nil(t, ValidateSignaturesBlock(sh.Signatures))
+	sh.Signatures["disclosures"] = "abc"
+	err := ValidateSignaturesBlock(sh.Signatures)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`signatures.disclosures` value type is invalid. Expects an array of strings", err.Error())
+}
@@ -0,0 +1,143 @@
+package stone
+
+import (
+	gocrypto "crypto"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The embed depth VerifyDeep allows when no maximum is given
+const DefaultMaxEmbedDepth = 8
+
+// EmbedError is returned by VerifyDeep when an embedded stone fails
+// verification. EmbedPath holds the index of the embed at each
+// level of nesting, outermost first.
+type EmbedError struct {
+	EmbedPath []int
+	Err       error
+}
+
+// Returns the error message
+func (self *EmbedError) Error() string {
+	var path []string
+	for _, index := range self.EmbedPath {
+		path = append(path, fmt.Sprint(index))
+	}
+	return fmt.Sprintf("unable to verify embed at path %s. Reason: %s", strings.Join(path, "/"), self.Err.Error())
+}
+
+// Returns the reason
+func (self *EmbedError) Unwrap() error {
+	return self.Err
+}
+
+// Verify the signatures of the stone and of every stone embedded in it,
+// at any depth. The resolver is called with the `iss` and `kid` of each
+// signature and must return the PEM encoded public key to verify it with.
+// Every signed block must match its signature and every stone must be
+// valid. Embeds may be nested up to maxDepth levels (DefaultMaxEmbedDepth
+// if maxDepth is not positive); a stone embedding a stone with its own
+// `meta.id` or that of one of its ancestors is rejected as a cycle.
+// Failures of embedded stones are reported as *EmbedError. Stones are
+// validated by the default Validator; see Validator.VerifyDeep.
+func (self *Stone) VerifyDeep(resolver KeyResolver, maxDepth int) error {
+	return defaultValidator().VerifyDeep(self, resolver, maxDepth)
+}
+
+// Verify the stone and its embedded stones using a resolver that returns
+// public key values. See VerifyDeep.
+func (self *Stone) VerifyDeepWith(resolver PublicKeyResolver, maxDepth int) error {
+	return defaultValidator().VerifyDeepWith(self, resolver, maxDepth)
+}
+
+// Verify a stone and its embedded stones. Like Stone.VerifyDeep, but every
+// stone is validated with the validator's policy (clock, clock skew and
+// schemas) and rejected if it is in the validator's revocation list.
+func (self *Validator) VerifyDeep(stone *Stone, resolver KeyResolver, maxDepth int) error {
+
+	if resolver == nil {
+		return errors.New("key resolver is required")
+	}
+
+	return self.VerifyDeepWith(stone, PublicKeyResolverFunc(func(issuer, keyID string) (gocrypto.PublicKey, error) {
+		publicKey, err := resolver.ResolveKey(issuer, keyID)
+		if err != nil {
+			return nil, err
+		}
+		return parsePublicKey(publicKey)
+	}), maxDepth)
+}
+
+// Verify a stone and its embedded stones using a resolver that returns
+// public key values. See Validator.VerifyDeep.
+func (self *Validator) VerifyDeepWith(stone *Stone, resolver PublicKeyResolver, maxDepth int) error {
+
+	if resolver == nil {
+		return errors.New("key resolver is required")
+	}
+
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxEmbedDepth
+	}
+
+	return self.verifyDeep(stone, resolver, maxDepth, nil, make(map[string]bool))
+}
+
+// Verify a stone found at the given embed path and, recursively, its
+// embeds. Ancestors holds the meta ids of the stones embedding it.
+func (self *Validator) verifyDeep(stone *Stone, resolver PublicKeyResolver, maxDepth int, path []int, ancestors map[string]bool) error {
+
+	fail := func(err error) error {
+		if len(path) == 0 {
+			return err
+		}
+		return &EmbedError{ EmbedPath: append([]int{}, path...), Err: err }
+	}
+
+	if err := stone.verifyBlocks(resolver); err != nil {
+		return fail(err)
+	}
+
+	if err := self.Validate(stone.JSON()); err != nil {
+		return fail(err)
+	}
+
+	if err := self.checkRevocation(stone); err != nil {
+		return fail(err)
+	}
+
+	metaID := stone.Meta["id"].(string)
+	if ancestors[metaID] {
+		return fail(errors.New(fmt.Sprintf("embed cycle: stone `%s` embeds itself", metaID)))
+	}
+
+	if !stone.HasEmbeds() {
+		return nil
+	}
+
+	if len(path) >= maxDepth {
+		return fail(errors.New(fmt.Sprintf("embeds are nested deeper than %d levels", maxDepth)))
+	}
+
+	embeds, err := stone.EmbedsBlock()
+	if err != nil {
+		return fail(err)
+	}
+
+	stones, err := embeds.Stones()
+	if err != nil {
+		return fail(err)
+	}
+
+	ancestors[metaID] = true
+	defer delete(ancestors, metaID)
+
+	for i, embed := range stones {
+		if err := self.verifyDeep(embed, resolver, maxDepth, append(path, i), ancestors); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
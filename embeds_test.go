@@ -0,0 +1,142 @@
+package stone
+
+import (
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"github.com/ellcrys/util"
+)
+
+// embedStones embeds the given stones in a stone and signs the embeds block
+func embedStones(t *testing.T, sh *Stone, embeds ...*Stone) {
+	var data []interface{}
+	for _, embed := range embeds {
+		m, err := util.JSONToMap(embed.JSON())
+		assert.Nil(t, err)
+		data = append(data, m)
+	}
+	err := sh.AddEmbed(map[string]interface{}{ "ref_id": sh.Meta["id"], "data": data }, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.Nil(t, err)
+}
+
+// TestVerifyDeep tests that a stone and its nested embeds are verified
+func TestVerifyDeep(t *testing.T) {
+	child := NewValidStone()
+	embedStones(t, child, NewValidStone())
+	sh := NewValidStone()
+	embedStones(t, sh, NewValidStone(), child)
+	err := sh.VerifyDeep(staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt")), 0)
+	assert.Nil(t, err)
+}
+
+// TestVerifyDeepReportsEmbedPath tests that a nested embed signed by an unexpected key is reported with its path
+func TestVerifyDeepReportsEmbedPath(t *testing.T) {
+	grandChild := NewValidStone()
+	grandChild.Sign("meta", util.ReadFromFixtures("tests/fixtures/rsa_priv_2.txt"))
+	child := NewValidStone()
+	embedStones(t, child, NewValidStone(), grandChild)
+	sh := NewValidStone()
+	embedStones(t, sh, child)
+	err := sh.VerifyDeep(staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt")), 0)
+	assert.NotNil(t, err)
+	embedErr, ok := err.(*EmbedError)
+	assert.True(t, ok)
+	assert.Equal(t, []int{ 0, 1 }, embedErr.EmbedPath)
+	assert.Equal(t, "unable to verify embed at path 0/1. Reason: `meta` block signature could not be verified", err.Error())
+}
+
+// TestVerifyDeepUnsignedEmbedBlock tests that an embed with an unsigned block is rejected
+func TestVerifyDeepUnsignedEmbedBlock(t *testing.T) {
+	child := NewValidStone()
+	child.Attributes = map[string]interface{}{ "ref_id": child.Meta["id"], "data": map[string]interface{}{ "amount": 1000000 } }
+	sh := NewValidStone()
+	embedStones(t, sh, child)
+
+	err := sh.VerifyDeep(staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt")), 0)
+	assert.NotNil(t, err)
+	assert.Equal(t, "unable to verify embed at path 0. Reason: `attributes` block has no signature", err.Error())
+}
+
+// TestVerifyDeepTamperedEmbed tests that an embed whose block differs from its signed block is rejected
+func TestVerifyDeepTamperedEmbed(t *testing.T) {
+	child := NewValidStone()
+	child.Meta["type"] = "forged"
+	sh := NewValidStone()
+	embedStones(t, sh, child)
+	err := sh.VerifyDeep(staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt")), 0)
+	assert.NotNil(t, err)
+	assert.Equal(t, "unable to verify embed at path 0. Reason: `meta` block does not match its signature", err.Error())
+
+	// changing the embed after the embeds block is signed breaks the embeds signature
+	sh.Embeds["data"].([]interface{})[0].(map[string]interface{})["meta"].(map[string]interface{})["type"] = "some_stone"
+	err = sh.VerifyDeep(staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt")), 0)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`embeds` block does not match its signature", err.Error())
+}
+
+// TestVerifyDeepMaxDepth tests that embeds nested deeper than the maximum depth are rejected
+func TestVerifyDeepMaxDepth(t *testing.T) {
+	child := NewValidStone()
+	embedStones(t, child, NewValidStone())
+	sh := NewValidStone()
+	embedStones(t, sh, child)
+	resolver := staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt"))
+	assert.Nil(t, sh.VerifyDeep(resolver, 2))
+	err := sh.VerifyDeep(resolver, 1)
+	assert.NotNil(t, err)
+	assert.Equal(t, "unable to verify embed at path 0. Reason: embeds are nested deeper than 1 levels", err.Error())
+}
+
+// TestVerifyDeepCycle tests that an embed reusing the id of an ancestor is rejected
+func TestVerifyDeepCycle(t *testing.T) {
+	sh := NewValidStone()
+	child, _ := Create(map[string]interface{}{
+		"id": sh.Meta["id"],
+		"type": "some_stone",
+		"created_at": sh.Meta["created_at"],
+	}, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	embedStones(t, sh, child)
+	err := sh.VerifyDeep(staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt")), 0)
+	assert.NotNil(t, err)
+	assert.Equal(t, "unable to verify embed at path 0. Reason: embed cycle: stone `"+sh.Meta["id"].(string)+"` embeds itself", err.Error())
+}
+
+// TestVerifyDeepRequiresResolver tests that a resolver is required
+func TestVerifyDeepRequiresResolver(t *testing.T) {
+	err := NewValidStone().VerifyDeep(nil, 0)
+	assert.NotNil(t, err)
+	assert.Equal(t, "key resolver is required", err.Error())
+}
+
+// TestValidatorVerifyDeepRevokedEmbed tests that a revoked embedded stone is rejected
+func TestValidatorVerifyDeepRevokedEmbed(t *testing.T) {
+	child := NewValidStone()
+	sh := NewValidStone()
+	embedStones(t, sh, NewValidStone(), child)
+	resolver := staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt"))
+
+	validator := NewValidator()
+	validator.Revocations = NewMemoryRevocationList(child.Meta["id"].(string))
+	err := validator.VerifyDeep(sh, resolver, 0)
+	assert.NotNil(t, err)
+	embedErr, ok := err.(*EmbedError)
+	assert.True(t, ok)
+	assert.Equal(t, []int{ 1 }, embedErr.EmbedPath)
+	assert.Equal(t, CodeRevoked, embedErr.Err.(*ValidationError).Code)
+
+	validator.Revocations = NewMemoryRevocationList(sh.Meta["id"].(string))
+	err = validator.VerifyDeep(sh, resolver, 0)
+	assert.NotNil(t, err)
+	assert.Equal(t, CodeRevoked, err.(*ValidationError).Code)
+}
+
+// TestValidatorVerifyDeepUsesClock tests that embedded stones are validated with the validator's clock
+func TestValidatorVerifyDeepUsesClock(t *testing.T) {
+	sh := NewValidStone()
+	embedStones(t, sh, NewValidStone())
+	past := time.Now().Add(-time.Hour)
+	validator := &Validator{ StartTime: START_TIME, Clock: func() time.Time { return past } }
+	err := validator.VerifyDeep(sh, staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt")), 0)
+	assert.NotNil(t, err)
+	assert.Equal(t, CodeCreatedAtInFuture, err.(*ValidationError).Code)
+}
@@ -0,0 +1,261 @@
+package stone
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"github.com/ellcrys/util"
+)
+
+// Signature algorithms
+const (
+	RS256 = "RS256" // RSASSA-PKCS-v1.5 using SHA-256
+	ES256 = "ES256" // ECDSA using P-256 and SHA-256
+	ES384 = "ES384" // ECDSA using P-384 and SHA-384
+	EdDSA = "EdDSA" // Ed25519
+)
+
+// The signature algorithms blocks can be signed and verified with.
+// A JWS whose `alg` header is not in this list is rejected.
+var AllowedAlgorithms = []string{ RS256, ES256, ES384, EdDSA }
+
+// jsonWebKey is the public key embedded in the protected header
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// jwsHeader is the protected header of a block signature. Linked,
+// MetaHash and Links bind the signature to the stone (see linkHeader).
+type jwsHeader struct {
+	Alg      string            `json:"alg"`
+	Jwk      *jsonWebKey       `json:"jwk,omitempty"`
+	Kid      string            `json:"kid,omitempty"`
+	Iss      string            `json:"iss,omitempty"`
+	Linked   bool              `json:"linked,omitempty"`
+	MetaHash string            `json:"meta_hash,omitempty"`
+	Links    map[string]string `json:"links,omitempty"`
+}
+
+func b64Encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func b64Decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// Returns the signature algorithm for a public key.
+// RSA keys use RS256, P-256 and P-384 keys use ES256 and ES384
+// respectively and Ed25519 keys use EdDSA.
+func algorithmForKey(publicKey crypto.PublicKey) (string, error) {
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		return RS256, nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return ES256, nil
+		case elliptic.P384():
+			return ES384, nil
+		}
+		return "", fmt.Errorf("unsupported elliptic curve %s", k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return EdDSA, nil
+	default:
+		return "", fmt.Errorf("unsupported key type %T", publicKey)
+	}
+}
+
+// Returns the JWK representation of a public key
+func toJSONWebKey(publicKey crypto.PublicKey) (*jsonWebKey, error) {
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		e := big.NewInt(int64(k.E)).Bytes()
+		return &jsonWebKey{ Kty: "RSA", N: b64Encode(k.N.Bytes()), E: b64Encode(e) }, nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return &jsonWebKey{
+			Kty: "EC",
+			Crv: k.Curve.Params().Name,
+			X: b64Encode(k.X.FillBytes(make([]byte, size))),
+			Y: b64Encode(k.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case ed25519.PublicKey:
+		return &jsonWebKey{ Kty: "OKP", Crv: "Ed25519", X: b64Encode(k) }, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", publicKey)
+	}
+}
+
+// Returns the RFC 7638 JWK thumbprint (SHA-256, base64url encoded) of a
+// public key. It is used as the default `kid` header of block signatures.
+func Thumbprint(publicKey crypto.PublicKey) (string, error) {
+
+	jwk, err := toJSONWebKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	// required members only, in lexicographic order
+	var input string
+	switch jwk.Kty {
+	case "RSA":
+		input = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk.E, jwk.N)
+	case "EC":
+		input = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, jwk.Crv, jwk.X, jwk.Y)
+	case "OKP":
+		input = fmt.Sprintf(`{"crv":"%s","kty":"OKP","x":"%s"}`, jwk.Crv, jwk.X)
+	}
+
+	h := crypto.SHA256.New()
+	h.Write([]byte(input))
+	return b64Encode(h.Sum(nil)), nil
+}
+
+// Returns the hash function used by an algorithm.
+// EdDSA hashes internally and returns zero.
+func algorithmHash(alg string) crypto.Hash {
+	switch alg {
+	case RS256, ES256:
+		return crypto.SHA256
+	case ES384:
+		return crypto.SHA384
+	}
+	return crypto.Hash(0)
+}
+
+// Sign a payload and return a compact serialized JWS. The protected header
+// carries the signer's key id (its thumbprint unless the signer is an
+// IdentifiedSigner with its own key id) and, if set, its issuer.
+func signJWS(signer Signer, payload []byte) (string, error) {
+	return signJWSHeader(signer, payload, jwsHeader{})
+}
+
+// Sign a payload like signJWS, keeping the other protected
+// header parameters set in header
+func signJWSHeader(signer Signer, payload []byte, header jwsHeader) (string, error) {
+
+	alg := signer.Algorithm()
+	if !util.InStringSlice(AllowedAlgorithms, alg) {
+		return "", fmt.Errorf("algorithm %s is not allowed", alg)
+	}
+
+	jwk, err := toJSONWebKey(signer.Public())
+	if err != nil {
+		return "", err
+	}
+
+	header.Alg, header.Jwk, header.Kid, header.Iss = alg, jwk, "", ""
+	if identified, ok := signer.(IdentifiedSigner); ok {
+		header.Kid = identified.KeyID()
+		header.Iss = identified.Issuer()
+	}
+	if header.Kid == "" {
+		if header.Kid, err = Thumbprint(signer.Public()); err != nil {
+			return "", err
+		}
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := b64Encode(headerJSON) + "." + b64Encode(payload)
+	sig, err := signer.SignInput([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + b64Encode(sig), nil
+}
+
+// Verify a compact serialized JWS with a public key and return its payload.
+// The `alg` header must be allowed and must match the type of the key.
+func verifyJWS(token string, publicKey crypto.PublicKey) ([]byte, error) {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid signature")
+	}
+
+	headerJSON, err := b64Decode(parts[0])
+	if err != nil {
+		return nil, errors.New("invalid signature")
+	}
+
+	var header jwsHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, errors.New("invalid signature")
+	}
+
+	if !util.InStringSlice(AllowedAlgorithms, header.Alg) {
+		return nil, fmt.Errorf("algorithm %q is not allowed", header.Alg)
+	}
+
+	keyAlg, err := algorithmForKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if keyAlg != header.Alg {
+		return nil, fmt.Errorf("algorithm %q does not match key", header.Alg)
+	}
+
+	payload, err := b64Decode(parts[1])
+	if err != nil {
+		return nil, errors.New("invalid signature")
+	}
+
+	sig, err := b64Decode(parts[2])
+	if err != nil {
+		return nil, errors.New("invalid signature")
+	}
+
+	if !verifySignature(header.Alg, publicKey, []byte(parts[0] + "." + parts[1]), sig) {
+		return nil, errors.New("failed to verify signature")
+	}
+
+	return payload, nil
+}
+
+// Verify a raw signature over a signing input. The algorithm
+// must already have been checked against the key type.
+func verifySignature(alg string, publicKey crypto.PublicKey, signingInput, sig []byte) bool {
+
+	var digest []byte
+	if hash := algorithmHash(alg); hash != 0 {
+		h := hash.New()
+		h.Write(signingInput)
+		digest = h.Sum(nil)
+	}
+
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, sig) == nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(k, digest, r, s)
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, signingInput, sig)
+	}
+
+	return false
+}
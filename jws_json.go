@@ -0,0 +1,378 @@
+package stone
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"strings"
+	"github.com/ellcrys/util"
+)
+
+// jwsSignature is a signature of a JWS in JSON serialization: its
+// protected header, optional unprotected header and signature
+type jwsSignature struct {
+	Protected string
+	Header    map[string]interface{}
+	Signature string
+}
+
+// generalJWS is a JWS in general JSON serialization (RFC 7515, section 7.2.1).
+// A compact JWS is a general JWS with a single signature and no
+// unprotected header.
+type generalJWS struct {
+	Payload    string
+	Signatures []jwsSignature
+}
+
+// A SignaturePolicy states which signatures a block in JWS JSON
+// serialization must carry. Signers are identified by the `kid` and
+// `iss` of the protected header of their signature.
+type SignaturePolicy struct {
+
+	// Key ids that must each have a valid signature.
+	KeyIDs []string
+
+	// Issuers that must each have a valid signature.
+	Issuers []string
+
+	// The minimum number of distinct keys with a valid signature.
+	// Zero means one.
+	Threshold int
+}
+
+// Parses a block signature: a compact JWS string or a JWS in
+// general JSON serialization as decoded from JSON
+func parseBlockSignature(v interface{}) (*generalJWS, error) {
+
+	switch sig := v.(type) {
+	case string:
+		parts := strings.Split(sig, ".")
+		if len(parts) != 3 {
+			return nil, errors.New("parameter is not a valid token")
+		}
+		return &generalJWS{ Payload: parts[1], Signatures: []jwsSignature{ { Protected: parts[0], Signature: parts[2] } } }, nil
+	case map[string]interface{}:
+		return parseGeneralJWS(sig)
+	}
+
+	return nil, errors.New("expects a string or a JSON object")
+}
+
+// Parses a JWS in general JSON serialization. Every signature must have
+// a protected header; unprotected header parameters must not also be
+// in the protected header.
+func parseGeneralJWS(data map[string]interface{}) (*generalJWS, error) {
+
+	for _, member := range sortedKeys(data) {
+		if !util.InStringSlice([]string{ "payload", "signatures" }, member) {
+			return nil, errors.New(fmt.Sprintf("`%s` member is unexpected", member))
+		}
+	}
+
+	payload, ok := data["payload"].(string)
+	if !ok || payload == "" {
+		return nil, errors.New("`payload` member must be a non-empty string")
+	}
+
+	signatures, ok := data["signatures"].([]interface{})
+	if !ok || len(signatures) == 0 {
+		return nil, errors.New("`signatures` member must be a non-empty array")
+	}
+
+	var jws = &generalJWS{ Payload: payload }
+	for i, s := range signatures {
+
+		entry, ok := s.(map[string]interface{})
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("signature %d must be a JSON object", i))
+		}
+
+		for _, member := range sortedKeys(entry) {
+			if !util.InStringSlice([]string{ "protected", "header", "signature" }, member) {
+				return nil, errors.New(fmt.Sprintf("`%s` member of signature %d is unexpected", member, i))
+			}
+		}
+
+		var sig jwsSignature
+		sig.Protected, _ = entry["protected"].(string)
+		sig.Signature, _ = entry["signature"].(string)
+		if sig.Protected == "" || sig.Signature == "" {
+			return nil, errors.New(fmt.Sprintf("signature %d must have `protected` and `signature` strings", i))
+		}
+
+		protected, err := tokenHeader(sig.Protected + "." + payload + "." + sig.Signature)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("protected header of signature %d is malformed", i))
+		}
+
+		if entry["header"] != nil {
+			header, ok := entry["header"].(map[string]interface{})
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("`header` member of signature %d must be a JSON object", i))
+			}
+			for name, _ := range header {
+				if _, ok := protected[name]; ok {
+					return nil, errors.New(fmt.Sprintf("`%s` header parameter of signature %d is also protected", name, i))
+				}
+			}
+			sig.Header = header
+		}
+
+		jws.Signatures = append(jws.Signatures, sig)
+	}
+
+	return jws, nil
+}
+
+// Returns the compact serialization of a signature
+func (self *generalJWS) token(i int) string {
+	return self.Signatures[i].Protected + "." + self.Payload + "." + self.Signatures[i].Signature
+}
+
+// Returns the value stored in the signatures block: the compact
+// serialization if possible, the general JSON serialization otherwise
+func (self *generalJWS) value() interface{} {
+
+	if len(self.Signatures) == 1 && len(self.Signatures[0].Header) == 0 {
+		return self.token(0)
+	}
+
+	var signatures []interface{}
+	for _, sig := range self.Signatures {
+		entry := map[string]interface{}{ "protected": sig.Protected, "signature": sig.Signature }
+		if len(sig.Header) > 0 {
+			entry["header"] = sig.Header
+		}
+		signatures = append(signatures, entry)
+	}
+
+	return map[string]interface{}{ "payload": self.Payload, "signatures": signatures }
+}
+
+// Returns the parsed signature of a block
+func (self *Stone) blockSignature(blockName string) (*generalJWS, error) {
+
+	if !self.HasSignature(blockName) {
+		return nil, errors.New("`"+blockName+"` block has no signature")
+	}
+
+	jws, err := parseBlockSignature(self.Signatures[blockName])
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("`%s` block signature is malformed", blockName))
+	}
+
+	return jws, nil
+}
+
+// Returns the compact JWS of a block's first signature. It is the
+// block's only signature unless the block has been counter-signed.
+func (self *Stone) SignatureToken(blockName string) (string, error) {
+
+	jws, err := self.blockSignature(blockName)
+	if err != nil {
+		return "", err
+	}
+
+	return jws.token(0), nil
+}
+
+// Returns the header of each signature of a block, in order. A header
+// is the union of the protected header and, for counter-signatures,
+// the unprotected header.
+func (self *Stone) SignatureHeaders(blockName string) ([]map[string]interface{}, error) {
+
+	jws, err := self.blockSignature(blockName)
+	if err != nil {
+		return nil, err
+	}
+
+	var headers []map[string]interface{}
+	for i, sig := range jws.Signatures {
+		header, err := tokenHeader(jws.token(i))
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("`%s` block signature header is malformed", blockName))
+		}
+		for name, value := range sig.Header {
+			header[name] = value
+		}
+		headers = append(headers, header)
+	}
+
+	return headers, nil
+}
+
+// Add a signature to a block without replacing its existing signatures,
+// for instance to have an auditor or notary counter-sign the issuer's
+// signature. The block is then stored in JWS general JSON serialization
+// (RFC 7515) with one entry per signature; all entries sign the same payload.
+// The optional header is set as the unprotected header of the new signature
+// and must not repeat a protected header parameter. Signing the block again
+// with Sign replaces all of its signatures.
+func (self *Stone) Countersign(blockName string, privateKey string, header map[string]interface{}) error {
+
+	signer, err := parseSigner(privateKey)
+	if err != nil {
+		return err
+	}
+
+	return self.CountersignWith(blockName, signer, header)
+}
+
+// Counter-sign a block using a Signer. See Countersign.
+func (self *Stone) CountersignWith(blockName string, signer Signer, header map[string]interface{}) error {
+
+	if signer == nil {
+		return errors.New("signer is required")
+	}
+
+	if !isBlockName(blockName) {
+		return errors.New("block unknown")
+	}
+
+	jws, err := self.blockSignature(blockName)
+	if err != nil {
+		return err
+	}
+
+	// only the block that was signed can be counter-signed
+	if err := self.checkSignedBlock(blockName, jws.token(0)); err != nil {
+		return err
+	}
+
+	payload, err := b64Decode(jws.Payload)
+	if err != nil {
+		return errors.New("invalid " + blockName + " token")
+	}
+
+	link, err := self.linkHeader(blockName, nil)
+	if err != nil {
+		return err
+	}
+
+	token, err := signJWSHeader(signer, payload, link)
+	if err != nil {
+		return errors.New("failed to sign block")
+	}
+
+	parts := strings.Split(token, ".")
+	sig := jwsSignature{ Protected: parts[0], Signature: parts[2] }
+
+	if len(header) > 0 {
+		if _, err := CanonicalJSON(header); err != nil {
+			return errors.New("unprotected header is not valid JSON")
+		}
+		protected, _ := tokenHeader(token)
+		sig.Header = make(map[string]interface{})
+		for name, value := range header {
+			if _, ok := protected[name]; ok {
+				return errors.New(fmt.Sprintf("`%s` header parameter is already protected", name))
+			}
+			sig.Header[name] = value
+		}
+	}
+
+	jws.Signatures = append(jws.Signatures, sig)
+	self.Signatures[blockName] = jws.value()
+	return nil
+}
+
+// Verify the signatures of a block against a policy. The public key of
+// each signature is obtained from the resolver with the `iss` and `kid` of
+// its protected header. Signatures whose key cannot be resolved do not
+// count towards the policy; a signature that fails verification with its
+// resolved key or is not linked to the stone (see VerifyLinks) is an error.
+// The block must match its signatures.
+func (self *Stone) VerifyPolicy(blockName string, resolver KeyResolver, policy SignaturePolicy) error {
+
+	if resolver == nil {
+		return errors.New("key resolver is required")
+	}
+
+	return self.VerifyPolicyWith(blockName, PublicKeyResolverFunc(func(issuer, keyID string) (crypto.PublicKey, error) {
+		publicKey, err := resolver.ResolveKey(issuer, keyID)
+		if err != nil {
+			return nil, err
+		}
+		return parsePublicKey(publicKey)
+	}), policy)
+}
+
+// Verify the signatures of a block against a policy using a resolver
+// that returns public key values. See VerifyPolicy.
+func (self *Stone) VerifyPolicyWith(blockName string, resolver PublicKeyResolver, policy SignaturePolicy) error {
+
+	if resolver == nil {
+		return errors.New("key resolver is required")
+	}
+
+	if !isBlockName(blockName) {
+		return errors.New("block unknown")
+	}
+
+	jws, err := self.blockSignature(blockName)
+	if err != nil {
+		return err
+	}
+
+	if err := self.checkSignedBlock(blockName, jws.token(0)); err != nil {
+		return err
+	}
+
+	var keyIDs, issuers, keys []string
+	for i, _ := range jws.Signatures {
+
+		token := jws.token(i)
+		header, err := tokenHeader(token)
+		if err != nil {
+			return errors.New(fmt.Sprintf("`%s` block signature header is malformed", blockName))
+		}
+
+		issuer, _ := header["iss"].(string)
+		keyID, _ := header["kid"].(string)
+		publicKey, err := resolver.ResolvePublicKey(issuer, keyID)
+		if err != nil || publicKey == nil {
+			continue
+		}
+
+		if _, err := verifyJWS(token, publicKey); err != nil {
+			return errors.New(fmt.Sprintf("`%s` block signature %d could not be verified", blockName, i))
+		}
+
+		if err := self.checkLink(blockName, token); err != nil {
+			return err
+		}
+
+		thumbprint, err := Thumbprint(publicKey)
+		if err != nil {
+			return err
+		}
+
+		keyIDs = append(keyIDs, keyID)
+		issuers = append(issuers, issuer)
+		if !util.InStringSlice(keys, thumbprint) {
+			keys = append(keys, thumbprint)
+		}
+	}
+
+	for _, keyID := range policy.KeyIDs {
+		if !util.InStringSlice(keyIDs, keyID) {
+			return errors.New(fmt.Sprintf("`%s` block is not signed by key `%s`", blockName, keyID))
+		}
+	}
+
+	for _, issuer := range policy.Issuers {
+		if !util.InStringSlice(issuers, issuer) {
+			return errors.New(fmt.Sprintf("`%s` block is not signed by issuer `%s`", blockName, issuer))
+		}
+	}
+
+	threshold := policy.Threshold
+	if threshold < 1 {
+		threshold = 1
+	}
+	if len(keys) < threshold {
+		return errors.New(fmt.Sprintf("`%s` block has %d valid signatures, %d required", blockName, len(keys), threshold))
+	}
+
+	return nil
+}
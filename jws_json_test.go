@@ -0,0 +1,167 @@
+package stone
+
+import (
+	"errors"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/ellcrys/util"
+)
+
+// counterSignedStone returns a stone whose meta block is signed by an
+// issuer (RSA, key `issuer-key`) and counter-signed by an auditor (P-256, key `auditor-key`)
+func counterSignedStone(t *testing.T) *Stone {
+	issuer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	auditor, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	sh := NewValidStone()
+	_, err := sh.SignWith("meta", WithIdentity(issuer, "issuer", "issuer-key"))
+	assert.Nil(t, err)
+	err = sh.CountersignWith("meta", WithIdentity(auditor, "auditor", "auditor-key"), map[string]interface{}{ "role": "auditor" })
+	assert.Nil(t, err)
+	return sh
+}
+
+// kidResolver resolves the fixture keys of counterSignedStone by key id
+func kidResolver() KeyResolver {
+	var keys = map[string]string{
+		"issuer-key": util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt"),
+		"auditor-key": util.ReadFromFixtures("tests/fixtures/ec_p256_pub_1.txt"),
+	}
+	return KeyResolverFunc(func(issuer, keyID string) (string, error) {
+		if key, ok := keys[keyID]; ok {
+			return key, nil
+		}
+		return "", errors.New("unknown key")
+	})
+}
+
+// TestCountersign tests that a counter-signature is added next to the issuer's signature
+func TestCountersign(t *testing.T) {
+	sh := counterSignedStone(t)
+	_, ok := sh.Signatures["meta"].(map[string]interface{})
+	assert.True(t, ok)
+	assert.Nil(t, sh.Verify("meta", util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt")))
+	assert.Nil(t, sh.Verify("meta", util.ReadFromFixtures("tests/fixtures/ec_p256_pub_1.txt")))
+	err := sh.Verify("meta", util.ReadFromFixtures("tests/fixtures/rsa_pub_2.txt"))
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block signature could not be verified", err.Error())
+
+	header, err := sh.SignatureHeader("meta")
+	assert.Nil(t, err)
+	assert.Equal(t, "issuer-key", header["kid"])
+
+	headers, err := sh.SignatureHeaders("meta")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(headers))
+	assert.Equal(t, "auditor", headers[1]["iss"])
+	assert.Equal(t, "auditor", headers[1]["role"])
+	assert.Nil(t, headers[0]["role"])
+}
+
+// TestCountersignErrors tests that only a signed, unmodified block can be counter-signed
+// and that the unprotected header cannot repeat protected parameters
+func TestCountersignErrors(t *testing.T) {
+	auditor := util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt")
+
+	sh := NewValidStone()
+	err := sh.Countersign("attributes", auditor, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`attributes` block has no signature", err.Error())
+
+	err = sh.Countersign("meta", auditor, map[string]interface{}{ "kid": "other" })
+	assert.NotNil(t, err)
+	assert.Equal(t, "`kid` header parameter is already protected", err.Error())
+
+	sh.Meta["type"] = "other"
+	err = sh.Countersign("meta", auditor, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block does not match its signature", err.Error())
+}
+
+// TestSignReplacesCounterSignatures tests that signing a block again drops its counter-signatures
+func TestSignReplacesCounterSignatures(t *testing.T) {
+	sh := counterSignedStone(t)
+	_, err := sh.Sign("meta", util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.Nil(t, err)
+	assert.True(t, util.IsStringValue(sh.Signatures["meta"]))
+	assert.NotNil(t, sh.Verify("meta", util.ReadFromFixtures("tests/fixtures/ec_p256_pub_1.txt")))
+}
+
+// TestCounterSignedStoneRoundTrip tests that counter-signed blocks survive encoding and loading
+func TestCounterSignedStoneRoundTrip(t *testing.T) {
+	sh := counterSignedStone(t)
+
+	decStone, err := DecodeAndVerify(sh.Encode(), kidResolver())
+	assert.Nil(t, err)
+	assert.Nil(t, decStone.VerifyPolicy("meta", kidResolver(), SignaturePolicy{ Threshold: 2 }))
+
+	loaded, err := LoadJSON(sh.JSON())
+	assert.Nil(t, err)
+	assert.Nil(t, loaded.VerifyPolicy("meta", kidResolver(), SignaturePolicy{ KeyIDs: []string{ "auditor-key" } }))
+}
+
+// TestVerifyPolicy tests that signature policies require the named signers and a threshold of keys
+func TestVerifyPolicy(t *testing.T) {
+	sh := counterSignedStone(t)
+
+	assert.Nil(t, sh.VerifyPolicy("meta", kidResolver(), SignaturePolicy{}))
+	assert.Nil(t, sh.VerifyPolicy("meta", kidResolver(), SignaturePolicy{ Issuers: []string{ "issuer", "auditor" }, Threshold: 2 }))
+
+	err := sh.VerifyPolicy("meta", kidResolver(), SignaturePolicy{ Issuers: []string{ "notary" } })
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block is not signed by issuer `notary`", err.Error())
+
+	err = sh.VerifyPolicy("meta", kidResolver(), SignaturePolicy{ KeyIDs: []string{ "notary-key" } })
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block is not signed by key `notary-key`", err.Error())
+
+	err = sh.VerifyPolicy("meta", kidResolver(), SignaturePolicy{ Threshold: 3 })
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block has 2 valid signatures, 3 required", err.Error())
+
+	// signatures of unknown keys do not count
+	issuerOnly := staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt"))
+	err = sh.VerifyPolicy("meta", KeyResolverFunc(func(issuer, keyID string) (string, error) {
+		if keyID != "issuer-key" {
+			return "", errors.New("unknown key")
+		}
+		return issuerOnly.ResolveKey(issuer, keyID)
+	}), SignaturePolicy{ KeyIDs: []string{ "auditor-key" } })
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block is not signed by key `auditor-key`", err.Error())
+}
+
+// TestVerifyPolicyInvalidSignature tests that a counter-signature that does not verify is rejected
+func TestVerifyPolicyInvalidSignature(t *testing.T) {
+	sh := counterSignedStone(t)
+	jws, _ := parseBlockSignature(sh.Signatures["meta"])
+	jws.Signatures[1].Signature = jws.Signatures[0].Signature
+	sh.Signatures["meta"] = jws.value()
+	err := sh.VerifyPolicy("meta", kidResolver(), SignaturePolicy{})
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block signature 1 could not be verified", err.Error())
+}
+
+// TestValidateGeneralJWSSignature tests that malformed JWS JSON serializations are rejected
+func TestValidateGeneralJWSSignature(t *testing.T) {
+	sh := counterSignedStone(t)
+	assert.Nil(t, ValidateSignaturesBlock(sh.Signatures))
+
+	sh.Signatures["meta"] = map[string]interface{}{ "payload": "e30" }
+	err := ValidateSignaturesBlock(sh.Signatures)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`signatures.meta` is not a valid JWS JSON serialization: `signatures` member must be a non-empty array", err.Error())
+
+	sh.Signatures["meta"] = 10
+	err = ValidateSignaturesBlock(sh.Signatures)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`signatures.meta` value type is invalid. Expects a string", err.Error())
+	assert.Equal(t, CodeInvalidType, err.(*ValidationError).Code)
+}
+
+// TestCounterSignedBlockCannotBeCBOREncoded tests that CBOR encoding rejects counter-signed blocks
+func TestCounterSignedBlockCannotBeCBOREncoded(t *testing.T) {
+	sh := counterSignedStone(t)
+	_, err := sh.EncodeCBOR(nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block is counter-signed and cannot be CBOR encoded", err.Error())
+}
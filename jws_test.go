@@ -0,0 +1,131 @@
+package stone
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/ellcrys/crypto"
+	"github.com/ellcrys/util"
+)
+
+// TestSignAndVerifyWithSupportedAlgorithms tests that blocks can be signed and verified
+// with RSA, ECDSA and Ed25519 keys and that the algorithm is chosen from the key type
+func TestSignAndVerifyWithSupportedAlgorithms(t *testing.T) {
+	var keys = []struct{ priv, pub, alg string }{
+		{ "tests/fixtures/rsa_priv_1.txt", "tests/fixtures/rsa_pub_1.txt", RS256 },
+		{ "tests/fixtures/ec_p256_priv_1.txt", "tests/fixtures/ec_p256_pub_1.txt", ES256 },
+		{ "tests/fixtures/ec_p384_priv_1.txt", "tests/fixtures/ec_p384_pub_1.txt", ES384 },
+		{ "tests/fixtures/ed25519_priv_1.txt", "tests/fixtures/ed25519_pub_1.txt", EdDSA },
+	}
+	for _, k := range keys {
+		sh := NewValidStone()
+		signature, err := sh.Sign("meta", util.ReadFromFixtures(k.priv))
+		assert.Nil(t, err)
+		header, err := tokenHeader(signature)
+		assert.Nil(t, err)
+		assert.Equal(t, k.alg, header["alg"])
+		assert.Nil(t, sh.Verify("meta", util.ReadFromFixtures(k.pub)))
+	}
+}
+
+// TestVerifyWithMismatchedKeyType tests that a signature cannot be verified with a key of another type
+func TestVerifyWithMismatchedKeyType(t *testing.T) {
+	sh := NewValidStone()
+	_, err := sh.Sign("meta", util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	assert.Nil(t, err)
+	err = sh.Verify("meta", util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt"))
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block signature could not be verified", err.Error())
+	err = sh.Verify("meta", util.ReadFromFixtures("tests/fixtures/ec_p384_pub_1.txt"))
+	assert.NotNil(t, err)
+}
+
+// TestVerifyRejectsAlgorithmNotAllowed tests that a JWS declaring an algorithm outside
+// the allow-list is rejected even if the signature itself is valid
+func TestVerifyRejectsAlgorithmNotAllowed(t *testing.T) {
+	sh := NewValidStone()
+	signature := sh.Signatures["meta"].(string)
+	parts := strings.Split(signature, ".")
+	parts[0] = crypto.ToBase64Raw([]byte(`{"alg":"none"}`))
+	sh.Signatures["meta"] = strings.Join(parts, ".")
+	err := sh.Verify("meta", util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt"))
+	assert.NotNil(t, err)
+
+	sh = NewValidStone()
+	defer func(algs []string) { AllowedAlgorithms = algs }(AllowedAlgorithms)
+	AllowedAlgorithms = []string{ ES256 }
+	_, err = sh.Sign("meta", util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.NotNil(t, err)
+	assert.Equal(t, "failed to sign block", err.Error())
+}
+
+// TestTamperedECDSASignature tests that a modified ECDSA signed block fails verification
+func TestTamperedECDSASignature(t *testing.T) {
+	sh := NewValidStone()
+	_, err := sh.Sign("meta", util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	assert.Nil(t, err)
+	parts := strings.Split(sh.Signatures["meta"].(string), ".")
+	parts[1] = crypto.ToBase64Raw([]byte(`{"id":"tampered"}`))
+	sh.Signatures["meta"] = strings.Join(parts, ".")
+	err = sh.Verify("meta", util.ReadFromFixtures("tests/fixtures/ec_p256_pub_1.txt"))
+	assert.NotNil(t, err)
+}
+
+// TestSignatureHeaderHasThumbprintKeyID tests that block signatures carry the
+// RFC 7638 thumbprint of the signing key as `kid` and no issuer by default
+func TestSignatureHeaderHasThumbprintKeyID(t *testing.T) {
+	sh := NewValidStone()
+	header, err := sh.SignatureHeader("meta")
+	assert.Nil(t, err)
+	assert.Equal(t, RS256, header["alg"])
+	assert.Equal(t, "G9FpV3gj5S2EwZ105NZ6FK_-7Br0KX8iwmvaTF5xOtE", header["kid"])
+	assert.Nil(t, header["iss"])
+}
+
+// TestSignatureHeaderWithIdentity tests that a signer's issuer and key id are set in the header
+func TestSignatureHeaderWithIdentity(t *testing.T) {
+	key, err := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/ed25519_priv_1.txt"))
+	assert.Nil(t, err)
+	sh := NewValidStone()
+	_, err = sh.SignWith("meta", WithIdentity(key, "issuer-1", "key-2016"))
+	assert.Nil(t, err)
+	header, err := sh.SignatureHeader("meta")
+	assert.Nil(t, err)
+	assert.Equal(t, "issuer-1", header["iss"])
+	assert.Equal(t, "key-2016", header["kid"])
+
+	_, err = sh.SignWith("meta", WithIdentity(key, "issuer-1", ""))
+	assert.Nil(t, err)
+	header, _ = sh.SignatureHeader("meta")
+	thumbprint, _ := Thumbprint(key.Public())
+	assert.Equal(t, thumbprint, header["kid"])
+}
+
+// TestSignatureHeaderOfUnsignedBlock tests that reading the header of an unsigned block fails
+func TestSignatureHeaderOfUnsignedBlock(t *testing.T) {
+	sh := NewValidStone()
+	_, err := sh.SignatureHeader("ownership")
+	assert.NotNil(t, err)
+	assert.Equal(t, "`ownership` block has no signature", err.Error())
+}
+
+// TestDecodeAndVerifyResolvesByKeyID tests that the key resolver receives the issuer and key id
+func TestDecodeAndVerifyResolvesByKeyID(t *testing.T) {
+	key, err := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	assert.Nil(t, err)
+	sh := NewValidStone()
+	_, err = sh.SignWith("meta", WithIdentity(key, "issuer-1", "key-2016"))
+	assert.Nil(t, err)
+	keyring := map[string]string{
+		"issuer-1/key-2016": util.ReadFromFixtures("tests/fixtures/ec_p256_pub_1.txt"),
+	}
+	resolver := KeyResolverFunc(func(issuer, keyID string) (string, error) {
+		if k, ok := keyring[issuer+"/"+keyID]; ok {
+			return k, nil
+		}
+		return "", errors.New("unknown key")
+	})
+	_, err = DecodeAndVerify(sh.Encode(), resolver)
+	assert.Nil(t, err)
+}
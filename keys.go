@@ -0,0 +1,79 @@
+package stone
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Parse a PEM encoded private key. RSA (PKCS1), EC (SEC1) and
+// PKCS8 encoded RSA, ECDSA and Ed25519 keys are supported.
+func parsePrivateKey(privateKey string) (crypto.Signer, error) {
+
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil {
+		return nil, errors.New("no key found or passed in")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			return k, nil
+		case *ecdsa.PrivateKey:
+			return k, nil
+		case ed25519.PrivateKey:
+			return k, nil
+		default:
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", block.Type)
+	}
+}
+
+// Parse a PEM encoded public key. PKIX encoded RSA, ECDSA and Ed25519
+// keys and PKCS1 encoded RSA keys are supported.
+func parsePublicKey(publicKey string) (crypto.PublicKey, error) {
+
+	block, _ := pem.Decode([]byte(publicKey))
+	if block == nil {
+		return nil, errors.New("no key found or passed in")
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY", "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			if rsaKey, rsaErr := x509.ParsePKCS1PublicKey(block.Bytes); rsaErr == nil {
+				return rsaKey, nil
+			}
+			return nil, err
+		}
+		switch k := key.(type) {
+		case *rsa.PublicKey:
+			return k, nil
+		case *ecdsa.PublicKey:
+			return k, nil
+		case ed25519.PublicKey:
+			return k, nil
+		default:
+			return nil, fmt.Errorf("unsupported public key type %T", key)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", block.Type)
+	}
+}
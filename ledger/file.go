@@ -0,0 +1,92 @@
+package ledger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"github.com/stonedoc/stone"
+)
+
+// entry is a line of a ledger file. It records the
+// new links of an accepted stone and its owners.
+type entry struct {
+	ID     string   `json:"id"`
+	Links  []string `json:"links"`
+	Owners []string `json:"owners"`
+}
+
+// FileLedger is a Ledger keeping its records in an append-only file.
+// Each accepted stone appends a line that is synced before Accept
+// returns. A file must be used by one FileLedger at a time.
+type FileLedger struct {
+	mu      sync.RWMutex
+	file    *os.File
+	records records
+}
+
+// Open the ledger of a file, creating the file if needed.
+// The records are loaded from the file.
+func OpenFileLedger(path string) (*FileLedger, error) {
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	ledger := &FileLedger{ file: file, records: make(records) }
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1 << 20)
+	for line := 1; scanner.Scan(); line++ {
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			file.Close()
+			return nil, errors.New(fmt.Sprintf("ledger line %d is malformed", line))
+		}
+		ledger.records.add(e.ID, e.Links, e.Owners)
+	}
+
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return ledger, nil
+}
+
+// Accept the ownership of a stone
+func (self *FileLedger) Accept(s *stone.Stone) error {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	id, links, owners, err := self.records.check(s)
+	if err != nil {
+		return err
+	}
+
+	line, _ := json.Marshal(&entry{ ID: id, Links: links, Owners: owners })
+	if _, err := self.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := self.file.Sync(); err != nil {
+		return err
+	}
+
+	self.records.add(id, links, owners)
+	return nil
+}
+
+// Returns the current owners of a stone
+func (self *FileLedger) Owners(id string) ([]string, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.records.owners(id)
+}
+
+// Close the ledger file
+func (self *FileLedger) Close() error {
+	return self.file.Close()
+}
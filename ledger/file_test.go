@@ -0,0 +1,52 @@
+package ledger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFileLedger tests the file ledger
+func TestFileLedger(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "ledger")
+	defer os.RemoveAll(dir)
+	ledger, err := OpenFileLedger(filepath.Join(dir, "ledger"))
+	assert.Nil(t, err)
+	defer ledger.Close()
+	testLedger(t, ledger)
+}
+
+// TestFileLedgerReopen tests that the records survive reopening the ledger
+func TestFileLedgerReopen(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "ledger")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ledger")
+
+	ledger, _ := OpenFileLedger(path)
+	s := newOwnedStone(t)
+	toBob := transferCopy(t, s, "bob")
+	assert.Nil(t, ledger.Accept(s))
+	assert.Nil(t, ledger.Accept(toBob))
+	ledger.Close()
+
+	ledger, err := OpenFileLedger(path)
+	assert.Nil(t, err)
+	defer ledger.Close()
+	owners, err := ledger.Owners(s.Meta["id"].(string))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ "bob" }, owners)
+	assert.Equal(t, ErrDoubleSpend, ledger.Accept(transferCopy(t, s, "carol")))
+}
+
+// TestFileLedgerWithMalformedFile tests that a malformed ledger file is reported
+func TestFileLedgerWithMalformedFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "ledger")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ledger")
+	ioutil.WriteFile(path, []byte("{}\nnot json\n"), 0600)
+	_, err := OpenFileLedger(path)
+	assert.NotNil(t, err)
+	assert.Equal(t, "ledger line 2 is malformed", err.Error())
+}
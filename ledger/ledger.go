@@ -0,0 +1,140 @@
+// Package ledger detects double spending of stones. A ledger records
+// the ownership signatures it accepts for each stone (`meta.id`) and
+// only accepts a stone whose ownership chain extends the recorded one.
+package ledger
+
+import (
+	"errors"
+	"github.com/stonedoc/stone"
+)
+
+var (
+	// Returned when the ledger has no record of a stone
+	ErrNotFound = errors.New("stone not recorded")
+
+	// Returned when the stone's ownership is the recorded one
+	ErrAlreadyAccepted = errors.New("ownership already accepted")
+
+	// Returned when the stone's ownership is older than the recorded one
+	ErrStale = errors.New("ownership is older than the recorded ownership")
+
+	// Returned when the stone's ownership was transferred from a state
+	// that has already been transferred to someone else
+	ErrDoubleSpend = errors.New("ownership conflicts with the recorded ownership")
+)
+
+// A Ledger records the accepted ownership of stones.
+// Implementations are safe for concurrent use.
+type Ledger interface {
+
+	// Accept the ownership of a stone. The first stone of an id is accepted
+	// as is; a later one must extend the recorded ownership chain with new
+	// transfers. Signatures are not verified by the ledger; verify the
+	// stone (e.g with VerifyTransfers) before accepting it.
+	Accept(s *stone.Stone) error
+
+	// Returns the address ids of the current owners of a stone
+	Owners(id string) ([]string, error)
+}
+
+// record is the accepted ownership of a stone
+type record struct {
+	chain  []string
+	owners []string
+}
+
+// Returns the id, ownership chain (signature hashes, oldest first)
+// and current owners of a stone
+func ownershipChain(s *stone.Stone) (string, []string, []string, error) {
+
+	id, ok := s.Meta["id"].(string)
+	if !ok {
+		return "", nil, nil, errors.New("meta.id is not set")
+	}
+
+	if !s.HasSignature("ownership") {
+		return "", nil, nil, errors.New("`ownership` block has no signature")
+	}
+
+	token, err := s.SignatureToken("ownership")
+	if err != nil {
+		return "", nil, nil, err
+	}
+	ownership, err := stone.TokenToBlock(token, "ownership")
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	var chain []string
+	for _, t := range append(s.OwnershipHistory(), token) {
+		chain = append(chain, stone.SignatureHash(t))
+	}
+
+	return id, chain, stone.OwnerAddressIDs(ownership), nil
+}
+
+// Compare an ownership chain with the recorded one. Returns the
+// links of the chain that extend the recorded chain.
+func (self *record) extend(chain []string) ([]string, error) {
+
+	for i, hash := range self.chain {
+		if i == len(chain) {
+			return nil, ErrStale
+		}
+		if chain[i] != hash {
+			return nil, ErrDoubleSpend
+		}
+	}
+
+	if len(chain) == len(self.chain) {
+		return nil, ErrAlreadyAccepted
+	}
+
+	return chain[len(self.chain):], nil
+}
+
+// records holds the records of a ledger
+type records map[string]*record
+
+// Check a stone against the records. Returns its id, the new links
+// of its ownership chain and its owners.
+func (self records) check(s *stone.Stone) (string, []string, []string, error) {
+
+	id, chain, owners, err := ownershipChain(s)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	rec, ok := self[id]
+	if !ok {
+		return id, chain, owners, nil
+	}
+
+	links, err := rec.extend(chain)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	return id, links, owners, nil
+}
+
+// Add new links to the record of a stone
+func (self records) add(id string, links []string, owners []string) {
+	rec, ok := self[id]
+	if !ok {
+		rec = &record{}
+		self[id] = rec
+	}
+	rec.chain = append(rec.chain, links...)
+	rec.owners = owners
+}
+
+// Returns the owners of a stone
+func (self records) owners(id string) ([]string, error) {
+	rec, ok := self[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]string{}, rec.owners...), nil
+}
+
@@ -0,0 +1,90 @@
+package ledger
+
+import (
+	"testing"
+	"time"
+	"github.com/ellcrys/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stonedoc/stone"
+)
+
+var issuerPrivKey = util.ReadFromFixtures("../tests/fixtures/rsa_priv_1.txt")
+var alicePrivKey = util.ReadFromFixtures("../tests/fixtures/ec_p256_priv_1.txt")
+
+// Create a stone owned by alice
+func newOwnedStone(t *testing.T) *stone.Stone {
+	s, err := stone.Create(map[string]interface{}{
+		"id": util.NewID(),
+		"type": "coupon",
+		"created_at": time.Now().Unix(),
+	}, issuerPrivKey)
+	assert.Nil(t, err)
+	err = s.AddOwnership(map[string]interface{}{
+		"ref_id": s.Meta["id"],
+		"type": "sole",
+		"sole": map[string]interface{}{ "address_id": "alice" },
+	}, issuerPrivKey)
+	assert.Nil(t, err)
+	return s
+}
+
+// Returns a copy of a stone transferred by alice to a new owner
+func transferCopy(t *testing.T, s *stone.Stone, newOwner string) *stone.Stone {
+	c := s.Clone()
+	assert.Nil(t, c.Transfer(newOwner, alicePrivKey))
+	return c
+}
+
+// testLedger runs the tests every Ledger implementation must pass
+func testLedger(t *testing.T, ledger Ledger) {
+
+	s := newOwnedStone(t)
+	id := s.Meta["id"].(string)
+
+	_, err := ledger.Owners(id)
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.Nil(t, ledger.Accept(s))
+	owners, err := ledger.Owners(id)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ "alice" }, owners)
+	assert.Equal(t, ErrAlreadyAccepted, ledger.Accept(s))
+
+	toBob := transferCopy(t, s, "bob")
+	toCarol := transferCopy(t, s, "carol")
+
+	assert.Nil(t, ledger.Accept(toBob))
+	owners, _ = ledger.Owners(id)
+	assert.Equal(t, []string{ "bob" }, owners)
+
+	// alice already transferred the stone to bob
+	assert.Equal(t, ErrDoubleSpend, ledger.Accept(toCarol))
+	assert.Equal(t, ErrStale, ledger.Accept(s))
+	owners, _ = ledger.Owners(id)
+	assert.Equal(t, []string{ "bob" }, owners)
+}
+
+// TestAcceptWithoutOwnership tests that a stone without a signed ownership block is rejected
+func TestAcceptWithoutOwnership(t *testing.T) {
+	s, _ := stone.Create(map[string]interface{}{
+		"id": util.NewID(),
+		"type": "coupon",
+		"created_at": time.Now().Unix(),
+	}, issuerPrivKey)
+	err := NewMemoryLedger().Accept(s)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`ownership` block has no signature", err.Error())
+}
+
+// TestAcceptSeveralTransfersAtOnce tests that a stone transferred several times since it was recorded is accepted
+func TestAcceptSeveralTransfersAtOnce(t *testing.T) {
+	ledger := NewMemoryLedger()
+	s := newOwnedStone(t)
+	assert.Nil(t, ledger.Accept(s))
+
+	c := transferCopy(t, s, "alice")
+	assert.Nil(t, c.Transfer("bob", alicePrivKey))
+	assert.Nil(t, ledger.Accept(c))
+	owners, _ := ledger.Owners(s.Meta["id"].(string))
+	assert.Equal(t, []string{ "bob" }, owners)
+}
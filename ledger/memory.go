@@ -0,0 +1,36 @@
+package ledger
+
+import (
+	"sync"
+	"github.com/stonedoc/stone"
+)
+
+// MemoryLedger is a Ledger keeping its records in memory
+type MemoryLedger struct {
+	mu      sync.RWMutex
+	records records
+}
+
+// Create an empty MemoryLedger
+func NewMemoryLedger() *MemoryLedger {
+	return &MemoryLedger{ records: make(records) }
+}
+
+// Accept the ownership of a stone
+func (self *MemoryLedger) Accept(s *stone.Stone) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	id, links, owners, err := self.records.check(s)
+	if err != nil {
+		return err
+	}
+	self.records.add(id, links, owners)
+	return nil
+}
+
+// Returns the current owners of a stone
+func (self *MemoryLedger) Owners(id string) ([]string, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.records.owners(id)
+}
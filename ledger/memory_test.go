@@ -0,0 +1,10 @@
+package ledger
+
+import (
+	"testing"
+)
+
+// TestMemoryLedger tests the in-memory ledger
+func TestMemoryLedger(t *testing.T) {
+	testLedger(t, NewMemoryLedger())
+}
@@ -0,0 +1,141 @@
+package stone
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Checks whether the blocks of the stone must be linked to its meta
+// signature: in format version 3 and whenever the meta signature is
+// marked `linked`, so that a stone cannot be downgraded to skip the check
+func (self *Stone) linkedStone() bool {
+
+	if self.Version >= FormatVersion3 {
+		return true
+	}
+
+	header, err := self.SignatureHeader("meta")
+	if err != nil {
+		return false
+	}
+
+	linked, _ := header["linked"].(bool)
+	return linked
+}
+
+// Returns the protected header parameters linking a new signature of a
+// block to the stone. In format version 3 the meta signature is marked
+// `linked`, and the signatures of other blocks carry the hash of the meta
+// signature (`meta_hash`) and of the signatures of linkedBlocks (`links`).
+// A block signed before the meta block is not linked to it.
+func (self *Stone) linkHeader(blockName string, linkedBlocks []string) (jwsHeader, error) {
+
+	var header jwsHeader
+
+	if self.Version < FormatVersion3 {
+		if len(linkedBlocks) > 0 {
+			return header, errors.New(fmt.Sprintf("blocks can only be linked in format version %d", FormatVersion3))
+		}
+		return header, nil
+	}
+
+	if blockName == "meta" {
+		if len(linkedBlocks) > 0 {
+			return header, errors.New("`meta` block cannot be linked to other blocks")
+		}
+		header.Linked = true
+		return header, nil
+	}
+
+	if metaToken, err := self.SignatureToken("meta"); err == nil {
+		header.MetaHash = SignatureHash(metaToken)
+	}
+
+	for _, name := range linkedBlocks {
+		if name == "meta" || name == blockName || !isBlockName(name) {
+			return header, errors.New(fmt.Sprintf("`%s` block cannot be linked to `%s` block", blockName, name))
+		}
+		token, err := self.SignatureToken(name)
+		if err != nil {
+			return header, err
+		}
+		if header.Links == nil {
+			header.Links = make(map[string]string)
+		}
+		header.Links[name] = SignatureHash(token)
+	}
+
+	return header, nil
+}
+
+// Returns an error if a signature of a block is not linked to the current
+// signatures of the stone. Signatures of a linked stone must carry the hash
+// of the meta signature; the signatures of the blocks it links to must be
+// the ones it was linked to.
+func (self *Stone) checkLink(blockName, token string) error {
+
+	if blockName == "meta" {
+		return nil
+	}
+
+	header, err := tokenHeader(token)
+	if err != nil {
+		return errors.New(fmt.Sprintf("`%s` block signature header is malformed", blockName))
+	}
+
+	metaToken, err := self.SignatureToken("meta")
+	if err != nil {
+		return err
+	}
+
+	metaHash, _ := header["meta_hash"].(string)
+	if metaHash == "" && self.linkedStone() {
+		return errors.New(fmt.Sprintf("`%s` block signature is not linked to the `meta` signature", blockName))
+	}
+	if metaHash != "" && metaHash != SignatureHash(metaToken) {
+		return errors.New(fmt.Sprintf("`%s` block signature is linked to another `meta` signature", blockName))
+	}
+
+	if header["links"] == nil {
+		return nil
+	}
+
+	links, ok := header["links"].(map[string]interface{})
+	if !ok || !isStringMap(links) {
+		return errors.New(fmt.Sprintf("`%s` block signature links are malformed", blockName))
+	}
+
+	for _, name := range sortedKeys(links) {
+		linkedToken, err := self.SignatureToken(name)
+		if err != nil || SignatureHash(linkedToken) != links[name] {
+			return errors.New(fmt.Sprintf("`%s` block signature is linked to another `%s` signature", blockName, name))
+		}
+	}
+
+	return nil
+}
+
+// Verify that the signature of every signed block is linked to the meta
+// signature and to the signatures of the blocks it links to, so that
+// blocks cannot be moved between stones or mixed with earlier versions
+// of other blocks. Signatures are not verified; see Verify.
+func (self *Stone) VerifyLinks() error {
+
+	for _, blockName := range BlockNames() {
+
+		if blockName == "meta" || !self.HasSignature(blockName) {
+			continue
+		}
+
+		token, err := self.SignatureToken(blockName)
+		if err != nil {
+			return err
+		}
+
+		if err := self.checkLink(blockName, token); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
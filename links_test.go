@@ -0,0 +1,174 @@
+package stone
+
+import (
+	gocrypto "crypto"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/ellcrys/util"
+)
+
+// twinStone returns a stone with the same id as sh but another meta
+// signature, and an attributes block signed by the same signer
+func twinStone(t *testing.T, sh *Stone, signer Signer) *Stone {
+	twin, err := CreateWith(map[string]interface{}{
+		"id": sh.Meta["id"],
+		"type": sh.Meta["type"],
+		"created_at": util.ToInt64(sh.Meta["created_at"]) - 1,
+	}, signer)
+	assert.Nil(t, err)
+	assert.Nil(t, twin.AddAttributesWith(map[string]interface{}{
+		"ref_id": sh.Meta["id"],
+		"data": map[string]interface{}{ "discount": 0.9 },
+	}, signer))
+	return twin
+}
+
+// TestSignaturesAreLinkedToMeta tests that block signatures carry the hash of the meta signature
+func TestSignaturesAreLinkedToMeta(t *testing.T) {
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	sh := ecStone(t, signer)
+
+	metaHeader, _ := sh.SignatureHeader("meta")
+	assert.Equal(t, true, metaHeader["linked"])
+
+	metaToken, _ := sh.SignatureToken("meta")
+	for _, blockName := range []string{ "ownership", "attributes" } {
+		header, _ := sh.SignatureHeader(blockName)
+		assert.Equal(t, SignatureHash(metaToken), header["meta_hash"])
+	}
+	assert.Nil(t, sh.VerifyLinks())
+}
+
+// TestTransplantedBlockIsRejected tests that a block signed for another stone with the same id is rejected
+func TestTransplantedBlockIsRejected(t *testing.T) {
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	sh := ecStone(t, signer)
+	twin := twinStone(t, sh, signer)
+
+	sh.Attributes = twin.Attributes
+	sh.Signatures["attributes"] = twin.Signatures["attributes"]
+	err := sh.VerifyLinks()
+	assert.NotNil(t, err)
+	assert.Equal(t, "`attributes` block signature is linked to another `meta` signature", err.Error())
+
+	resolver := PublicKeyResolverFunc(func(issuer, keyID string) (gocrypto.PublicKey, error) {
+		return signer.Public(), nil
+	})
+	_, err = DecodeAndVerifyWith(sh.Encode(), resolver)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`attributes` block signature is linked to another `meta` signature", err.Error())
+}
+
+// TestUnlinkedSignatureIsRejected tests that a linked stone cannot be downgraded to accept unlinked signatures
+func TestUnlinkedSignatureIsRejected(t *testing.T) {
+	sh := NewValidStone()
+	assert.Nil(t, sh.AddAttributes(map[string]interface{}{ "ref_id": sh.Meta["id"], "data": "abc" }, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt")))
+
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	payload, _ := canonicalBlock(sh.Attributes)
+	sh.Signatures["attributes"], _ = signJWS(signer, []byte(payload))
+	sh.Version = FormatVersion2
+
+	_, err := DecodeAndVerify(sh.Encode(), staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt")))
+	assert.NotNil(t, err)
+	assert.Equal(t, "`attributes` block signature is not linked to the `meta` signature", err.Error())
+}
+
+// TestSigningMetaAgainBreaksLinks tests that blocks must be signed again after the meta block
+func TestSigningMetaAgainBreaksLinks(t *testing.T) {
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	sh := ecStone(t, signer)
+	_, err := sh.SignWith("meta", signer)
+	assert.Nil(t, err)
+	err = sh.VerifyLinks()
+	assert.NotNil(t, err)
+	assert.Equal(t, "`ownership` block signature is linked to another `meta` signature", err.Error())
+}
+
+// TestAddMetaAgainIsRejected tests that the meta block of a linked stone cannot be replaced once other blocks are signed
+func TestAddMetaAgainIsRejected(t *testing.T) {
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	sh := ecStone(t, signer)
+	meta := sh.Meta
+	err := sh.AddMetaWith(NewValidStone().Meta, signer)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block cannot be replaced while other blocks are signed: ownership, attributes. Create a new stone", err.Error())
+	assert.Equal(t, meta, sh.Meta)
+	assert.Nil(t, sh.VerifyLinks())
+
+	sh = Empty()
+	assert.Nil(t, sh.AddMetaWith(NewValidStone().Meta, signer))
+	assert.Nil(t, sh.AddMetaWith(NewValidStone().Meta, signer))
+}
+
+// TestSignLinked tests that a block can be linked to the signatures of other blocks
+func TestSignLinked(t *testing.T) {
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	sh := ecStone(t, signer)
+
+	_, err := sh.SignLinkedWith("attributes", signer, "ownership")
+	assert.Nil(t, err)
+	header, _ := sh.SignatureHeader("attributes")
+	ownershipToken, _ := sh.SignatureToken("ownership")
+	assert.Equal(t, SignatureHash(ownershipToken), header["links"].(map[string]interface{})["ownership"])
+	assert.Nil(t, sh.VerifyLinks())
+
+	_, err = sh.SignWith("ownership", signer)
+	assert.Nil(t, err)
+	err = sh.VerifyLinks()
+	assert.NotNil(t, err)
+	assert.Equal(t, "`attributes` block signature is linked to another `ownership` signature", err.Error())
+
+	_, err = sh.SignLinkedWith("attributes", signer, "meta")
+	assert.NotNil(t, err)
+	assert.Equal(t, "`attributes` block cannot be linked to `meta` block", err.Error())
+
+	_, err = sh.SignLinkedWith("attributes", signer, "embeds")
+	assert.NotNil(t, err)
+	assert.Equal(t, "`embeds` block has no signature", err.Error())
+}
+
+// TestMigrateLinksBlocks tests that migrating a version 2 stone links its blocks
+func TestMigrateLinksBlocks(t *testing.T) {
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	sh := Empty()
+	sh.Version = FormatVersion2
+	assert.Nil(t, sh.AddMetaWith(NewValidStone().Meta, signer))
+	assert.Nil(t, sh.AddAttributesWith(map[string]interface{}{ "ref_id": sh.Meta["id"], "data": "abc" }, signer))
+	header, _ := sh.SignatureHeader("attributes")
+	assert.Nil(t, header["meta_hash"])
+
+	assert.Nil(t, sh.Migrate(staticSigner(signer)))
+	assert.Equal(t, FormatVersion3, sh.Version)
+	header, _ = sh.SignatureHeader("attributes")
+	assert.NotNil(t, header["meta_hash"])
+
+	_, err := DecodeAndVerify(sh.Encode(), staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt")))
+	assert.Nil(t, err)
+}
+
+// TestTransplantedCOSEBlockIsRejected tests that CBOR encoded blocks are linked to the COSE meta signature
+func TestTransplantedCOSEBlockIsRejected(t *testing.T) {
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	resolver := PublicKeyResolverFunc(func(issuer, keyID string) (gocrypto.PublicKey, error) {
+		return signer.Public(), nil
+	})
+	sh := ecStone(t, signer)
+	twin := twinStone(t, sh, signer)
+
+	data, err := sh.EncodeCBOR(staticSigner(signer))
+	assert.Nil(t, err)
+	_, err = DecodeAndVerifyCBOR(data, resolver)
+	assert.Nil(t, err)
+
+	twinData, err := twin.EncodeCBOR(staticSigner(signer))
+	assert.Nil(t, err)
+	envelope, _ := cborUnmarshal(data)
+	twinEnvelope, _ := cborUnmarshal(twinData)
+	envelope.(map[string]interface{})["attributes"] = twinEnvelope.(map[string]interface{})["attributes"]
+	data, _ = cborMarshal(envelope)
+
+	_, err = DecodeAndVerifyCBOR(data, resolver)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`attributes` block signature is linked to another `meta` signature", err.Error())
+}
@@ -0,0 +1,237 @@
+package stone
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"strings"
+	"github.com/ellcrys/util"
+)
+
+// Returns the address ids of the owners named in an ownership block.
+// A `sole` ownership has one owner; `joint` and `threshold` ownerships
+// list theirs in `address_ids`.
+func OwnerAddressIDs(ownership map[string]interface{}) []string {
+
+	var addressIDs []string
+	ownershipType, _ := ownership["type"].(string)
+	group, _ := ownership[ownershipType].(map[string]interface{})
+
+	switch ownershipType {
+	case "sole":
+		if addressID, ok := group["address_id"].(string); ok {
+			addressIDs = append(addressIDs, addressID)
+		}
+	case "joint", "threshold":
+		switch ids := group["address_ids"].(type) {
+		case []string:
+			addressIDs = append(addressIDs, ids...)
+		case []interface{}:
+			for _, id := range ids {
+				if s, ok := id.(string); ok {
+					addressIDs = append(addressIDs, s)
+				}
+			}
+		}
+	}
+
+	return addressIDs
+}
+
+// Returns the number of owner signatures an ownership block needs: all
+// owners of a `sole` or `joint` ownership and `required` owners of a
+// `threshold` ownership.
+func RequiredOwnerSignatures(ownership map[string]interface{}) int {
+	if ownership["type"] == "threshold" {
+		group, _ := ownership["threshold"].(map[string]interface{})
+		required, _ := toInt(group["required"])
+		return int(required)
+	}
+	return len(OwnerAddressIDs(ownership))
+}
+
+// Returns the owner signatures of the ownership block keyed by address id
+func (self *Stone) OwnerSignatures() map[string]string {
+	var signatures = make(map[string]string)
+	switch s := self.Signatures["owners"].(type) {
+	case map[string]string:
+		for addressID, token := range s {
+			signatures[addressID] = token
+		}
+	case map[string]interface{}:
+		for addressID, token := range s {
+			if t, ok := token.(string); ok {
+				signatures[addressID] = t
+			}
+		}
+	}
+	return signatures
+}
+
+// Sign the ownership block as one of its owners. The signature is stored
+// in `signatures.owners` under the owner's address id, alongside the
+// issuer's ownership signature. The address id must be an owner named
+// in the ownership block.
+func (self *Stone) SignAsOwner(addressID string, ownerPrivateKey string) error {
+
+	signer, err := parseSigner(ownerPrivateKey)
+	if err != nil {
+		return err
+	}
+
+	return self.SignAsOwnerWith(addressID, signer)
+}
+
+// Sign the ownership block as one of its owners using a Signer. See SignAsOwner.
+func (self *Stone) SignAsOwnerWith(addressID string, owner Signer) error {
+
+	if owner == nil {
+		return errors.New("signer is required")
+	}
+
+	if !self.HasSignature("ownership") {
+		return errors.New("`ownership` block has no signature")
+	}
+
+	if !util.InStringSlice(OwnerAddressIDs(self.Ownership), addressID) {
+		return errors.New(fmt.Sprintf("`%s` is not an owner", addressID))
+	}
+
+	payload, err := canonicalBlock(self.Ownership)
+	if err != nil {
+		return err
+	}
+
+	header, err := self.linkHeader("ownership", nil)
+	if err != nil {
+		return err
+	}
+
+	signature, err := signJWSHeader(owner, []byte(payload), header)
+	if err != nil {
+		return errors.New("failed to sign block")
+	}
+
+	ownerSignatures := self.OwnerSignatures()
+	ownerSignatures[addressID] = signature
+	self.Signatures["owners"] = ownerSignatures
+	return nil
+}
+
+// Verify the owner signatures of the ownership block. Every owner of a
+// `sole` or `joint` ownership and at least `required` owners of a `threshold`
+// ownership must have signed the same ownership block the issuer signed.
+// Invalid signatures of a `threshold` ownership do not count towards it.
+// The owners resolver is called with an owner's address id and the `kid`
+// of its signature and must return its PEM encoded public key.
+func (self *Stone) VerifyOwnerSignatures(owners KeyResolver) error {
+
+	if owners == nil {
+		return errors.New("key resolver is required")
+	}
+
+	return self.VerifyOwnerSignaturesWith(PublicKeyResolverFunc(func(addressID, keyID string) (crypto.PublicKey, error) {
+		publicKey, err := owners.ResolveKey(addressID, keyID)
+		if err != nil {
+			return nil, err
+		}
+		return parsePublicKey(publicKey)
+	}))
+}
+
+// Verify the owner signatures of the ownership block using public key values.
+// See VerifyOwnerSignatures.
+func (self *Stone) VerifyOwnerSignaturesWith(owners PublicKeyResolver) error {
+
+	if !self.HasSignature("ownership") {
+		return errors.New("`ownership` block has no signature")
+	}
+
+	token, err := self.SignatureToken("ownership")
+	if err != nil {
+		return err
+	}
+
+	ownershipPayload, err := util.GetJWSPayload(token)
+	if err != nil {
+		return errors.New("`ownership` block signature could not be verified")
+	}
+
+	addressIDs := OwnerAddressIDs(self.Ownership)
+	ownerSignatures := self.OwnerSignatures()
+
+	for addressID, _ := range ownerSignatures {
+		if !util.InStringSlice(addressIDs, addressID) {
+			return errors.New(fmt.Sprintf("`%s` is not an owner", addressID))
+		}
+	}
+
+	// a `threshold` ownership only needs `required` valid signatures,
+	// so invalid ones are skipped and reported if too few remain
+	threshold := self.Ownership["type"] == "threshold"
+
+	var signed int
+	var missing []string
+	var invalid error
+	for _, addressID := range addressIDs {
+
+		token, ok := ownerSignatures[addressID]
+		if !ok {
+			missing = append(missing, addressID)
+			continue
+		}
+
+		if err := self.verifyOwnerSignature(addressID, token, ownershipPayload, owners); err != nil {
+			if !threshold {
+				return err
+			}
+			if invalid == nil {
+				invalid = err
+			}
+			missing = append(missing, addressID)
+			continue
+		}
+
+		signed++
+	}
+
+	if required := RequiredOwnerSignatures(self.Ownership); signed < required {
+		if invalid != nil {
+			return invalid
+		}
+		return errors.New(fmt.Sprintf("ownership requires %d owner signatures, got %d. Missing: %s", required, signed, strings.Join(missing, ", ")))
+	}
+
+	return nil
+}
+
+// Verify the signature of an owner over the ownership block
+func (self *Stone) verifyOwnerSignature(addressID, token, ownershipPayload string, owners PublicKeyResolver) error {
+
+	// owners must sign the block the issuer signed
+	if payload, _ := util.GetJWSPayload(token); payload != ownershipPayload {
+		return errors.New(fmt.Sprintf("signature of owner `%s` is not over the ownership block", addressID))
+	}
+
+	header, err := tokenHeader(token)
+	if err != nil {
+		return errors.New(fmt.Sprintf("signature of owner `%s` has a malformed header", addressID))
+	}
+
+	keyID, _ := header["kid"].(string)
+	publicKey, err := owners.ResolvePublicKey(addressID, keyID)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to resolve key of owner `%s`: %s", addressID, err.Error()))
+	}
+
+	if _, err := verifyJWS(token, publicKey); err != nil {
+		return errors.New(fmt.Sprintf("signature of owner `%s` could not be verified", addressID))
+	}
+
+	// like the issuer's, owner signatures are linked to the stone
+	if err := self.checkLink("ownership", token); err != nil {
+		return errors.New(fmt.Sprintf("signature of owner `%s` is not linked to the stone", addressID))
+	}
+
+	return nil
+}
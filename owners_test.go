@@ -0,0 +1,100 @@
+package stone
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/ellcrys/util"
+)
+
+// NewGroupStone creates a stone owned by alice, bob and carol
+func NewGroupStone(ownershipType string, group map[string]interface{}) *Stone {
+	sh := NewValidStone()
+	group["address_ids"] = []interface{}{ "alice", "bob", "carol" }
+	var ownership = map[string]interface{}{
+		"ref_id": sh.Meta["id"],
+		"type": ownershipType,
+		ownershipType: group,
+	}
+	if err := sh.AddOwnership(ownership, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt")); err != nil {
+		panic(err)
+	}
+	return sh
+}
+
+// TestJointOwnershipRequiresAllOwners tests that every joint owner must sign
+func TestJointOwnershipRequiresAllOwners(t *testing.T) {
+	sh := NewGroupStone("joint", map[string]interface{}{})
+	assert.Nil(t, sh.SignAsOwner("alice", util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt")))
+	assert.Nil(t, sh.SignAsOwner("bob", util.ReadFromFixtures("tests/fixtures/ed25519_priv_1.txt")))
+	err := sh.VerifyOwnerSignatures(ownerKeys)
+	assert.NotNil(t, err)
+	assert.Equal(t, "ownership requires 3 owner signatures, got 2. Missing: carol", err.Error())
+
+	assert.Nil(t, sh.SignAsOwner("carol", util.ReadFromFixtures("tests/fixtures/rsa_priv_2.txt")))
+	assert.Nil(t, sh.VerifyOwnerSignatures(ownerKeys))
+
+	// owner signatures survive encoding
+	decStone, err := Decode(sh.Encode())
+	assert.Nil(t, err)
+	assert.Nil(t, decStone.VerifyOwnerSignatures(ownerKeys))
+}
+
+// TestThresholdOwnership tests that `required` owner signatures are enough for a threshold ownership
+func TestThresholdOwnership(t *testing.T) {
+	sh := NewGroupStone("threshold", map[string]interface{}{ "required": 2 })
+	assert.Nil(t, sh.SignAsOwner("alice", util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt")))
+	assert.NotNil(t, sh.VerifyOwnerSignatures(ownerKeys))
+	assert.Nil(t, sh.SignAsOwner("carol", util.ReadFromFixtures("tests/fixtures/rsa_priv_2.txt")))
+	assert.Nil(t, sh.VerifyOwnerSignatures(ownerKeys))
+}
+
+// TestOwnerSignatureWithWrongKey tests that an owner signature made with another owner's key is rejected
+func TestOwnerSignatureWithWrongKey(t *testing.T) {
+	sh := NewGroupStone("threshold", map[string]interface{}{ "required": 1 })
+	assert.Nil(t, sh.SignAsOwner("alice", util.ReadFromFixtures("tests/fixtures/ed25519_priv_1.txt")))
+	err := sh.VerifyOwnerSignatures(ownerKeys)
+	assert.NotNil(t, err)
+	assert.Equal(t, "signature of owner `alice` could not be verified", err.Error())
+}
+
+// TestThresholdSkipsInvalidOwnerSignature tests that an invalid owner signature does not
+// fail a threshold ownership that has enough valid ones
+func TestThresholdSkipsInvalidOwnerSignature(t *testing.T) {
+	sh := NewGroupStone("threshold", map[string]interface{}{ "required": 2 })
+	assert.Nil(t, sh.SignAsOwner("alice", util.ReadFromFixtures("tests/fixtures/ed25519_priv_1.txt")))
+	assert.Nil(t, sh.SignAsOwner("bob", util.ReadFromFixtures("tests/fixtures/ed25519_priv_1.txt")))
+	assert.Nil(t, sh.SignAsOwner("carol", util.ReadFromFixtures("tests/fixtures/rsa_priv_2.txt")))
+	assert.Nil(t, sh.VerifyOwnerSignatures(ownerKeys))
+
+	sh = NewGroupStone("joint", map[string]interface{}{})
+	assert.Nil(t, sh.SignAsOwner("alice", util.ReadFromFixtures("tests/fixtures/ed25519_priv_1.txt")))
+	err := sh.VerifyOwnerSignatures(ownerKeys)
+	assert.NotNil(t, err)
+	assert.Equal(t, "signature of owner `alice` could not be verified", err.Error())
+}
+
+// TestSignAsOwnerWithUnknownOwner tests that only listed owners can sign
+func TestSignAsOwnerWithUnknownOwner(t *testing.T) {
+	sh := NewGroupStone("joint", map[string]interface{}{})
+	err := sh.SignAsOwner("mallory", util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	assert.NotNil(t, err)
+	assert.Equal(t, "`mallory` is not an owner", err.Error())
+}
+
+// TestOwnerSignaturesResetWithOwnership tests that assigning a new ownership discards owner signatures
+func TestOwnerSignaturesResetWithOwnership(t *testing.T) {
+	sh := NewGroupStone("joint", map[string]interface{}{})
+	assert.Nil(t, sh.SignAsOwner("alice", util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt")))
+	sh.Ownership["joint"].(map[string]interface{})["address_ids"] = []interface{}{ "alice", "bob" }
+	err := sh.AddOwnership(sh.Ownership, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.Nil(t, err)
+	assert.Len(t, sh.OwnerSignatures(), 0)
+}
+
+// TestSoleOwnerSignature tests that the single owner of a sole ownership can sign
+func TestSoleOwnerSignature(t *testing.T) {
+	sh := NewOwnedStone()
+	assert.NotNil(t, sh.VerifyOwnerSignatures(ownerKeys))
+	assert.Nil(t, sh.SignAsOwner("alice", util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt")))
+	assert.Nil(t, sh.VerifyOwnerSignatures(ownerKeys))
+}
@@ -0,0 +1,103 @@
+package stone
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"github.com/ellcrys/util"
+)
+
+// A BlockValidator validates the content of a custom block. It is
+// called after the block's `ref_id` has been checked against the stone
+// id. A *ValidationError (or ValidationErrors) it returns is reported
+// as is and should point into the block (e.g `/compliance/kyc_ref`);
+// other errors are reported with code CodeInvalidValue.
+type BlockValidator func(block map[string]interface{}, metaID string) error
+
+// registry holds the custom blocks registered by the application
+var registry = struct {
+	sync.RWMutex
+	validators map[string]BlockValidator
+}{ validators: make(map[string]BlockValidator) }
+
+// Names that cannot be used by custom blocks: the built-in blocks,
+// the properties of the `signatures` block and the format version
+var reservedBlockNames = []string{ "meta", "ownership", "attributes", "embeds", "signatures", "ownership_history", "owners", "disclosures", "version" }
+
+// Custom block names are lowercase identifiers
+var blockNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Register a custom block. A stone can then carry the block at
+// the top level, next to the built-in blocks; it is signed, encoded,
+// decoded and verified like them. Like the `ownership`, `attributes`
+// and `embeds` blocks, a custom block must have a `ref_id` property equal
+// to the stone id; its other properties are checked by the validator.
+// Blocks should be registered once, before stones using them are loaded.
+func RegisterBlock(name string, validator BlockValidator) error {
+
+	if !blockNamePattern.MatchString(name) {
+		return errors.New(fmt.Sprintf("`%s` is not a valid block name", name))
+	}
+
+	if util.InStringSlice(reservedBlockNames, name) {
+		return errors.New(fmt.Sprintf("`%s` is a reserved block name", name))
+	}
+
+	if validator == nil {
+		return errors.New("block validator is required")
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.validators[name]; ok {
+		return errors.New(fmt.Sprintf("`%s` block is already registered", name))
+	}
+	registry.validators[name] = validator
+	return nil
+}
+
+// Remove a custom block from the registry
+func UnregisterBlock(name string) {
+	registry.Lock()
+	defer registry.Unlock()
+	delete(registry.validators, name)
+}
+
+// Returns the names of the registered custom blocks in sorted order
+func CustomBlockNames() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	var names []string
+	for name, _ := range registry.validators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the names of all blocks a stone can carry: the
+// built-in blocks (KnownBlockNames) followed by the custom blocks
+func BlockNames() []string {
+	return append(append([]string{}, KnownBlockNames...), CustomBlockNames()...)
+}
+
+// Checks whether a block is a built-in or a registered custom block
+func isBlockName(name string) bool {
+	return util.InStringSlice(KnownBlockNames, name) || isCustomBlock(name)
+}
+
+// Checks whether a block is a registered custom block
+func isCustomBlock(name string) bool {
+	_, ok := customBlockValidator(name)
+	return ok
+}
+
+// Returns the validator of a custom block
+func customBlockValidator(name string) (BlockValidator, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	validator, ok := registry.validators[name]
+	return validator, ok
+}
@@ -0,0 +1,121 @@
+package stone
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/ellcrys/util"
+)
+
+// registerCompliance registers a `compliance` block requiring a string `kyc_ref`
+func registerCompliance(t *testing.T) {
+	err := RegisterBlock("compliance", func(block map[string]interface{}, metaID string) error {
+		if _, ok := block["kyc_ref"].(string); !ok {
+			return newValidationError(CodeMissingProperty, "/compliance/kyc_ref", "`compliance` block is missing `kyc_ref` property")
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+}
+
+// TestRegisterBlockInvalid tests that invalid, reserved and duplicate block names are rejected
+func TestRegisterBlockInvalid(t *testing.T) {
+	registerCompliance(t)
+	defer UnregisterBlock("compliance")
+
+	validator := func(block map[string]interface{}, metaID string) error { return nil }
+	err := RegisterBlock("Compliance", validator)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`Compliance` is not a valid block name", err.Error())
+	err = RegisterBlock("owners", validator)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`owners` is a reserved block name", err.Error())
+	err = RegisterBlock("version", validator)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`version` is a reserved block name", err.Error())
+	err = RegisterBlock("compliance", validator)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`compliance` block is already registered", err.Error())
+	err = RegisterBlock("audit", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "block validator is required", err.Error())
+}
+
+// TestSetBlock tests that a custom block is validated and signed
+func TestSetBlock(t *testing.T) {
+	registerCompliance(t)
+	defer UnregisterBlock("compliance")
+
+	sh := NewValidStone()
+	err := sh.SetBlock("compliance", map[string]interface{}{ "ref_id": sh.Meta["id"] }, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.NotNil(t, err)
+	assert.Equal(t, "`compliance` block is missing `kyc_ref` property", err.Error())
+	assert.False(t, sh.HasBlock("compliance"))
+
+	err = sh.SetBlock("compliance", map[string]interface{}{ "ref_id": "abc", "kyc_ref": "kyc-1" }, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.NotNil(t, err)
+	assert.Equal(t, "`compliance.ref_id` not equal to `meta.id`", err.Error())
+
+	err = sh.SetBlock("compliance", map[string]interface{}{ "ref_id": sh.Meta["id"], "kyc_ref": "kyc-1" }, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.Nil(t, err)
+	assert.True(t, sh.HasBlock("compliance"))
+	assert.True(t, sh.HasSignature("compliance"))
+	assert.Nil(t, sh.Verify("compliance", util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt")))
+}
+
+// TestSetBlockUnknown tests that unregistered blocks cannot be set or signed
+func TestSetBlockUnknown(t *testing.T) {
+	sh := NewValidStone()
+	err := sh.SetBlock("compliance", map[string]interface{}{ "ref_id": sh.Meta["id"] }, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.NotNil(t, err)
+	assert.Equal(t, "block unknown", err.Error())
+	_, err = sh.Sign("compliance", util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.NotNil(t, err)
+	assert.Equal(t, "block unknown", err.Error())
+	assert.False(t, sh.HasSignature("compliance"))
+}
+
+// TestCustomBlockEncodeDecode tests that a custom block survives encoding, decoding and verification
+func TestCustomBlockEncodeDecode(t *testing.T) {
+	registerCompliance(t)
+	defer UnregisterBlock("compliance")
+
+	sh := NewValidStone()
+	assert.Nil(t, sh.SetBlock("compliance", map[string]interface{}{ "ref_id": sh.Meta["id"], "kyc_ref": "kyc-1" }, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt")))
+
+	decStone, err := DecodeAndVerify(sh.Encode(), staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt")))
+	assert.Nil(t, err)
+	assert.Equal(t, "kyc-1", decStone.Block("compliance")["kyc_ref"])
+}
+
+// TestCustomBlockJSON tests that a custom block is written to and loaded from JSON
+func TestCustomBlockJSON(t *testing.T) {
+	registerCompliance(t)
+	defer UnregisterBlock("compliance")
+
+	sh := NewValidStone()
+	assert.Nil(t, sh.SetBlock("compliance", map[string]interface{}{ "ref_id": sh.Meta["id"], "kyc_ref": "kyc-1" }, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt")))
+
+	loaded, err := LoadJSON(sh.JSON())
+	assert.Nil(t, err)
+	assert.Equal(t, "kyc-1", loaded.Block("compliance")["kyc_ref"])
+	assert.Equal(t, "kyc-1", sh.Clone().Block("compliance")["kyc_ref"])
+
+	// the block is validated when loaded
+	data, _ := util.JSONToMap(sh.JSON())
+	delete(data["compliance"].(map[string]interface{}), "kyc_ref")
+	err = Validate(data)
+	assert.NotNil(t, err)
+	assert.Equal(t, "/compliance/kyc_ref", err.(*ValidationError).Pointer)
+}
+
+// TestValidateSignaturesBlockUnregisteredBlock tests that signatures of unregistered blocks are rejected
+func TestValidateSignaturesBlockUnregisteredBlock(t *testing.T) {
+	registerCompliance(t)
+	sh := NewValidStone()
+	assert.Nil(t, sh.SetBlock("compliance", map[string]interface{}{ "ref_id": sh.Meta["id"], "kyc_ref": "kyc-1" }, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt")))
+	UnregisterBlock("compliance")
+
+	err := ValidateSignaturesBlock(sh.Signatures)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`compliance` property is unexpected in `signatures` block", err.Error())
+}
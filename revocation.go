@@ -0,0 +1,180 @@
+package stone
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A RevocationList tells whether the issuer has revoked a stone.
+// Stones are identified by their `meta.id`.
+type RevocationList interface {
+	IsRevoked(id string) (bool, error)
+}
+
+// MemoryRevocationList is a RevocationList kept in memory
+type MemoryRevocationList struct {
+	mu      sync.RWMutex
+	revoked map[string]bool
+}
+
+// FileRevocationList is a RevocationList read from a file signed by
+// the issuer (see WriteRevocationFile). The file is read again when it
+// changes; a file with an invalid signature or older than the one
+// already read is rejected.
+type FileRevocationList struct {
+	mu        sync.Mutex
+	path      string
+	publicKey crypto.PublicKey
+	modTime   time.Time
+	issuedAt  int64
+	list      *MemoryRevocationList
+}
+
+// revocationFile is the payload of a signed revocation file. The issue
+// time is in microseconds so that it is an exact JSON number.
+type revocationFile struct {
+	IssuedAt int64    `json:"issued_at"`
+	Revoked  []string `json:"revoked"`
+}
+
+// Create a MemoryRevocationList revoking the given stones
+func NewMemoryRevocationList(ids ...string) *MemoryRevocationList {
+	list := &MemoryRevocationList{ revoked: make(map[string]bool) }
+	list.Revoke(ids...)
+	return list
+}
+
+// Revoke stones
+func (self *MemoryRevocationList) Revoke(ids ...string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for _, id := range ids {
+		self.revoked[id] = true
+	}
+}
+
+// Checks whether a stone is revoked
+func (self *MemoryRevocationList) IsRevoked(id string) (bool, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.revoked[id], nil
+}
+
+// Returns the ids of the revoked stones in sorted order
+func (self *MemoryRevocationList) IDs() []string {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	var ids []string
+	for id, _ := range self.revoked {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Write a revocation file listing the revoked stones, signed by the
+// issuer. The file is replaced atomically so readers never see a
+// partially written list.
+func WriteRevocationFile(path string, ids []string, issuer Signer) error {
+
+	if issuer == nil {
+		return errors.New("signer is required")
+	}
+
+	revoked := append([]string{}, ids...)
+	sort.Strings(revoked)
+	payload, err := CanonicalJSON(revocationFile{ IssuedAt: time.Now().UnixMicro(), Revoked: revoked })
+	if err != nil {
+		return err
+	}
+
+	token, err := signJWS(issuer, payload)
+	if err != nil {
+		return errors.New("failed to sign revocation list")
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.WriteString(token)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Open a revocation file written by WriteRevocationFile. Its signature
+// is verified with the issuer's public key.
+func OpenFileRevocationList(path string, issuerPublicKey crypto.PublicKey) (*FileRevocationList, error) {
+	list := &FileRevocationList{ path: path, publicKey: issuerPublicKey }
+	if err := list.reload(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Read the file again if it changed since it was last read
+func (self *FileRevocationList) reload() error {
+
+	info, err := os.Stat(self.path)
+	if err != nil {
+		return err
+	}
+
+	if self.list != nil && info.ModTime().Equal(self.modTime) {
+		return nil
+	}
+
+	token, err := ioutil.ReadFile(self.path)
+	if err != nil {
+		return err
+	}
+
+	payload, err := verifyJWS(string(token), self.publicKey)
+	if err != nil {
+		return errors.New("revocation list signature could not be verified")
+	}
+
+	var file revocationFile
+	if err := json.Unmarshal(payload, &file); err != nil {
+		return errors.New("revocation list is malformed")
+	}
+
+	if file.IssuedAt < self.issuedAt {
+		return errors.New(fmt.Sprintf("revocation list issued at %d is older than the one already read", file.IssuedAt))
+	}
+
+	self.list = NewMemoryRevocationList(file.Revoked...)
+	self.issuedAt = file.IssuedAt
+	self.modTime = info.ModTime()
+	return nil
+}
+
+// Checks whether a stone is revoked. An error is returned if the
+// file changed and the new list could not be read.
+func (self *FileRevocationList) IsRevoked(id string) (bool, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if err := self.reload(); err != nil {
+		return false, err
+	}
+	return self.list.IsRevoked(id)
+}
@@ -0,0 +1,75 @@
+package stone
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"github.com/ellcrys/util"
+)
+
+// TestMemoryRevocationList tests that revoked ids are reported as revoked
+func TestMemoryRevocationList(t *testing.T) {
+	list := NewMemoryRevocationList("a")
+	list.Revoke("b")
+	revoked, err := list.IsRevoked("b")
+	assert.Nil(t, err)
+	assert.True(t, revoked)
+	revoked, _ = list.IsRevoked("c")
+	assert.False(t, revoked)
+	assert.Equal(t, []string{ "a", "b" }, list.IDs())
+}
+
+// TestFileRevocationList tests that a signed revocation file is read and read again when it changes
+func TestFileRevocationList(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "revocations")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "revoked.jws")
+	issuer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+
+	assert.Nil(t, WriteRevocationFile(path, []string{ "a" }, issuer))
+	list, err := OpenFileRevocationList(path, issuer.Public())
+	assert.Nil(t, err)
+	revoked, err := list.IsRevoked("a")
+	assert.Nil(t, err)
+	assert.True(t, revoked)
+
+	assert.Nil(t, WriteRevocationFile(path, []string{ "a", "b" }, issuer))
+	os.Chtimes(path, time.Now().Add(time.Second), time.Now().Add(time.Second))
+	revoked, err = list.IsRevoked("b")
+	assert.Nil(t, err)
+	assert.True(t, revoked)
+}
+
+// TestFileRevocationListWrongKey tests that a revocation file signed by another key is rejected
+func TestFileRevocationListWrongKey(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "revocations")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "revoked.jws")
+	issuer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	otherKey, _ := ParsePublicKey(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt"))
+
+	assert.Nil(t, WriteRevocationFile(path, []string{ "a" }, issuer))
+	_, err := OpenFileRevocationList(path, otherKey)
+	assert.NotNil(t, err)
+	assert.Equal(t, "revocation list signature could not be verified", err.Error())
+}
+
+// TestDecodeAndVerifyRevoked tests that a validator rejects a revoked stone
+func TestDecodeAndVerifyRevoked(t *testing.T) {
+	sh := NewValidStone()
+	resolver := staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt"))
+	validator := NewValidator()
+	validator.Revocations = NewMemoryRevocationList()
+
+	_, err := validator.DecodeAndVerify(sh.Encode(), resolver)
+	assert.Nil(t, err)
+
+	validator.Revocations.(*MemoryRevocationList).Revoke(sh.Meta["id"].(string))
+	_, err = validator.DecodeAndVerify(sh.Encode(), resolver)
+	assert.NotNil(t, err)
+	assert.Equal(t, CodeRevoked, err.(*ValidationError).Code)
+	assert.Equal(t, "stone `"+sh.Meta["id"].(string)+"` has been revoked", err.Error())
+}
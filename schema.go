@@ -0,0 +1,444 @@
+package stone
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+	"github.com/ellcrys/util"
+)
+
+// Schema is a compiled JSON Schema that `attributes.data` must satisfy.
+// A subset of draft 2020-12 is supported: `type`, `enum`, `const`,
+// `properties`, `required`, `additionalProperties`, `items`, `minItems`,
+// `maxItems`, `minimum`, `maximum`, `exclusiveMinimum`, `exclusiveMaximum`,
+// `minLength`, `maxLength` and `pattern`. Schemas using any other keyword
+// are rejected; annotations (`title`, `description`, ...) are ignored.
+type Schema struct {
+	reject               bool
+	types                []string
+	enum                 []string
+	constant             *string
+	properties           map[string]*Schema
+	required             []string
+	additionalProperties *Schema
+	items                *Schema
+	minItems             *int
+	maxItems             *int
+	minimum              *float64
+	maximum              *float64
+	exclusiveMinimum     *float64
+	exclusiveMaximum     *float64
+	minLength            *int
+	maxLength            *int
+	pattern              *regexp.Regexp
+}
+
+// SchemaRegistry maps stone types (`meta.type`) to the schema
+// their `attributes.data` must satisfy. A SchemaRegistry can be
+// shared by goroutines.
+type SchemaRegistry struct {
+	mu      sync.RWMutex
+	schemas map[string]*Schema
+}
+
+// Keywords that carry no validation rule
+var schemaAnnotations = []string{ "$schema", "$id", "$comment", "title", "description", "default", "examples", "deprecated", "readOnly", "writeOnly" }
+
+// The values of the `type` keyword
+var schemaTypes = []string{ "null", "boolean", "object", "array", "number", "integer", "string" }
+
+// Compile a JSON Schema
+func CompileSchema(schemaJSON []byte) (*Schema, error) {
+
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(schemaJSON))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return nil, errors.New("schema is malformed: " + err.Error())
+	}
+
+	return compileSchema(v, "")
+}
+
+// Read and compile a JSON Schema file
+func LoadSchemaFile(path string) (*Schema, error) {
+	schemaJSON, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := CompileSchema(schemaJSON)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: %s", path, err.Error()))
+	}
+	return schema, nil
+}
+
+func compileSchema(v interface{}, pointer string) (*Schema, error) {
+
+	// boolean schemas accept or reject everything
+	if b, ok := v.(bool); ok {
+		return &Schema{ reject: !b }, nil
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, schemaCompileError(pointer, "a schema must be an object or a boolean")
+	}
+
+	var schema = &Schema{}
+	var err error
+	for _, keyword := range sortedKeys(m) {
+
+		value := m[keyword]
+		at := pointer + jsonPointer(keyword)
+
+		switch keyword {
+		case "type":
+			switch t := value.(type) {
+			case string:
+				schema.types = []string{ t }
+			case []interface{}:
+				for _, item := range t {
+					s, _ := item.(string)
+					schema.types = append(schema.types, s)
+				}
+			}
+			if len(schema.types) == 0 {
+				return nil, schemaCompileError(at, "expects a type name or an array of type names")
+			}
+			for _, typeName := range schema.types {
+				if !util.InStringSlice(schemaTypes, typeName) {
+					return nil, schemaCompileError(at, fmt.Sprintf("unknown type `%s`", typeName))
+				}
+			}
+
+		case "enum":
+			values, ok := value.([]interface{})
+			if !ok {
+				return nil, schemaCompileError(at, "expects an array")
+			}
+			for _, item := range values {
+				c, err := CanonicalJSON(item)
+				if err != nil {
+					return nil, schemaCompileError(at, err.Error())
+				}
+				schema.enum = append(schema.enum, string(c))
+			}
+
+		case "const":
+			c, err := CanonicalJSON(value)
+			if err != nil {
+				return nil, schemaCompileError(at, err.Error())
+			}
+			constant := string(c)
+			schema.constant = &constant
+
+		case "properties":
+			properties, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, schemaCompileError(at, "expects an object")
+			}
+			schema.properties = make(map[string]*Schema)
+			for name, property := range properties {
+				if schema.properties[name], err = compileSchema(property, at + jsonPointer(name)); err != nil {
+					return nil, err
+				}
+			}
+
+		case "required":
+			names, ok := value.([]interface{})
+			if !ok {
+				return nil, schemaCompileError(at, "expects an array of strings")
+			}
+			for _, name := range names {
+				s, ok := name.(string)
+				if !ok {
+					return nil, schemaCompileError(at, "expects an array of strings")
+				}
+				schema.required = append(schema.required, s)
+			}
+
+		case "additionalProperties":
+			if schema.additionalProperties, err = compileSchema(value, at); err != nil {
+				return nil, err
+			}
+
+		case "items":
+			if schema.items, err = compileSchema(value, at); err != nil {
+				return nil, err
+			}
+
+		case "minItems", "maxItems", "minLength", "maxLength":
+			n, ok := toInt(value)
+			if !ok || n < 0 {
+				return nil, schemaCompileError(at, "expects a non-negative integer")
+			}
+			limit := int(n)
+			switch keyword {
+			case "minItems":
+				schema.minItems = &limit
+			case "maxItems":
+				schema.maxItems = &limit
+			case "minLength":
+				schema.minLength = &limit
+			case "maxLength":
+				schema.maxLength = &limit
+			}
+
+		case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum":
+			n, ok := toFloat(value)
+			if !ok {
+				return nil, schemaCompileError(at, "expects a number")
+			}
+			switch keyword {
+			case "minimum":
+				schema.minimum = &n
+			case "maximum":
+				schema.maximum = &n
+			case "exclusiveMinimum":
+				schema.exclusiveMinimum = &n
+			case "exclusiveMaximum":
+				schema.exclusiveMaximum = &n
+			}
+
+		case "pattern":
+			s, ok := value.(string)
+			if !ok {
+				return nil, schemaCompileError(at, "expects a string")
+			}
+			if schema.pattern, err = regexp.Compile(s); err != nil {
+				return nil, schemaCompileError(at, "invalid regular expression")
+			}
+
+		default:
+			if !util.InStringSlice(schemaAnnotations, keyword) {
+				return nil, schemaCompileError(at, fmt.Sprintf("keyword `%s` is not supported", keyword))
+			}
+		}
+	}
+
+	return schema, nil
+}
+
+// Returns a schema compilation error
+func schemaCompileError(pointer, reason string) error {
+	if pointer == "" {
+		return errors.New("invalid schema: " + reason)
+	}
+	return errors.New(fmt.Sprintf("invalid schema at `%s`: %s", pointer, reason))
+}
+
+// Converts a number to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	}
+	if n, ok := toInt(v); ok {
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// Validate a value against the schema. Errors are of type ValidationErrors
+// and point to the offending values relative to the validated value.
+func (self *Schema) Validate(data interface{}) error {
+
+	// normalize the value to the types produced by decoding JSON
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return ValidationErrors{ newValidationError(CodeSchemaViolation, "", "value cannot be serialized") }
+	}
+	decoder := json.NewDecoder(bytes.NewReader(dataJSON))
+	decoder.UseNumber()
+	decoder.Decode(&data)
+
+	var errs ValidationErrors
+	self.check(data, "", &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Returns the JSON Schema type name of a decoded JSON value
+func schemaTypeOf(v interface{}) string {
+	switch n := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		if f, err := n.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	}
+	return ""
+}
+
+func (self *Schema) check(v interface{}, pointer string, errs *ValidationErrors) {
+
+	fail := func(reason string) {
+		location := "value"
+		if pointer != "" {
+			location = fmt.Sprintf("value at `%s`", pointer)
+		}
+		*errs = append(*errs, newValidationError(CodeSchemaViolation, pointer, location + " " + reason))
+	}
+
+	if self.reject {
+		fail("is not allowed")
+		return
+	}
+
+	valueType := schemaTypeOf(v)
+
+	if len(self.types) > 0 {
+		matched := util.InStringSlice(self.types, valueType) || (valueType == "integer" && util.InStringSlice(self.types, "number"))
+		if !matched {
+			fail(fmt.Sprintf("must be of type %s", strings.Join(self.types, " or ")))
+			return
+		}
+	}
+
+	if self.constant != nil || len(self.enum) > 0 {
+		c, _ := CanonicalJSON(v)
+		if self.constant != nil && string(c) != *self.constant {
+			fail(fmt.Sprintf("must be %s", *self.constant))
+		}
+		if len(self.enum) > 0 && !util.InStringSlice(self.enum, string(c)) {
+			fail(fmt.Sprintf("must be one of %s", strings.Join(self.enum, ", ")))
+		}
+	}
+
+	switch value := v.(type) {
+
+	case map[string]interface{}:
+		for _, name := range self.required {
+			if _, ok := value[name]; !ok {
+				*errs = append(*errs, newValidationError(CodeSchemaViolation, pointer + jsonPointer(name), fmt.Sprintf("property `%s` is required", pointer + jsonPointer(name))))
+			}
+		}
+		for _, name := range sortedKeys(value) {
+			if property, ok := self.properties[name]; ok {
+				property.check(value[name], pointer + jsonPointer(name), errs)
+			} else if self.additionalProperties != nil {
+				self.additionalProperties.check(value[name], pointer + jsonPointer(name), errs)
+			}
+		}
+
+	case []interface{}:
+		if self.minItems != nil && len(value) < *self.minItems {
+			fail(fmt.Sprintf("must have at least %d items", *self.minItems))
+		}
+		if self.maxItems != nil && len(value) > *self.maxItems {
+			fail(fmt.Sprintf("must have at most %d items", *self.maxItems))
+		}
+		if self.items != nil {
+			for i, item := range value {
+				self.items.check(item, pointer + jsonPointer(fmt.Sprint(i)), errs)
+			}
+		}
+
+	case string:
+		length := utf8.RuneCountInString(value)
+		if self.minLength != nil && length < *self.minLength {
+			fail(fmt.Sprintf("must have at least %d characters", *self.minLength))
+		}
+		if self.maxLength != nil && length > *self.maxLength {
+			fail(fmt.Sprintf("must have at most %d characters", *self.maxLength))
+		}
+		if self.pattern != nil && !self.pattern.MatchString(value) {
+			fail(fmt.Sprintf("must match pattern `%s`", self.pattern.String()))
+		}
+
+	case json.Number:
+		n, _ := value.Float64()
+		if self.minimum != nil && n < *self.minimum {
+			fail(fmt.Sprintf("must be at least %v", *self.minimum))
+		}
+		if self.maximum != nil && n > *self.maximum {
+			fail(fmt.Sprintf("must be at most %v", *self.maximum))
+		}
+		if self.exclusiveMinimum != nil && n <= *self.exclusiveMinimum {
+			fail(fmt.Sprintf("must be greater than %v", *self.exclusiveMinimum))
+		}
+		if self.exclusiveMaximum != nil && n >= *self.exclusiveMaximum {
+			fail(fmt.Sprintf("must be less than %v", *self.exclusiveMaximum))
+		}
+	}
+}
+
+// Create an empty SchemaRegistry
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{ schemas: make(map[string]*Schema) }
+}
+
+// Register the schema of a stone type, replacing any schema
+// already registered for it
+func (self *SchemaRegistry) Register(stoneType string, schema *Schema) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.schemas[stoneType] = schema
+}
+
+// Returns the schema of a stone type
+func (self *SchemaRegistry) Lookup(stoneType string) (*Schema, bool) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	schema, ok := self.schemas[stoneType]
+	return schema, ok
+}
+
+// Returns the stone types with a schema in sorted order
+func (self *SchemaRegistry) Types() []string {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	var types []string
+	for stoneType, _ := range self.schemas {
+		types = append(types, stoneType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Register the schemas found in a directory. Each `<type>.json`
+// file holds the schema of the stone type named by the file.
+func (self *SchemaRegistry) LoadDir(dir string) error {
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		schema, err := LoadSchemaFile(file)
+		if err != nil {
+			return err
+		}
+		self.Register(strings.TrimSuffix(filepath.Base(file), ".json"), schema)
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package stone
+
+import (
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"github.com/ellcrys/util"
+)
+
+// TestCompileSchemaUnsupportedKeyword tests that schemas using unsupported keywords are rejected
+func TestCompileSchemaUnsupportedKeyword(t *testing.T) {
+	_, err := CompileSchema([]byte(`{ "type": "object", "properties": { "a": { "$ref": "#/defs/a" } } }`))
+	assert.NotNil(t, err)
+	assert.Equal(t, "invalid schema at `/properties/a/$ref`: keyword `$ref` is not supported", err.Error())
+}
+
+// TestCompileSchemaInvalid tests that malformed schemas are rejected
+func TestCompileSchemaInvalid(t *testing.T) {
+	var cases = map[string]string{
+		`{ "type": "money" }`: "invalid schema at `/type`: unknown type `money`",
+		`{ "minLength": -1 }`: "invalid schema at `/minLength`: expects a non-negative integer",
+		`{ "pattern": "[" }`: "invalid schema at `/pattern`: invalid regular expression",
+		`[]`: "invalid schema: a schema must be an object or a boolean",
+	}
+	for schemaJSON, expected := range cases {
+		_, err := CompileSchema([]byte(schemaJSON))
+		assert.NotNil(t, err)
+		assert.Equal(t, expected, err.Error())
+	}
+}
+
+// TestSchemaValidate tests that values are checked against each supported keyword
+func TestSchemaValidate(t *testing.T) {
+	schema, err := LoadSchemaFile("tests/fixtures/schemas/currency.json")
+	assert.Nil(t, err)
+
+	assert.Nil(t, schema.Validate(map[string]interface{}{ "amount": 10, "currency": "USD" }))
+	assert.Nil(t, schema.Validate(map[string]interface{}{ "amount": 0.5, "currency": "EUR", "memo": "lunch" }))
+
+	err = schema.Validate(map[string]interface{}{ "amount": "10", "currency": "usd", "note": true })
+	assert.NotNil(t, err)
+	errs := err.(ValidationErrors)
+	assert.Equal(t, 3, len(errs))
+	assert.Equal(t, "value at `/amount` must be of type number", errs[0].Message)
+	assert.Equal(t, "value at `/currency` must match pattern `^[A-Z]{3}$`", errs[1].Message)
+	assert.Equal(t, "value at `/note` is not allowed", errs[2].Message)
+	assert.Equal(t, CodeSchemaViolation, errs[0].Code)
+
+	err = schema.Validate(map[string]interface{}{ "amount": 0, "currency": "USD" })
+	assert.NotNil(t, err)
+	assert.Equal(t, "value at `/amount` must be greater than 0", err.Error())
+}
+
+// TestSchemaValidateArraysAndEnums tests the `items`, `minItems`, `enum` and `const` keywords
+func TestSchemaValidateArraysAndEnums(t *testing.T) {
+	schema, err := CompileSchema([]byte(`{ "type": "array", "minItems": 1, "items": { "enum": ["gold", "silver", 1] } }`))
+	assert.Nil(t, err)
+	assert.Nil(t, schema.Validate([]interface{}{ "gold", 1.0 }))
+
+	err = schema.Validate([]string{})
+	assert.NotNil(t, err)
+	assert.Equal(t, "value must have at least 1 items", err.Error())
+
+	err = schema.Validate([]string{ "gold", "bronze" })
+	assert.NotNil(t, err)
+	assert.Equal(t, "value at `/1` must be one of \"gold\", \"silver\", 1", err.Error())
+
+	schema, _ = CompileSchema([]byte(`{ "const": { "kind": "voucher" } }`))
+	assert.Nil(t, schema.Validate(map[string]interface{}{ "kind": "voucher" }))
+	assert.NotNil(t, schema.Validate(map[string]interface{}{ "kind": "coupon" }))
+}
+
+// TestSchemaRegistryLoadDir tests that schemas are registered by file name
+func TestSchemaRegistryLoadDir(t *testing.T) {
+	registry := NewSchemaRegistry()
+	assert.Nil(t, registry.LoadDir("tests/fixtures/schemas"))
+	assert.Equal(t, []string{ "currency" }, registry.Types())
+	_, ok := registry.Lookup("currency")
+	assert.True(t, ok)
+	_, ok = registry.Lookup("coupon")
+	assert.False(t, ok)
+}
+
+// TestValidatorWithSchemas tests that attributes of a stone type with a schema must satisfy it
+func TestValidatorWithSchemas(t *testing.T) {
+	validator := NewValidator()
+	validator.Schemas = NewSchemaRegistry()
+	assert.Nil(t, validator.Schemas.LoadDir("tests/fixtures/schemas"))
+
+	id := util.Sha1("abcd")
+	d := map[string]interface{}{
+		"meta": map[string]interface{}{ "id": id, "type": "currency", "created_at": time.Now().Unix() },
+	}
+	err := validator.Validate(d)
+	assert.NotNil(t, err)
+	assert.Equal(t, "/attributes", err.(*ValidationError).Pointer)
+	assert.Equal(t, "`attributes` block is required by the `currency` schema", err.Error())
+
+	d["attributes"] = map[string]interface{}{ "ref_id": id, "data": map[string]interface{}{ "currency": "USD" } }
+	err = validator.Validate(d)
+	assert.NotNil(t, err)
+	assert.Equal(t, "/attributes/data/amount", err.(*ValidationError).Pointer)
+	assert.Equal(t, "attributes", err.(*ValidationError).Block)
+	assert.Equal(t, "`attributes.data` does not satisfy the `currency` schema: property `/amount` is required", err.Error())
+
+	d["attributes"].(map[string]interface{})["data"].(map[string]interface{})["amount"] = 25
+	assert.Nil(t, validator.Validate(d))
+
+	// stones of other types are not affected
+	d["meta"].(map[string]interface{})["type"] = "coupon"
+	delete(d, "attributes")
+	assert.Nil(t, validator.Validate(d))
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"crypto"
+	"errors"
+	"sync"
+	"github.com/stonedoc/stone"
+)
+
+// Returned by a Keystore when it has no key with the requested id
+var ErrKeyNotFound = errors.New("key not found")
+
+// A Keystore holds the issuer keys used by the server. Keys are
+// looked up by id; the id is also set as the `kid` header of the
+// signatures the server produces.
+type Keystore interface {
+
+	// Returns the signer of a key
+	Signer(keyID string) (stone.Signer, error)
+
+	// Returns the public key of a key
+	PublicKey(keyID string) (crypto.PublicKey, error)
+}
+
+// MemoryKeystore is a Keystore holding keys in memory.
+// It is safe for concurrent use.
+type MemoryKeystore struct {
+	mu      sync.RWMutex
+	signers map[string]stone.Signer
+}
+
+// Create an empty MemoryKeystore
+func NewMemoryKeystore() *MemoryKeystore {
+	return &MemoryKeystore{ signers: make(map[string]stone.Signer) }
+}
+
+// Add a key, replacing any key with the same id
+func (self *MemoryKeystore) Add(keyID string, signer stone.Signer) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.signers[keyID] = signer
+}
+
+// Add a PEM encoded private key
+func (self *MemoryKeystore) AddPEM(keyID, privateKey string) error {
+	signer, err := stone.ParsePrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	self.Add(keyID, signer)
+	return nil
+}
+
+// Returns the signer of a key
+func (self *MemoryKeystore) Signer(keyID string) (stone.Signer, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	signer, ok := self.signers[keyID]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return signer, nil
+}
+
+// Returns the public key of a key
+func (self *MemoryKeystore) PublicKey(keyID string) (crypto.PublicKey, error) {
+	signer, err := self.Signer(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Public(), nil
+}
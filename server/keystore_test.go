@@ -0,0 +1,33 @@
+package server
+
+import (
+	"testing"
+	"github.com/ellcrys/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stonedoc/stone"
+)
+
+// TestMemoryKeystore tests adding and looking up keys
+func TestMemoryKeystore(t *testing.T) {
+	keystore := NewMemoryKeystore()
+	err := keystore.AddPEM("issuer", util.ReadFromFixtures("../tests/fixtures/rsa_priv_1.txt"))
+	assert.Nil(t, err)
+
+	signer, err := keystore.Signer("issuer")
+	assert.Nil(t, err)
+	assert.Equal(t, stone.RS256, signer.Algorithm())
+
+	publicKey, err := keystore.PublicKey("issuer")
+	assert.Nil(t, err)
+	expected, _ := stone.ParsePublicKey(util.ReadFromFixtures("../tests/fixtures/rsa_pub_1.txt"))
+	assert.Equal(t, expected, publicKey)
+
+	_, err = keystore.Signer("unknown")
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+// TestMemoryKeystoreWithInvalidKey tests that an invalid PEM key is rejected
+func TestMemoryKeystoreWithInvalidKey(t *testing.T) {
+	err := NewMemoryKeystore().AddPEM("issuer", util.ReadFromFixtures("../tests/fixtures/rsa_invalid_1.txt"))
+	assert.NotNil(t, err)
+}
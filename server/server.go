@@ -0,0 +1,319 @@
+// Package server exposes stone issuance and verification over HTTP.
+//
+//  Endpoints (all POST, JSON request and response bodies):
+//
+//  /stones             create a stone:            { "key_id", "meta" }
+//  /stones/ownership   set the ownership block:   { "key_id", "stone", "block" }
+//  /stones/attributes  set the attributes block:  { "key_id", "stone", "block" }
+//  /stones/embeds      set the embeds block:      { "key_id", "stone", "block" }
+//  /encode             encode a stone:            { "stone" }
+//  /decode             decode an encoded stone:   { "encoded" }
+//  /verify             verify an encoded stone:   { "encoded" }
+//
+// Stones are returned as { "stone", "encoded" }. Signatures carry the
+// keystore key id as `kid`; /verify resolves keys by it. Errors are
+// returned as { "error": { "code", "message", ... } }, with the code,
+// pointer, block and embed path of validation errors. Request bodies
+// larger than MaxRequestSize are rejected.
+package server
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"github.com/stonedoc/stone"
+)
+
+// The maximum size of a request body in bytes
+const MaxRequestSize = 1 << 20
+
+// Error codes of errors that are not validation errors
+const (
+	CodeBadRequest       = "bad_request"
+	CodeKeyNotFound      = "key_not_found"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeRequestTooLarge  = "request_too_large"
+	CodeValidationFailed = "validation_failed"
+	CodeKeystoreError    = "keystore_error"
+)
+
+// Server is an http.Handler serving the stone endpoints
+type Server struct {
+	keystore Keystore
+	issuer   string
+	mux      *http.ServeMux
+}
+
+// request is the body of a request
+type request struct {
+	KeyID   string                 `json:"key_id"`
+	Meta    map[string]interface{} `json:"meta"`
+	Stone   json.RawMessage        `json:"stone"`
+	Block   map[string]interface{} `json:"block"`
+	Encoded string                 `json:"encoded"`
+}
+
+// stoneResponse is the body of a response holding a stone
+type stoneResponse struct {
+	Stone   json.RawMessage `json:"stone"`
+	Encoded string          `json:"encoded"`
+}
+
+// errorBody describes an error
+type errorBody struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Pointer   *string     `json:"pointer,omitempty"`
+	Block     string      `json:"block,omitempty"`
+	EmbedPath []int       `json:"embed_path,omitempty"`
+	Errors    []errorBody `json:"errors,omitempty"`
+}
+
+// httpError is an error with the HTTP status and code to report it with
+type httpError struct {
+	status int
+	code   string
+	err    error
+}
+
+// Returns the error message
+func (self *httpError) Error() string {
+	return self.err.Error()
+}
+
+// Create a server using the keys of the keystore. The issuer, if not
+// empty, is set as the `iss` header of the signatures produced.
+func New(keystore Keystore, issuer string) *Server {
+	s := &Server{ keystore: keystore, issuer: issuer, mux: http.NewServeMux() }
+	s.handle("/stones", s.create)
+	s.handle("/stones/ownership", s.addBlock("ownership"))
+	s.handle("/stones/attributes", s.addBlock("attributes"))
+	s.handle("/stones/embeds", s.addBlock("embeds"))
+	s.handle("/encode", s.encode)
+	s.handle("/decode", s.decode)
+	s.handle("/verify", s.verify)
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, &httpError{ http.StatusNotFound, CodeNotFound, errors.New("endpoint not found") })
+	})
+	return s
+}
+
+// Serve a request
+func (self *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	self.mux.ServeHTTP(w, r)
+}
+
+// Register a POST endpoint. The handler is passed the decoded request
+// body; its result is written as JSON, its error as an error body.
+func (self *Server) handle(path string, handler func(req *request) (interface{}, error)) {
+	self.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, &httpError{ http.StatusMethodNotAllowed, CodeMethodNotAllowed, errors.New("method not allowed") })
+			return
+		}
+
+		var req request
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxRequestSize))
+		decoder.UseNumber()
+		if err := decoder.Decode(&req); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, &httpError{ http.StatusRequestEntityTooLarge, CodeRequestTooLarge, errors.New("request body is too large") })
+				return
+			}
+			writeError(w, badRequest("unable to parse request body"))
+			return
+		}
+
+		res, err := handler(&req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		status := http.StatusOK
+		if path == "/stones" {
+			status = http.StatusCreated
+		}
+		writeJSON(w, status, res)
+	})
+}
+
+// Returns a bad request error
+func badRequest(message string) error {
+	return &httpError{ http.StatusBadRequest, CodeBadRequest, errors.New(message) }
+}
+
+// Returns the signer of the requested key. The signer sets
+// the key id and the server's issuer on its signatures.
+func (self *Server) signer(keyID string) (stone.Signer, error) {
+	if keyID == "" {
+		return nil, badRequest("`key_id` is required")
+	}
+	signer, err := self.keystore.Signer(keyID)
+	if err == ErrKeyNotFound {
+		return nil, &httpError{ http.StatusNotFound, CodeKeyNotFound, errors.New("key `" + keyID + "` not found") }
+	} else if err != nil {
+		return nil, &httpError{ http.StatusInternalServerError, CodeKeystoreError, err }
+	}
+	return stone.WithIdentity(signer, self.issuer, keyID), nil
+}
+
+// Returns the stone of a request
+func loadStone(req *request) (*stone.Stone, error) {
+	if len(req.Stone) == 0 {
+		return nil, badRequest("`stone` is required")
+	}
+	return stone.Load(string(req.Stone))
+}
+
+// Returns the response of a stone
+func newStoneResponse(s *stone.Stone) *stoneResponse {
+	return &stoneResponse{ Stone: json.RawMessage(s.JSON()), Encoded: s.Encode() }
+}
+
+// Create a stone from a meta block
+func (self *Server) create(req *request) (interface{}, error) {
+
+	if req.Meta == nil {
+		return nil, badRequest("`meta` is required")
+	}
+
+	signer, err := self.signer(req.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := stone.CreateWith(req.Meta, signer)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStoneResponse(s), nil
+}
+
+// Returns a handler setting and signing a block of a stone
+func (self *Server) addBlock(blockName string) func(req *request) (interface{}, error) {
+	return func(req *request) (interface{}, error) {
+
+		if req.Block == nil {
+			return nil, badRequest("`block` is required")
+		}
+
+		signer, err := self.signer(req.KeyID)
+		if err != nil {
+			return nil, err
+		}
+
+		s, err := loadStone(req)
+		if err != nil {
+			return nil, err
+		}
+
+		switch blockName {
+		case "ownership":
+			err = s.AddOwnershipWith(req.Block, signer)
+		case "attributes":
+			err = s.AddAttributesWith(req.Block, signer)
+		case "embeds":
+			err = s.AddEmbedWith(req.Block, signer)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return newStoneResponse(s), nil
+	}
+}
+
+// Encode a stone
+func (self *Server) encode(req *request) (interface{}, error) {
+
+	s, err := loadStone(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{ "encoded": s.Encode() }, nil
+}
+
+// Decode an encoded stone. Signatures are not verified.
+func (self *Server) decode(req *request) (interface{}, error) {
+
+	if req.Encoded == "" {
+		return nil, badRequest("`encoded` is required")
+	}
+
+	s, err := stone.Decode(req.Encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStoneResponse(s), nil
+}
+
+// Decode an encoded stone and verify the signature of every block
+// with the keystore key named by the signature's `kid`.
+func (self *Server) verify(req *request) (interface{}, error) {
+
+	if req.Encoded == "" {
+		return nil, badRequest("`encoded` is required")
+	}
+
+	s, err := stone.DecodeAndVerifyWith(req.Encoded, stone.PublicKeyResolverFunc(func(issuer, keyID string) (crypto.PublicKey, error) {
+		return self.keystore.PublicKey(keyID)
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	return newStoneResponse(s), nil
+}
+
+// Write a value as JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Returns the body of a validation error
+func validationErrorBody(err *stone.ValidationError) errorBody {
+	pointer := err.Pointer
+	return errorBody{
+		Code: err.Code,
+		Message: err.Error(),
+		Pointer: &pointer,
+		Block: err.Block,
+		EmbedPath: err.EmbedPath,
+	}
+}
+
+// Write an error. Validation errors and errors of the stone
+// package are reported as bad requests.
+func writeError(w http.ResponseWriter, err error) {
+
+	var status = http.StatusBadRequest
+	var body errorBody
+
+	switch e := err.(type) {
+	case *httpError:
+		status = e.status
+		body = errorBody{ Code: e.code, Message: e.Error() }
+	case *stone.ValidationError:
+		body = validationErrorBody(e)
+	case stone.ValidationErrors:
+		body = errorBody{ Code: CodeValidationFailed, Message: e.Error() }
+		for _, verr := range e {
+			body.Errors = append(body.Errors, validationErrorBody(verr))
+		}
+	default:
+		body = errorBody{ Code: CodeBadRequest, Message: err.Error() }
+	}
+
+	writeJSON(w, status, map[string]interface{}{ "error": body })
+}
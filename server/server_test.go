@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"github.com/ellcrys/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// Create a server with the fixture keys `issuer` and `other`
+func newTestServer() *Server {
+	keystore := NewMemoryKeystore()
+	keystore.AddPEM("issuer", util.ReadFromFixtures("../tests/fixtures/rsa_priv_1.txt"))
+	keystore.AddPEM("other", util.ReadFromFixtures("../tests/fixtures/ec_p256_priv_1.txt"))
+	return New(keystore, "https://issuer.example")
+}
+
+// Send a POST request and decode the response body
+func post(t *testing.T, srv *Server, path string, body interface{}) (int, map[string]interface{}) {
+	bs, _ := json.Marshal(body)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(bs)))
+	res, err := util.JSONToMap(rec.Body.String())
+	assert.Nil(t, err)
+	return rec.Code, res
+}
+
+// Create a stone through the server
+func createStone(t *testing.T, srv *Server) (string, map[string]interface{}) {
+	metaID := util.NewID()
+	status, res := post(t, srv, "/stones", map[string]interface{}{
+		"key_id": "issuer",
+		"meta": map[string]interface{}{
+			"id": metaID,
+			"type": "coupon",
+			"created_at": time.Now().Unix(),
+		},
+	})
+	assert.Equal(t, http.StatusCreated, status)
+	return metaID, res
+}
+
+// TestCreateAndVerify tests that a created stone verifies with the keystore keys
+func TestCreateAndVerify(t *testing.T) {
+	srv := newTestServer()
+	metaID, res := createStone(t, srv)
+
+	status, res := post(t, srv, "/stones/attributes", map[string]interface{}{
+		"key_id": "other",
+		"stone": res["stone"],
+		"block": map[string]interface{}{ "ref_id": metaID, "data": map[string]interface{}{ "value": 10 } },
+	})
+	assert.Equal(t, http.StatusOK, status)
+
+	status, res = post(t, srv, "/verify", map[string]interface{}{ "encoded": res["encoded"] })
+	assert.Equal(t, http.StatusOK, status)
+	stone := res["stone"].(map[string]interface{})
+	assert.Equal(t, metaID, stone["meta"].(map[string]interface{})["id"])
+	assert.NotNil(t, stone["attributes"].(map[string]interface{})["data"])
+}
+
+// TestVerifyWithUnknownKey tests that verification fails when the keystore lacks the signing key
+func TestVerifyWithUnknownKey(t *testing.T) {
+	_, res := createStone(t, newTestServer())
+	status, res := post(t, New(NewMemoryKeystore(), ""), "/verify", map[string]interface{}{ "encoded": res["encoded"] })
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "unable to resolve key for `meta` block: key not found", res["error"].(map[string]interface{})["message"])
+}
+
+// TestValidationErrorResponse tests that validation errors are reported with their code and pointer
+func TestValidationErrorResponse(t *testing.T) {
+	srv := newTestServer()
+	_, res := createStone(t, srv)
+	status, res := post(t, srv, "/stones/ownership", map[string]interface{}{
+		"key_id": "issuer",
+		"stone": res["stone"],
+		"block": map[string]interface{}{ "ref_id": "abc", "type": "sole", "sole": map[string]interface{}{ "address_id": "alice" } },
+	})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, map[string]interface{}{
+		"code": "ref_id_mismatch",
+		"message": "`ownership.ref_id` not equal to `meta.id`",
+		"pointer": "/ownership/ref_id",
+		"block": "ownership",
+	}, res["error"])
+}
+
+// TestUnknownSigningKey tests that an unknown key id is reported as not found
+func TestUnknownSigningKey(t *testing.T) {
+	status, res := post(t, newTestServer(), "/stones", map[string]interface{}{
+		"key_id": "nobody",
+		"meta": map[string]interface{}{},
+	})
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, CodeKeyNotFound, res["error"].(map[string]interface{})["code"])
+}
+
+// TestEncodeDecode tests the encode and decode endpoints
+func TestEncodeDecode(t *testing.T) {
+	srv := newTestServer()
+	metaID, res := createStone(t, srv)
+	status, encoded := post(t, srv, "/encode", map[string]interface{}{ "stone": res["stone"] })
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, res["encoded"], encoded["encoded"])
+
+	status, res = post(t, srv, "/decode", map[string]interface{}{ "encoded": encoded["encoded"] })
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, metaID, res["stone"].(map[string]interface{})["meta"].(map[string]interface{})["id"])
+}
+
+// TestRequestTooLarge tests that request bodies larger than MaxRequestSize are rejected
+func TestRequestTooLarge(t *testing.T) {
+	status, res := post(t, newTestServer(), "/decode", map[string]interface{}{ "encoded": strings.Repeat("a", MaxRequestSize) })
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+	assert.Equal(t, CodeRequestTooLarge, res["error"].(map[string]interface{})["code"])
+}
+
+// TestMethodNotAllowed tests that only POST requests are accepted
+func TestMethodNotAllowed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newTestServer().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stones", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+}
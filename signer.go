@@ -0,0 +1,135 @@
+package stone
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/asn1"
+	"math/big"
+)
+
+// A Signer produces JWS signatures for blocks. Implementations
+// can keep the private key in an HSM, a KMS or an in-process keyring;
+// the key never has to be serialized to PEM.
+type Signer interface {
+
+	// The JWS algorithm of the signatures produced (e.g RS256, ES256).
+	Algorithm() string
+
+	// The public key of the signing key.
+	Public() crypto.PublicKey
+
+	// Sign the JWS signing input (the base64url encoded header and
+	// payload joined by a dot) and return the raw JWS signature.
+	SignInput(signingInput []byte) ([]byte, error)
+}
+
+// An IdentifiedSigner is a Signer that names its key and issuer.
+// Its key id and issuer are set as the `kid` and `iss` headers of the
+// signatures it produces. An empty key id defaults to the thumbprint
+// of the public key; an empty issuer is omitted.
+type IdentifiedSigner interface {
+	Signer
+	KeyID() string
+	Issuer() string
+}
+
+// identifiedSigner attaches a key id and issuer to a Signer
+type identifiedSigner struct {
+	Signer
+	keyID  string
+	issuer string
+}
+
+// cryptoSigner adapts a crypto.Signer to a Signer
+type cryptoSigner struct {
+	signer crypto.Signer
+	alg    string
+}
+
+// ecdsaSignature is the ASN.1 form of an ECDSA signature
+// returned by crypto.Signer implementations
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// Create a Signer from a crypto.Signer. RSA, ECDSA (P-256, P-384) and
+// Ed25519 keys are supported; the algorithm is chosen from the key type.
+func NewSigner(signer crypto.Signer) (Signer, error) {
+	alg, err := algorithmForKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &cryptoSigner{ signer: signer, alg: alg }, nil
+}
+
+// Parse a PEM encoded private key into a Signer. Parsing a key
+// once and reusing the Signer avoids parsing it on every call.
+func ParsePrivateKey(privateKey string) (Signer, error) {
+	key, err := parsePrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner(key)
+}
+
+// Parse a PEM encoded public key.
+func ParsePublicKey(publicKey string) (crypto.PublicKey, error) {
+	return parsePublicKey(publicKey)
+}
+
+// Returns a Signer that sets the given issuer and key id on the
+// signatures it produces. An empty key id defaults to the thumbprint
+// of the public key.
+func WithIdentity(signer Signer, issuer, keyID string) Signer {
+	return &identifiedSigner{ Signer: signer, keyID: keyID, issuer: issuer }
+}
+
+// Returns the key id
+func (self *identifiedSigner) KeyID() string {
+	return self.keyID
+}
+
+// Returns the issuer
+func (self *identifiedSigner) Issuer() string {
+	return self.issuer
+}
+
+// Returns the JWS algorithm
+func (self *cryptoSigner) Algorithm() string {
+	return self.alg
+}
+
+// Returns the public key
+func (self *cryptoSigner) Public() crypto.PublicKey {
+	return self.signer.Public()
+}
+
+// Hash and sign the signing input
+func (self *cryptoSigner) SignInput(signingInput []byte) ([]byte, error) {
+
+	var digest = signingInput
+	var hash = algorithmHash(self.alg)
+	if hash != 0 {
+		h := hash.New()
+		h.Write(signingInput)
+		digest = h.Sum(nil)
+	}
+
+	sig, err := self.signer.Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	// ECDSA signers produce ASN.1 signatures, JWS expects R || S
+	if self.alg == ES256 || self.alg == ES384 {
+		var ecSig ecdsaSignature
+		if _, err := asn1.Unmarshal(sig, &ecSig); err != nil {
+			return nil, err
+		}
+		size := (self.signer.Public().(*ecdsa.PublicKey).Curve.Params().BitSize + 7) / 8
+		sig = append(ecSig.R.FillBytes(make([]byte, size)), ecSig.S.FillBytes(make([]byte, size))...)
+	}
+
+	return sig, nil
+}
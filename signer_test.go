@@ -0,0 +1,105 @@
+package stone
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"github.com/ellcrys/util"
+)
+
+// countingSigner wraps a Signer and counts the signing operations,
+// standing in for a key held in an HSM or KMS
+type countingSigner struct {
+	Signer
+	calls int
+}
+
+func (self *countingSigner) SignInput(signingInput []byte) ([]byte, error) {
+	self.calls++
+	return self.Signer.SignInput(signingInput)
+}
+
+// TestNewSignerWithUnsupportedCurve tests that a key on an unsupported curve is rejected
+func TestNewSignerWithUnsupportedCurve(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	assert.Nil(t, err)
+	_, err = NewSigner(key)
+	assert.NotNil(t, err)
+	assert.Equal(t, "unsupported elliptic curve P-521", err.Error())
+}
+
+// TestCreateWithSigner tests that a stone can be created and verified with
+// in-memory keys without serializing them to PEM
+func TestCreateWithSigner(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	signer, err := NewSigner(priv)
+	assert.Nil(t, err)
+	assert.Equal(t, EdDSA, signer.Algorithm())
+
+	var meta = map[string]interface{}{
+		"id": util.NewID(),
+		"type": "currency",
+		"created_at": time.Now().Unix(),
+	}
+	sh, err := CreateWith(meta, signer)
+	assert.Nil(t, err)
+	assert.Nil(t, sh.VerifyWith("meta", pub))
+
+	var ownership = map[string]interface{}{
+		"ref_id": sh.Meta["id"],
+		"type": "sole",
+		"sole": map[string]interface{}{
+			"address_id": "abcde",
+		},
+	}
+	assert.Nil(t, sh.AddOwnershipWith(ownership, signer))
+	assert.Nil(t, sh.VerifyWith("ownership", pub))
+}
+
+// TestSignWithCustomSigner tests that a Signer implementation is used for every signature
+func TestSignWithCustomSigner(t *testing.T) {
+	key, err := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	assert.Nil(t, err)
+	signer := &countingSigner{ Signer: key }
+	sh := NewValidStone()
+	_, err = sh.SignWith("meta", signer)
+	assert.Nil(t, err)
+	var attrs = map[string]interface{}{
+		"ref_id": sh.Meta["id"],
+		"data": "abc",
+	}
+	assert.Nil(t, sh.AddAttributesWith(attrs, signer))
+	assert.Equal(t, 2, signer.calls)
+
+	publicKey, err := ParsePublicKey(util.ReadFromFixtures("tests/fixtures/ec_p256_pub_1.txt"))
+	assert.Nil(t, err)
+	assert.Nil(t, sh.VerifyWith("meta", publicKey))
+	assert.Nil(t, sh.VerifyWith("attributes", publicKey))
+}
+
+// TestSignWithNilSigner tests that a signer is required
+func TestSignWithNilSigner(t *testing.T) {
+	sh := NewValidStone()
+	_, err := sh.SignWith("meta", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "signer is required", err.Error())
+}
+
+// TestDecodeAndVerifyWith tests that an encoded stone can be verified with a public key resolver
+func TestDecodeAndVerifyWith(t *testing.T) {
+	sh := NewValidStone()
+	publicKey, err := ParsePublicKey(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt"))
+	assert.Nil(t, err)
+	resolver := PublicKeyResolverFunc(func(issuer, keyID string) (crypto.PublicKey, error) {
+		return publicKey, nil
+	})
+	decStone, err := DecodeAndVerifyWith(sh.Encode(), resolver)
+	assert.Nil(t, err)
+	assert.Equal(t, sh.Meta["id"], decStone.Meta["id"])
+}
@@ -4,6 +4,7 @@
 package stone
 
 import (
+	gocrypto "crypto"
 	"encoding/json"
 	"errors"
 	"strings"
@@ -12,7 +13,8 @@ import (
 	"github.com/ellcrys/util"
 )
 
-// The list of recognized blocks.
+// The list of built-in blocks. See BlockNames for
+// the list including registered custom blocks.
 var KnownBlockNames = []string{ "meta", "ownership", "attributes", "embeds" }
 
 type Stone struct {
@@ -21,6 +23,16 @@ type Stone struct {
 	Embeds 		map[string]interface{} 		`json:"embeds"`
 	Attributes 	map[string]interface{}		`json:"attributes"`
 	Signatures 	map[string]interface{} 		`json:"signatures"`
+
+	// custom blocks (see RegisterBlock) keyed by name
+	Blocks 		map[string]map[string]interface{}	`json:"-"`
+
+	// format version (see CurrentFormatVersion)
+	Version 	int 						`json:"version,omitempty"`
+
+	// CBOR encoded COSE_Sign1 signatures of blocks keyed by block
+	// name, set by DecodeCBOR and EncodeCBOR when signers are used
+	CoseSignatures 	map[string][]byte 		`json:"-"`
 }
 
 // Initialize a stone
@@ -30,6 +42,9 @@ func initialize(stone *Stone) *Stone {
 	stone.Embeds 		= make(map[string]interface{})
 	stone.Attributes 	= make(map[string]interface{})
 	stone.Signatures 	= make(map[string]interface{})
+	stone.Blocks 		= make(map[string]map[string]interface{})
+	stone.Version 		= CurrentFormatVersion
+	stone.CoseSignatures 	= make(map[string][]byte)
 	return stone
 }
 
@@ -42,17 +57,40 @@ func Empty() *Stone {
 // Create a stone with an inital meta block.
 // The new stone is immediately signed using the issuer private key.
 func Create(meta map[string]interface{}, issuerPrivateKey string) (*Stone, error) {
+	return defaultValidator().Create(meta, issuerPrivateKey)
+}
+
+// Create a stone with an inital meta block.
+// The new stone is immediately signed using the issuer's signer.
+func CreateWith(meta map[string]interface{}, issuer Signer) (*Stone, error) {
+	return defaultValidator().CreateWith(meta, issuer)
+}
+
+// Create a stone with a meta block validated according to the
+// validator's policy. See the package level Create.
+func (self *Validator) Create(meta map[string]interface{}, issuerPrivateKey string) (*Stone, error) {
+
+	signer, err := parseSigner(issuerPrivateKey)
+	if err != nil {
+		return &Stone{}, err
+	}
+
+	return self.CreateWith(meta, signer)
+}
+
+// Create a stone using the issuer's signer. See Validator.Create.
+func (self *Validator) CreateWith(meta map[string]interface{}, issuer Signer) (*Stone, error) {
 
 	stone := initialize(&Stone{})
 
 	// validate meta
-	if err := ValidateMetaBlock(meta); err != nil {
+	if err := self.ValidateMetaBlock(meta); err != nil {
     	return &Stone{}, err
     }
     
     // set stone Meta field and create a meta signature
 	stone.Meta = meta
-	_, err := stone.Sign("meta", issuerPrivateKey)
+	_, err := stone.SignWith("meta", issuer)
 	if err != nil {
 		return &Stone{}, err
 	}
@@ -61,34 +99,46 @@ func Create(meta map[string]interface{}, issuerPrivateKey string) (*Stone, error
 }
 
 // Creates a stone from a map data structure. Validation is not performed. 
+// An error is returned if a block is set but is not a JSON object.
 func loadMap(data map[string]interface{}) (*Stone, error) {
 
 	var stone = initialize(&Stone{})
 
-    // add meta
-    if meta := data["meta"]; meta != nil {
-    	stone.Meta = data["meta"].(map[string]interface{})
-    }
-
-    // add ownership
-    if ownership := data["ownership"]; ownership != nil {
-    	stone.Ownership = data["ownership"].(map[string]interface{})
-    }
+	var fields = map[string]*map[string]interface{}{
+		"meta": &stone.Meta,
+		"ownership": &stone.Ownership,
+		"attributes": &stone.Attributes,
+		"embeds": &stone.Embeds,
+		"signatures": &stone.Signatures,
+	}
 
-    // add attributes
-    if attributes := data["attributes"]; attributes != nil {
-    	stone.Attributes = data["attributes"].(map[string]interface{})
-    }
+	for name, field := range fields {
+		if data[name] == nil {
+			continue
+		}
+		block, ok := data[name].(map[string]interface{})
+		if !ok {
+			return &Stone{}, errors.New(fmt.Sprintf("`%s` block value type is invalid. Expects a JSON object", name))
+		}
+		*field = block
+	}
 
-    // add embeds
-    if embeds := data["embeds"]; embeds != nil {
-    	stone.Embeds = data["embeds"].(map[string]interface{})
-    }
+	for _, name := range CustomBlockNames() {
+		if data[name] == nil {
+			continue
+		}
+		block, ok := data[name].(map[string]interface{})
+		if !ok {
+			return &Stone{}, errors.New(fmt.Sprintf("`%s` block value type is invalid. Expects a JSON object", name))
+		}
+		stone.Blocks[name] = block
+	}
 
-    // add signatures
-    if signatures := data["signatures"]; signatures != nil {
-    	stone.Signatures = data["signatures"].(map[string]interface{})
-    }
+	version, ok := formatVersion(data["version"])
+	if !ok {
+		return &Stone{}, errors.New("format version is not supported")
+	}
+	stone.Version = version
 
     return stone, nil
 }
@@ -109,6 +159,12 @@ func Load(stoneStr string) (*Stone, error) {
 // Given a json string representing a stone, It creates
 // a new stone object.
 func LoadJSON(jsonStr string) (*Stone, error) {
+	return defaultValidator().LoadJSON(jsonStr)
+}
+
+// Creates a stone from a json string validated according to the
+// validator's policy. See the package level LoadJSON.
+func (self *Validator) LoadJSON(jsonStr string) (*Stone, error) {
 
 	data, err := util.JSONToMap(jsonStr)
 	if err != nil{
@@ -116,14 +172,15 @@ func LoadJSON(jsonStr string) (*Stone, error) {
     }
     
     // validate...
-    if err := Validate(data); err != nil {
+    if err := self.Validate(data); err != nil {
     	return &Stone{}, err
     }
 
 	return loadMap(data)  
 }
 
-// Decode a base64 encoded stone token
+// Decode a base64 encoded stone token. Tokens of any supported
+// format version are decoded; the stone keeps the token's version.
 func Decode(encStone string) (*Stone, error) {
 
 	var stone = Empty()
@@ -140,63 +197,273 @@ func Decode(encStone string) (*Stone, error) {
 		return &Stone{}, errors.New("failed to parse token")
 	}
 
-	// parse and load meta block
-	if util.IsStringValue(stoneMap["meta"]) && stoneMap["meta"].(string) != "" {
+	version, ok := formatVersion(stoneMap["version"])
+	if !ok {
+		return &Stone{}, errors.New("format version is not supported")
+	}
+	stone.Version = version
 
-		var token = stoneMap["meta"].(string);
+	// load the disclosures of selectively disclosable attributes
+	if stoneMap["disclosures"] != nil {
+		if !isStringSlice(stoneMap["disclosures"]) {
+			return stone, errors.New("malformed disclosures")
+		}
+		stone.Signatures["disclosures"] = stoneMap["disclosures"]
+	}
+
+	// parse and load the signed blocks
+	for _, blockName := range BlockNames() {
+
+		if stoneMap[blockName] == nil || stoneMap[blockName] == "" {
+			continue
+		}
 
-		block, err := TokenToBlock(token, "meta")
+		// a compact JWS or, for counter-signed blocks, a JWS JSON serialization
+		jws, err := parseBlockSignature(stoneMap[blockName])
 		if err != nil {
+			return stone, errors.New("invalid " + blockName + " token")
+		}
+
+		var token = jws.token(0)
+
+		// since version 2, blocks are signed over their canonical JSON
+		if version >= FormatVersion2 {
+			if err := checkCanonicalPayload(token, blockName); err != nil {
+				return stone, err
+			}
+		}
+
+		block, err := TokenToBlock(token, blockName)
+		if err != nil {
+			return stone, err
+		}
+
+		if err := stone.setSignedBlock(blockName, block); err != nil {
 			return stone, err
 		}
+		stone.Signatures[blockName] = stoneMap[blockName]
+	}
 
-		stone.Meta = block
-		stone.Signatures["meta"] = token
+	// load previous ownership signatures
+	if stoneMap["ownership_history"] != nil {
+		if !isStringSlice(stoneMap["ownership_history"]) {
+			return stone, errors.New("malformed ownership history")
+		}
+		stone.Signatures["ownership_history"] = stoneMap["ownership_history"]
+	}
+
+	// load owner signatures
+	if stoneMap["owners"] != nil {
+		if !isStringMap(stoneMap["owners"]) {
+			return stone, errors.New("malformed owner signatures")
+		}
+		stone.Signatures["owners"] = stoneMap["owners"]
 	}
 
-	// parse and load ownership block
-	if util.IsStringValue(stoneMap["ownership"]) && stoneMap["ownership"].(string) != "" {
+	return stone, nil
+}
+
+// A KeyResolver maps the issuer and key id found in the protected
+// header of a block's JWS to the PEM encoded public key that
+// must be used to verify it. Issuer and key id are empty strings
+// when the header does not carry them.
+type KeyResolver interface {
+	ResolveKey(issuer, keyID string) (string, error)
+}
+
+// KeyResolverFunc allows an ordinary function to be used as a KeyResolver
+type KeyResolverFunc func(issuer, keyID string) (string, error)
+
+// Calls the function
+func (f KeyResolverFunc) ResolveKey(issuer, keyID string) (string, error) {
+	return f(issuer, keyID)
+}
+
+// A PublicKeyResolver is like a KeyResolver but returns a public
+// key value instead of a PEM string, avoiding a parse per block.
+type PublicKeyResolver interface {
+	ResolvePublicKey(issuer, keyID string) (gocrypto.PublicKey, error)
+}
+
+// PublicKeyResolverFunc allows an ordinary function to be used as a PublicKeyResolver
+type PublicKeyResolverFunc func(issuer, keyID string) (gocrypto.PublicKey, error)
+
+// Calls the function
+func (f PublicKeyResolverFunc) ResolvePublicKey(issuer, keyID string) (gocrypto.PublicKey, error) {
+	return f(issuer, keyID)
+}
+
+// Decode a base64 encoded stone token, verify the signature of every
+// block present in the token and validate the resulting stone. Public keys
+// are obtained from the resolver. No stone is returned if any
+// block fails verification or validation.
+func DecodeAndVerify(encStone string, resolver KeyResolver) (*Stone, error) {
+	return defaultValidator().DecodeAndVerify(encStone, resolver)
+}
+
+// Decode, verify and validate a stone using a resolver that
+// returns public key values. See DecodeAndVerify.
+func DecodeAndVerifyWith(encStone string, resolver PublicKeyResolver) (*Stone, error) {
+	return defaultValidator().DecodeAndVerifyWith(encStone, resolver)
+}
 
-		var token = stoneMap["ownership"].(string);
+// Decode, verify and validate a stone according to the validator's
+// policy. A stone revoked in the validator's revocation list is
+// rejected. See the package level DecodeAndVerify.
+func (self *Validator) DecodeAndVerify(encStone string, resolver KeyResolver) (*Stone, error) {
+
+	if resolver == nil {
+		return &Stone{}, errors.New("key resolver is required")
+	}
 
-		block, err := TokenToBlock(token, "ownership")
+	return self.DecodeAndVerifyWith(encStone, PublicKeyResolverFunc(func(issuer, keyID string) (gocrypto.PublicKey, error) {
+		publicKey, err := resolver.ResolveKey(issuer, keyID)
 		if err != nil {
-			return stone, err
+			return nil, err
 		}
+		return parsePublicKey(publicKey)
+	}))
+}
 
-		stone.Ownership = block
-		stone.Signatures["ownership"] = token
+// Decode, verify and validate a stone using a resolver that
+// returns public key values. See Validator.DecodeAndVerify.
+func (self *Validator) DecodeAndVerifyWith(encStone string, resolver PublicKeyResolver) (*Stone, error) {
+
+	if resolver == nil {
+		return &Stone{}, errors.New("key resolver is required")
 	}
 
-	// parse and load ownership block
-	if util.IsStringValue(stoneMap["attributes"]) && stoneMap["attributes"].(string) != "" {
+	stone, err := Decode(encStone)
+	if err != nil {
+		return &Stone{}, err
+	}
+
+	if err := stone.verifyBlocks(resolver); err != nil {
+		return &Stone{}, err
+	}
+
+	// validate
+	if err := self.Validate(stone.ToMap()); err != nil {
+		return &Stone{}, err
+	}
+
+	if err := self.checkRevocation(stone); err != nil {
+		return &Stone{}, err
+	}
+
+	return stone, nil
+}
+
+// Returns an error if the stone is in the revocation list
+func (self *Validator) checkRevocation(stone *Stone) error {
+
+	if self.Revocations == nil {
+		return nil
+	}
+
+	metaID, _ := stone.Meta["id"].(string)
+	revoked, err := self.Revocations.IsRevoked(metaID)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to check revocation: %s", err.Error()))
+	}
+
+	if revoked {
+		return newValidationError(CodeRevoked, "/meta/id", fmt.Sprintf("stone `%s` has been revoked", metaID))
+	}
+
+	return nil
+}
+
+// Verify the signature of every signed block with the key returned by
+// the resolver. The meta block and every other block that is set must
+// be signed, and every signed block must match its signature and be
+// linked to the stone (see VerifyLinks).
+// Only the first signature of a counter-signed block is verified; see VerifyPolicy.
+func (self *Stone) verifyBlocks(resolver PublicKeyResolver) error {
+
+	// the meta block is always required
+	if err := ValidateSignaturesBlock(self.Signatures); err != nil {
+		return err
+	}
 
-		var token = stoneMap["attributes"].(string);
+	for _, blockName := range BlockNames() {
 
-		block, err := TokenToBlock(token, "attributes")
+		// a block loaded from JSON may have no signature
+		if !self.HasSignature(blockName) {
+			if !util.IsMapEmpty(self.getBlock(blockName)) {
+				return errors.New(fmt.Sprintf("`%s` block has no signature", blockName))
+			}
+			continue
+		}
+
+		header, err := self.SignatureHeader(blockName)
 		if err != nil {
-			return stone, err
+			return err
+		}
+
+		issuer, _ := header["iss"].(string)
+		keyID, _ := header["kid"].(string)
+		publicKey, err := resolver.ResolvePublicKey(issuer, keyID)
+		if err != nil {
+			return errors.New(fmt.Sprintf("unable to resolve key for `%s` block: %s", blockName, err.Error()))
+		}
+
+		token, err := self.SignatureToken(blockName)
+		if err != nil {
+			return err
 		}
 
-		stone.Attributes = block
-		stone.Signatures["attributes"] = token
+		if _, err := verifyJWS(token, publicKey); err != nil {
+			return errors.New(fmt.Sprintf("`%s` block signature could not be verified", blockName))
+		}
+
+		// the block must be the one that was signed
+		if err := self.checkSignedBlock(blockName, token); err != nil {
+			return err
+		}
 	}
 
-	// parse and load embeds block
-	if util.IsStringValue(stoneMap["embeds"]) && stoneMap["embeds"].(string) != "" {
+	return self.VerifyLinks()
+}
 
-		var token = stoneMap["embeds"].(string);
+// Returns an error if a block is not the one signed by a token
+func (self *Stone) checkSignedBlock(blockName, token string) error {
 
-		block, err := TokenToBlock(token, "embeds")
-		if err != nil {
-			return stone, err
+	signed, err := TokenToBlock(token, blockName)
+	if err != nil {
+		return err
+	}
+
+	// the attributes block is the one its disclosures reveal
+	if blockName == "attributes" {
+		if signed, err = discloseAttributes(signed, self.disclosures()); err != nil {
+			return err
 		}
+	}
 
-		stone.Embeds = block
-		stone.Signatures["embeds"] = token
-	}	
+	expected, _ := canonicalBlock(signed)
+	actual, _ := canonicalBlock(self.getBlock(blockName))
+	if expected != actual {
+		return errors.New(fmt.Sprintf("`%s` block does not match its signature", blockName))
+	}
 
-	return stone, nil
+	return nil
+}
+
+// Decodes the protected header section of a JWS token
+func tokenHeader(token string) (map[string]interface{}, error) {
+
+	var parts = strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("parameter is not a valid token")
+	}
+
+	headerJSON, err := crypto.FromBase64Raw(parts[0])
+	if err != nil {
+		return nil, errors.New("invalid token header")
+	}
+
+	return util.JSONToMap(headerJSON)
 }
 
 // Given the payload section of a JWS 
@@ -225,29 +492,101 @@ func TokenToBlock(token string, blockName string) (map[string]interface{}, error
 }
 
 
-// Get a block, otherwise, panic
+// Parse a PEM encoded private key into a Signer. Errors are
+// prefixed the way the PEM based signing functions report them.
+func parseSigner(privateKey string) (Signer, error) {
+	signer, err := ParsePrivateKey(privateKey)
+	if err != nil {
+		return nil, errors.New("Private Key Error: " + err.Error())
+	}
+	return signer, nil
+}
+
+// Returns the stone id or an error if `meta.id` is not set
+func(self *Stone) metaID() (string, error) {
+	id, _ := self.Meta["id"].(string)
+	if strings.TrimSpace(id) == "" {
+		return "", errors.New("meta.id is not set")
+	}
+	return id, nil
+}
+
+// Get a block. Nil is returned for unknown blocks.
 func(self *Stone) getBlock(name string) map[string]interface{} {
 	if name == "meta" { return self.Meta }
 	if name == "ownership" { return self.Ownership }
 	if name == "attributes" { return self.Attributes }
 	if name == "embeds" { return self.Embeds }
-	panic("unknown block")
+	return self.Blocks[name]
+}
+
+// Set a block
+func(self *Stone) setBlock(name string, block map[string]interface{}) {
+	switch name {
+	case "meta":
+		self.Meta = block
+	case "ownership":
+		self.Ownership = block
+	case "attributes":
+		self.Attributes = block
+	case "embeds":
+		self.Embeds = block
+	default:
+		if self.Blocks == nil {
+			self.Blocks = make(map[string]map[string]interface{})
+		}
+		self.Blocks[name] = block
+	}
 }
 
-// Signs a block. The signing process takes the value of a block and signs
+// Signs a block. The signing process takes the canonical JSON (see CanonicalJSON) of a block and signs
 // it using JWS. The signature generated is included in the 
-// `signatures` block. If a block is empty or unknown, an error is returned.
+// `signatures` block, replacing any previous signatures of the block
+// including counter-signatures. Signing the attributes block drops the
+// disclosures of its previous signature (see AddDisclosableAttributes).
+// If a block is empty or unknown, an error is returned.
+// The signing algorithm is chosen from the private key type: RS256 for RSA
+// keys, ES256/ES384 for P-256/P-384 keys and EdDSA for Ed25519 keys.
 func(self *Stone) Sign(blockName string, privateKey string) (string, error) {
-	
-	var block map[string]interface{}
 
-	signer, err := crypto.ParsePrivateKey([]byte(privateKey))
+	signer, err := parseSigner(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	return self.SignWith(blockName, signer)
+}
+
+// Signs a block using a Signer. See Sign.
+func(self *Stone) SignWith(blockName string, signer Signer) (string, error) {
+	return self.SignLinkedWith(blockName, signer)
+}
+
+// Signs a block and links its signature to the current signatures of
+// other blocks, so the block is only valid alongside them. Like every
+// signature in format version 3, it is also linked to the meta signature.
+// See Sign and VerifyLinks.
+func(self *Stone) SignLinked(blockName string, privateKey string, linkedBlocks ...string) (string, error) {
+
+	signer, err := parseSigner(privateKey)
 	if err != nil {
-		return "", errors.New("Private Key Error: " + err.Error())
+		return "", err
+	}
+
+	return self.SignLinkedWith(blockName, signer, linkedBlocks...)
+}
+
+// Signs a block linked to other blocks using a Signer. See SignLinked.
+func(self *Stone) SignLinkedWith(blockName string, signer Signer, linkedBlocks ...string) (string, error) {
+
+	var block map[string]interface{}
+
+	if signer == nil {
+		return "", errors.New("signer is required")
 	}
 
 	// block name must be known
-	if !util.InStringSlice(KnownBlockNames, blockName) {
+	if !isBlockName(blockName) {
 		return "", errors.New("block unknown")
 	}
 
@@ -256,29 +595,53 @@ func(self *Stone) Sign(blockName string, privateKey string) (string, error) {
 		return "", errors.New("failed to sign empty block")
 	}
 
-	// sign block
-	payload, _ := util.MapToJSON(block)
-	signature, err := signer.JWS_RSA_Sign(payload)
+	// sign the canonical JSON of the block
+	payload, err := canonicalBlock(block)
+	if err != nil {
+		return "", err
+	}
+
+	header, err := self.linkHeader(blockName, linkedBlocks)
+	if err != nil {
+		return "", err
+	}
+
+	signature, err := signJWSHeader(signer, []byte(payload), header)
 	if err != nil {
 		return "", errors.New("failed to sign block")
 	}
 	
 	self.Signatures[blockName] = signature
+
+	// disclosures belong to the previous attributes signature
+	if blockName == "attributes" {
+		delete(self.Signatures, "disclosures")
+	}
+
 	return signature, nil
 }
 
 
 // Verify a block's JWS signature. It expects the public key
-// part of the keypair used to sign the block. 
+// part of the keypair used to sign the block. The `alg` header
+// of the signature must be in AllowedAlgorithms and match the key type.
 func(self *Stone) Verify(blockName, signerPublicKey string) error {
 
-	signer, err := crypto.ParsePublicKey([]byte(signerPublicKey))
+	publicKey, err := parsePublicKey(signerPublicKey)
 	if err != nil {
 		return errors.New(fmt.Sprintf("Public Key Error: %v", err))
 	}
 
+	return self.VerifyWith(blockName, publicKey)
+}
+
+// Verify a block's JWS signature using a public key (*rsa.PublicKey,
+// *ecdsa.PublicKey or ed25519.PublicKey). A counter-signed block is
+// verified if any of its signatures was made with the key. See Verify.
+func(self *Stone) VerifyWith(blockName string, publicKey gocrypto.PublicKey) error {
+
 	// block name must be known
-	if !util.InStringSlice(KnownBlockNames, blockName) {
+	if !isBlockName(blockName) {
 		return errors.New("block unknown")
 	}
 
@@ -288,33 +651,134 @@ func(self *Stone) Verify(blockName, signerPublicKey string) error {
 	}
 
 	// verify
-	_, err = signer.JWS_RSA_Verify(self.Signatures[blockName].(string))
-	if err != nil {
-		return errors.New(fmt.Sprintf("`%s` block signature could not be verified", blockName))
+	jws, err := parseBlockSignature(self.Signatures[blockName])
+	if err == nil {
+		for i, _ := range jws.Signatures {
+			if _, err := verifyJWS(jws.token(i), publicKey); err == nil {
+				return nil
+			}
+		}
 	}
 
-	return nil
+	return errors.New(fmt.Sprintf("`%s` block signature could not be verified", blockName))
 }  
 
+// Returns an error if a block does not match the block its signature
+// signed. Verify only checks the signature; a block loaded from JSON
+// may have been changed next to its original signature.
+func(self *Stone) CheckBlock(blockName string) error {
+
+	token, err := self.SignatureToken(blockName)
+	if err != nil {
+		return err
+	}
+
+	return self.checkSignedBlock(blockName, token)
+}
+
+// Returns the decoded protected header of a block's signature. The
+// header carries the signing algorithm (`alg`), the signing key id (`kid`)
+// and, when set by the signer, the issuer (`iss`). For a counter-signed
+// block, it is the header of the first signature; see SignatureHeaders.
+func(self *Stone) SignatureHeader(blockName string) (map[string]interface{}, error) {
+
+	token, err := self.SignatureToken(blockName)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := tokenHeader(token)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("`%s` block signature header is malformed", blockName))
+	}
+
+	return header, nil
+}
+
 // Returns a base64url encoded string of the signatures block
+// and the format version. Blocks with only a COSE signature, as
+// decoded from CBOR encoded with signers, are left out; see EncodeJSON.
 func(self *Stone) Encode() string {
-	var signaturesStr, _ = util.MapToJSON(self.Signatures)
-	return crypto.ToBase64Raw([]byte(signaturesStr))
+	var envelope = make(map[string]interface{})
+	for name, signature := range self.Signatures {
+		envelope[name] = signature
+	}
+	if self.Version > 0 {
+		envelope["version"] = self.Version
+	}
+	var signaturesStr, _ = CanonicalJSON(envelope)
+	return crypto.ToBase64Raw(signaturesStr)
+}
+
+// Like Encode, but returns an error instead of leaving out a block
+// that only has a COSE signature. Such a block has no JWS signature
+// to carry in the token.
+func(self *Stone) EncodeJSON() (string, error) {
+	for _, blockName := range BlockNames() {
+		if _, ok := self.CoseSignatures[blockName]; ok && !self.HasSignature(blockName) {
+			return "", errors.New(fmt.Sprintf("`%s` block only has a COSE signature and cannot be encoded with JWS signatures", blockName))
+		}
+	}
+	return self.Encode(), nil
 }
 
 // Set and sign the meta block. New block data will be validated 
-// and signed.
+// and signed. In a linked stone (see VerifyLinks) the meta block cannot
+// be replaced while other blocks are signed, as their signatures are
+// linked to the current meta signature.
 func(self *Stone) AddMeta(meta map[string]interface{}, issuerPrivateKey string) error {
 
+	signer, err := parseSigner(issuerPrivateKey)
+	if err != nil {
+		return err
+	}
+
+	return self.AddMetaWith(meta, signer)
+}
+
+// Set and sign the meta block using the issuer's signer. See AddMeta.
+func(self *Stone) AddMetaWith(meta map[string]interface{}, issuer Signer) error {
+	return defaultValidator().AddMetaWith(self, meta, issuer)
+}
+
+// Set and sign the meta block of a stone, validated according to the
+// validator's policy. See Stone.AddMeta.
+func (self *Validator) AddMeta(stone *Stone, meta map[string]interface{}, issuerPrivateKey string) error {
+
+	signer, err := parseSigner(issuerPrivateKey)
+	if err != nil {
+		return err
+	}
+
+	return self.AddMetaWith(stone, meta, signer)
+}
+
+// Set and sign the meta block of a stone using the issuer's signer.
+// See Validator.AddMeta.
+func (self *Validator) AddMetaWith(stone *Stone, meta map[string]interface{}, issuer Signer) error {
+
 	// validate meta
-	if err := ValidateMetaBlock(meta); err != nil {
+	if err := self.ValidateMetaBlock(meta); err != nil {
     	return err
     }
 
-    self.Meta = meta
+	// blocks signed after the current meta block are linked to its signature
+	if stone.HasSignature("meta") && stone.linkedStone() {
+		var signed []string
+		for _, blockName := range BlockNames() {
+			if blockName != "meta" && stone.HasSignature(blockName) {
+				signed = append(signed, blockName)
+			}
+		}
+		if len(signed) > 0 {
+			return errors.New(fmt.Sprintf("`meta` block cannot be replaced while other blocks are signed: %s. Create a new stone", strings.Join(signed, ", ")))
+		}
+	}
+
+    stone.Meta = meta
 
     // sign meta block
-    _, err := self.Sign("meta", issuerPrivateKey)
+    _, err := stone.SignWith("meta", issuer)
 	if err != nil {
 		return err
 	}
@@ -323,46 +787,77 @@ func(self *Stone) AddMeta(meta map[string]interface{}, issuerPrivateKey string)
 }
 
 // Set and sign the ownership block. New block data will be validated 
-// and signed.
+// and signed. Any previous ownership history is discarded; use Transfer
+// to hand the stone over to a new owner.
 func (self *Stone) AddOwnership(ownership map[string]interface{}, issuerPrivateKey string) error {
 
-	if self.Meta["id"] == nil || (self.Meta["id"] != nil && strings.TrimSpace(self.Meta["id"].(string)) == "") {
-		return errors.New("meta.id is not set")
+	signer, err := parseSigner(issuerPrivateKey)
+	if err != nil {
+		return err
+	}
+
+	return self.AddOwnershipWith(ownership, signer)
+}
+
+// Set and sign the ownership block using the issuer's signer. See AddOwnership.
+func (self *Stone) AddOwnershipWith(ownership map[string]interface{}, issuer Signer) error {
+
+	metaID, err := self.metaID()
+	if err != nil {
+		return err
 	}
 
 	// validate 
-	if err := ValidateOwnershipBlock(ownership, self.Meta["id"].(string)); err != nil {
+	if err := ValidateOwnershipBlock(ownership, metaID); err != nil {
     	return err
     }
 
 	self.Ownership = ownership
 
 	// sign block
-    _, err := self.Sign("ownership", issuerPrivateKey)
+    _, err = self.SignWith("ownership", issuer)
 	if err != nil {
 		return err
 	}
 
+	// an ownership assigned by the issuer starts a new transfer 
+	// chain and must be signed again by its owners
+	delete(self.Signatures, "ownership_history")
+	delete(self.Signatures, "owners")
+
 	return nil
 }
 
 // Set and sign the attributes block. New block data will be validated 
-// and signed.
+// and signed. The block is no longer selectively disclosable and the
+// disclosures of the previous attributes signature are dropped.
 func (self *Stone) AddAttributes(attributes map[string]interface{}, issuerPrivateKey string) error {
+
+	signer, err := parseSigner(issuerPrivateKey)
+	if err != nil {
+		return err
+	}
+
+	return self.AddAttributesWith(attributes, signer)
+}
+
+// Set and sign the attributes block using the issuer's signer. See AddAttributes.
+func (self *Stone) AddAttributesWith(attributes map[string]interface{}, issuer Signer) error {
 	
-	if self.Meta["id"] == nil || (self.Meta["id"] != nil && strings.TrimSpace(self.Meta["id"].(string)) == "") {
-		return errors.New("meta.id is not set")
+	metaID, err := self.metaID()
+	if err != nil {
+		return err
 	}
 
 	// validate 
-	if err := ValidateAttributesBlock(attributes, self.Meta["id"].(string)); err != nil {
+	if err := ValidateAttributesBlock(attributes, metaID); err != nil {
     	return err
     }
 
 	self.Attributes = attributes
 
 	// sign block
-    _, err := self.Sign("attributes", issuerPrivateKey)
+    _, err = self.SignWith("attributes", issuer)
 	if err != nil {
 		return err
 	}
@@ -374,19 +869,31 @@ func (self *Stone) AddAttributes(attributes map[string]interface{}, issuerPrivat
 // and signed.
 func (self *Stone) AddEmbed(embeds map[string]interface{}, issuerPrivateKey string) error {
 
-	if self.Meta["id"] == nil || (self.Meta["id"] != nil && strings.TrimSpace(self.Meta["id"].(string)) == "") {
-		return errors.New("meta.id is not set")
+	signer, err := parseSigner(issuerPrivateKey)
+	if err != nil {
+		return err
+	}
+
+	return self.AddEmbedWith(embeds, signer)
+}
+
+// Set and sign the embeds block using the issuer's signer. See AddEmbed.
+func (self *Stone) AddEmbedWith(embeds map[string]interface{}, issuer Signer) error {
+
+	metaID, err := self.metaID()
+	if err != nil {
+		return err
 	}
 
 	// validate 
-	if err := ValidateEmbedsBlock(embeds, self.Meta["id"].(string)); err != nil {
+	if err := ValidateEmbedsBlock(embeds, metaID); err != nil {
     	return err
     }
 
 	self.Embeds = embeds
 
 	// sign block
-	_, err := self.Sign("embeds", issuerPrivateKey)
+	_, err = self.SignWith("embeds", issuer)
 	if err != nil {
 		return err
 	}
@@ -397,14 +904,61 @@ func (self *Stone) AddEmbed(embeds map[string]interface{}, issuerPrivateKey stri
 
 // Checks if a block has a signature
 func(self *Stone) HasSignature(blockName string) bool {
-	switch blockName {
-	case "meta", "ownership", "attributes", "embeds":
-		return self.Signatures[blockName] != nil
-		break
-	default:
-		return false
+	return isBlockName(blockName) && self.Signatures[blockName] != nil
+}
+
+// Returns a custom block. Nil is returned if the block is not set.
+func(self *Stone) Block(name string) map[string]interface{} {
+	return self.Blocks[name]
+}
+
+// Checks whether a custom block contains any property
+func(self *Stone) HasBlock(name string) bool {
+	return len(self.Blocks[name]) > 0
+}
+
+// Set and sign a custom block registered with RegisterBlock. New block
+// data will be validated and signed.
+func (self *Stone) SetBlock(name string, block map[string]interface{}, issuerPrivateKey string) error {
+
+	signer, err := parseSigner(issuerPrivateKey)
+	if err != nil {
+		return err
+	}
+
+	return self.SetBlockWith(name, block, signer)
+}
+
+// Set and sign a custom block using the issuer's signer. See SetBlock.
+func (self *Stone) SetBlockWith(name string, block map[string]interface{}, issuer Signer) error {
+
+	if !isCustomBlock(name) {
+		return errors.New("block unknown")
+	}
+
+	metaID, err := self.metaID()
+	if err != nil {
+		return err
+	}
+
+	// validate
+	if err := ValidateCustomBlock(name, block, metaID); err != nil {
+		return err
 	}
-	return false
+
+	// sign the new block, restoring the previous one if signing fails
+	prevBlock, hadBlock := self.Blocks[name]
+	self.setBlock(name, block)
+	if _, err := self.SignWith(name, issuer); err != nil {
+		if hadBlock {
+			self.Blocks[name] = prevBlock
+		} else {
+			delete(self.Blocks, name)
+		}
+		return err
+	}
+
+	return nil
 }
 
 // Validates the stone object.
@@ -418,12 +972,27 @@ func(self *Stone) Validate() error {
 	return Validate(self.JSON())
 }
 
+// Validates the stone object, reporting every error found. See ValidateAll.
+func(self *Stone) ValidateAll() error {
+	return ValidateAll(self.JSON())
+}
+
 // Returns a JSON representation of the object.
 func(self *Stone) JSON() string {
 	bs, _ := json.Marshal(&self)
 	return string(bs)
 }
 
+// Encodes the stone as JSON. Custom blocks are
+// written next to the built-in blocks.
+func(self *Stone) MarshalJSON() ([]byte, error) {
+	type stone Stone
+	if len(self.Blocks) == 0 {
+		return json.Marshal((*stone)(self))
+	}
+	return json.Marshal(self.ToMap())
+}
+
 // Returns a map representation of the object.
 func(self *Stone) ToMap() map[string]interface{} {
 	var dat = make(map[string]interface{})
@@ -432,13 +1001,23 @@ func(self *Stone) ToMap() map[string]interface{} {
 	dat["ownership"] = self.Ownership
 	dat["attributes"] = self.Attributes
 	dat["embeds"] = self.Embeds
+	for name, block := range self.Blocks {
+		dat[name] = block
+	}
+	if self.Version > 0 {
+		dat["version"] = self.Version
+	}
     return dat
 }
 
-// Clone the object
+// Clone the object. The copy is not validated, so a stone that has
+// expired since it was created can still be cloned.
 func(self *Stone) Clone() *Stone {
-	jsonStr := self.JSON()
-	stone, err := LoadJSON(jsonStr)
+	data, err := util.JSONToMap(self.JSON())
+	if err != nil {
+		panic(err)
+	}
+	stone, err := loadMap(data)
 	if err != nil {
 		panic(err)
 	}
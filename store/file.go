@@ -0,0 +1,164 @@
+package store
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"github.com/stonedoc/stone"
+)
+
+// The extension of stone files
+const fileExt = ".stone"
+
+// FileStore is a Store keeping each stone in a file of a directory.
+// A file holds the encoded stone; the index is built when the store
+// is opened. A directory must be used by one FileStore at a time.
+type FileStore struct {
+	mu    sync.RWMutex
+	dir   string
+	index *index
+}
+
+// Open the store of a directory, creating the directory if needed.
+// Every stone file is decoded to build the index.
+func OpenFileStore(dir string) (*FileStore, error) {
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &FileStore{ dir: dir, index: newIndex() }
+	for _, file := range files {
+
+		if file.IsDir() || !strings.HasSuffix(file.Name(), fileExt) {
+			continue
+		}
+
+		token, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		s, err := stone.Decode(string(token))
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to load %s: %s", file.Name(), err.Error()))
+		}
+
+		id, _, e, err := encode(s)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to load %s: %s", file.Name(), err.Error()))
+		}
+
+		store.index.add(id, e)
+	}
+
+	return store, nil
+}
+
+// Returns the path of the file of a stone. The id is hex
+// encoded so that any id is a valid file name.
+func (self *FileStore) path(id string) string {
+	return filepath.Join(self.dir, hex.EncodeToString([]byte(id)) + fileExt)
+}
+
+// Store a stone. The file is replaced atomically.
+func (self *FileStore) Put(s *stone.Stone) error {
+
+	id, token, e, err := encode(s)
+	if err != nil {
+		return err
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	tmp, err := ioutil.TempFile(self.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.WriteString(token)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), self.path(id))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	self.index.add(id, e)
+	return nil
+}
+
+// Returns the stone with the given id
+func (self *FileStore) Get(id string) (*stone.Stone, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	if !self.index.has(id) {
+		return nil, ErrNotFound
+	}
+	return self.read(id)
+}
+
+// Returns the stones of a type
+func (self *FileStore) ListByType(stoneType string) ([]*stone.Stone, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.list(self.index.byType[stoneType])
+}
+
+// Returns the stones owned by an address
+func (self *FileStore) ListByOwner(addressID string) ([]*stone.Stone, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.list(self.index.byOwner[addressID])
+}
+
+// Remove the stone with the given id
+func (self *FileStore) Delete(id string) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if !self.index.has(id) {
+		return ErrNotFound
+	}
+	if err := os.Remove(self.path(id)); err != nil {
+		return err
+	}
+	self.index.remove(id)
+	return nil
+}
+
+// Read and decode the file of a stone
+func (self *FileStore) read(id string) (*stone.Stone, error) {
+	token, err := ioutil.ReadFile(self.path(id))
+	if err != nil {
+		return nil, err
+	}
+	return stone.Decode(string(token))
+}
+
+// Read the stones of a set of ids
+func (self *FileStore) list(ids map[string]bool) ([]*stone.Stone, error) {
+	var stones []*stone.Stone
+	for _, id := range sortedIDs(ids) {
+		s, err := self.read(id)
+		if err != nil {
+			return nil, err
+		}
+		stones = append(stones, s)
+	}
+	return stones, nil
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"github.com/ellcrys/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stonedoc/stone"
+)
+
+// TestFileStore tests the file store
+func TestFileStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stones")
+	defer os.RemoveAll(dir)
+	store, err := OpenFileStore(dir)
+	assert.Nil(t, err)
+	testStore(t, store)
+}
+
+// TestFileStoreReopen tests that stones and the index survive reopening the store
+func TestFileStoreReopen(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stones")
+	defer os.RemoveAll(dir)
+	store, _ := OpenFileStore(dir)
+	s := newStone(t, "coupon", "alice")
+	assert.Nil(t, store.Put(s))
+
+	store, err := OpenFileStore(dir)
+	assert.Nil(t, err)
+	owned, err := store.ListByOwner("alice")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ s.Meta["id"].(string) }, ids(owned))
+}
+
+// TestFileStoreWithExpiredStone tests that expired stones can be stored and loaded
+func TestFileStoreWithExpiredStone(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stones")
+	defer os.RemoveAll(dir)
+	store, _ := OpenFileStore(dir)
+	s := stone.Empty()
+	s.Meta = map[string]interface{}{ "id": util.NewID(), "type": "coupon", "created_at": time.Now().Unix() - 100, "expires_at": time.Now().Unix() - 10 }
+	_, err := s.Sign("meta", issuerPrivKey)
+	assert.Nil(t, err)
+	assert.NotNil(t, s.Validate())
+	assert.Nil(t, store.Put(s))
+
+	store, err = OpenFileStore(dir)
+	assert.Nil(t, err)
+	coupons, err := store.ListByType("coupon")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ s.Meta["id"].(string) }, ids(coupons))
+}
+
+// TestFileStoreWithCorruptFile tests that a corrupt stone file is reported when opening
+func TestFileStoreWithCorruptFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stones")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "abc" + fileExt), []byte("not a stone"), 0600)
+	_, err := OpenFileStore(dir)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"sync"
+	"github.com/stonedoc/stone"
+)
+
+// MemoryStore is a Store keeping stones in memory
+type MemoryStore struct {
+	mu     sync.RWMutex
+	tokens map[string]string
+	index  *index
+}
+
+// Create an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{ tokens: make(map[string]string), index: newIndex() }
+}
+
+// Store a stone
+func (self *MemoryStore) Put(s *stone.Stone) error {
+
+	id, token, e, err := encode(s)
+	if err != nil {
+		return err
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.tokens[id] = token
+	self.index.add(id, e)
+	return nil
+}
+
+// Returns the stone with the given id
+func (self *MemoryStore) Get(id string) (*stone.Stone, error) {
+	self.mu.RLock()
+	token, ok := self.tokens[id]
+	self.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return stone.Decode(token)
+}
+
+// Returns the stones of a type
+func (self *MemoryStore) ListByType(stoneType string) ([]*stone.Stone, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.list(self.index.byType[stoneType])
+}
+
+// Returns the stones owned by an address
+func (self *MemoryStore) ListByOwner(addressID string) ([]*stone.Stone, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.list(self.index.byOwner[addressID])
+}
+
+// Remove the stone with the given id
+func (self *MemoryStore) Delete(id string) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if !self.index.has(id) {
+		return ErrNotFound
+	}
+	delete(self.tokens, id)
+	self.index.remove(id)
+	return nil
+}
+
+// Decode the stones of a set of ids
+func (self *MemoryStore) list(ids map[string]bool) ([]*stone.Stone, error) {
+	var stones []*stone.Stone
+	for _, id := range sortedIDs(ids) {
+		s, err := stone.Decode(self.tokens[id])
+		if err != nil {
+			return nil, err
+		}
+		stones = append(stones, s)
+	}
+	return stones, nil
+}
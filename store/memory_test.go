@@ -0,0 +1,10 @@
+package store
+
+import (
+	"testing"
+)
+
+// TestMemoryStore tests the in-memory store
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
@@ -0,0 +1,159 @@
+// Package store persists stones. Stones are stored in their encoded
+// form and indexed by id (`meta.id`), type (`meta.type`) and owner.
+package store
+
+import (
+	"errors"
+	"sort"
+	"github.com/ellcrys/util"
+	"github.com/stonedoc/stone"
+)
+
+// Returned when no stone has the requested id
+var ErrNotFound = errors.New("stone not found")
+
+// A Store persists stones. Only signed blocks are stored, as a stone
+// is stored encoded. Implementations are safe for concurrent use.
+type Store interface {
+
+	// Store a stone, replacing any stone with the same id
+	Put(s *stone.Stone) error
+
+	// Returns the stone with the given id or ErrNotFound
+	Get(id string) (*stone.Stone, error)
+
+	// Returns the stones of a type, ordered by id
+	ListByType(stoneType string) ([]*stone.Stone, error)
+
+	// Returns the stones owned by an address, ordered by id. An address
+	// owns a stone if it is the `sole` owner or one of the `joint` or
+	// `threshold` owners.
+	ListByOwner(addressID string) ([]*stone.Stone, error)
+
+	// Remove the stone with the given id. Returns ErrNotFound if there is none.
+	Delete(id string) error
+}
+
+// entry holds the indexed fields of a stored stone
+type entry struct {
+	stoneType string
+	owners    []string
+}
+
+// index maps the indexed fields of stored stones to stone ids
+type index struct {
+	entries map[string]entry
+	byType  map[string]map[string]bool
+	byOwner map[string]map[string]bool
+}
+
+// Create an empty index
+func newIndex() *index {
+	return &index{
+		entries: make(map[string]entry),
+		byType: make(map[string]map[string]bool),
+		byOwner: make(map[string]map[string]bool),
+	}
+}
+
+// Validation error codes that depend on the clock. Stones are kept for
+// records, so expired and not yet valid stones can be stored and loaded.
+var clockCodes = []string{ stone.CodeCreatedAtInFuture, stone.CodeExpired, stone.CodeNotYetValid }
+
+// Validate a stone for storage. Like Stone.Validate, the embeds of
+// embedded stones are not validated; unlike it, the clock is not checked.
+func validate(s *stone.Stone) error {
+
+	err := stone.ValidateAll(s.JSON())
+	errs, ok := err.(stone.ValidationErrors)
+	if !ok {
+		return err
+	}
+
+	for _, e := range errs {
+		if len(e.EmbedPath) < 2 && !util.InStringSlice(clockCodes, e.Code) {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// Prepare a stone for storage. The stone must be valid, except for the
+// clock, and its meta block signed. Returns the id, encoded stone and
+// indexed fields.
+func encode(s *stone.Stone) (string, string, entry, error) {
+
+	if err := stone.ValidateSignaturesBlock(s.Signatures); err != nil {
+		return "", "", entry{}, err
+	}
+
+	// store what will be read back: the signed blocks
+	decoded, err := stone.Decode(s.Encode())
+	if err != nil {
+		return "", "", entry{}, err
+	}
+
+	if err := validate(decoded); err != nil {
+		return "", "", entry{}, err
+	}
+
+	id, _ := decoded.Meta["id"].(string)
+	stoneType, _ := decoded.Meta["type"].(string)
+	return id, decoded.Encode(), entry{ stoneType, stone.OwnerAddressIDs(decoded.Ownership) }, nil
+}
+
+// Add the fields of a stone, replacing those of the stone it replaces
+func (self *index) add(id string, e entry) {
+	self.remove(id)
+	self.entries[id] = e
+	addTo(self.byType, e.stoneType, id)
+	for _, owner := range e.owners {
+		addTo(self.byOwner, owner, id)
+	}
+}
+
+// Remove the fields of a stone
+func (self *index) remove(id string) {
+	e, ok := self.entries[id]
+	if !ok {
+		return
+	}
+	delete(self.entries, id)
+	removeFrom(self.byType, e.stoneType, id)
+	for _, owner := range e.owners {
+		removeFrom(self.byOwner, owner, id)
+	}
+}
+
+// Checks whether a stone is indexed
+func (self *index) has(id string) bool {
+	_, ok := self.entries[id]
+	return ok
+}
+
+// Add an id to the ids of a key
+func addTo(ids map[string]map[string]bool, key, id string) {
+	if ids[key] == nil {
+		ids[key] = make(map[string]bool)
+	}
+	ids[key][id] = true
+}
+
+// Remove an id from the ids of a key
+func removeFrom(ids map[string]map[string]bool, key, id string) {
+	delete(ids[key], id)
+	if len(ids[key]) == 0 {
+		delete(ids, key)
+	}
+}
+
+// Returns the ids of a key in sorted order
+func sortedIDs(ids map[string]bool) []string {
+	var sorted []string
+	for id, _ := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
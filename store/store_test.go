@@ -0,0 +1,99 @@
+package store
+
+import (
+	"sort"
+	"testing"
+	"time"
+	"github.com/ellcrys/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stonedoc/stone"
+)
+
+var issuerPrivKey = util.ReadFromFixtures("../tests/fixtures/rsa_priv_1.txt")
+
+// Create a signed stone of a type, owned by the given address if not empty
+func newStone(t *testing.T, stoneType, owner string) *stone.Stone {
+	s, err := stone.Create(map[string]interface{}{
+		"id": util.NewID(),
+		"type": stoneType,
+		"created_at": time.Now().Unix(),
+	}, issuerPrivKey)
+	assert.Nil(t, err)
+	if owner != "" {
+		err = s.AddOwnership(map[string]interface{}{
+			"ref_id": s.Meta["id"],
+			"type": "sole",
+			"sole": map[string]interface{}{ "address_id": owner },
+		}, issuerPrivKey)
+		assert.Nil(t, err)
+	}
+	return s
+}
+
+// Returns the ids of stones
+func ids(stones []*stone.Stone) []string {
+	var ids []string
+	for _, s := range stones {
+		ids = append(ids, s.Meta["id"].(string))
+	}
+	return ids
+}
+
+// Returns the sorted ids of stones
+func sorted(stones ...*stone.Stone) []string {
+	var sorted = ids(stones)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// testStore runs the tests every Store implementation must pass
+func testStore(t *testing.T, store Store) {
+
+	coupon := newStone(t, "coupon", "alice")
+	ticket := newStone(t, "ticket", "alice")
+	other := newStone(t, "coupon", "bob")
+	for _, s := range []*stone.Stone{ coupon, ticket, other } {
+		assert.Nil(t, store.Put(s))
+	}
+
+	got, err := store.Get(coupon.Meta["id"].(string))
+	assert.Nil(t, err)
+	assert.Equal(t, coupon.Encode(), got.Encode())
+
+	coupons, err := store.ListByType("coupon")
+	assert.Nil(t, err)
+	assert.Equal(t, sorted(coupon, other), ids(coupons))
+
+	owned, err := store.ListByOwner("alice")
+	assert.Nil(t, err)
+	assert.Equal(t, sorted(coupon, ticket), ids(owned))
+
+	// replacing a stone updates the index
+	err = other.AddOwnership(map[string]interface{}{
+		"ref_id": other.Meta["id"],
+		"type": "sole",
+		"sole": map[string]interface{}{ "address_id": "alice" },
+	}, issuerPrivKey)
+	assert.Nil(t, err)
+	assert.Nil(t, store.Put(other))
+	owned, _ = store.ListByOwner("alice")
+	assert.Len(t, owned, 3)
+	owned, _ = store.ListByOwner("bob")
+	assert.Len(t, owned, 0)
+
+	assert.Nil(t, store.Delete(ticket.Meta["id"].(string)))
+	_, err = store.Get(ticket.Meta["id"].(string))
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, store.Delete(ticket.Meta["id"].(string)))
+	tickets, _ := store.ListByType("ticket")
+	assert.Len(t, tickets, 0)
+}
+
+// TestPutUnsignedStone tests that a stone without a meta signature is rejected
+func TestPutUnsignedStone(t *testing.T) {
+	s := stone.Empty()
+	s.Meta = map[string]interface{}{ "id": util.NewID(), "type": "coupon", "created_at": time.Now().Unix() }
+	err := NewMemoryStore().Put(s)
+	assert.NotNil(t, err)
+	assert.Equal(t, "missing `signatures.meta` property", err.Error())
+}
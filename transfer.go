@@ -0,0 +1,232 @@
+package stone
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Returns the base64url encoded SHA-256 hash of an ownership
+// signature. Transfers link to the previous ownership signature
+// through this hash (`ownership.transfer.prev_hash`).
+func SignatureHash(signature string) string {
+	h := sha256.Sum256([]byte(signature))
+	return b64Encode(h[:])
+}
+
+// Returns the previous ownership signatures, oldest first
+func (self *Stone) OwnershipHistory() []string {
+	var history []string
+	switch h := self.Signatures["ownership_history"].(type) {
+	case []string:
+		history = append(history, h...)
+	case []interface{}:
+		for _, token := range h {
+			if s, ok := token.(string); ok {
+				history = append(history, s)
+			}
+		}
+	}
+	return history
+}
+
+// Returns the address id of the owner of a `sole` ownership block
+func soleOwner(ownership map[string]interface{}) (string, bool) {
+
+	if ownership["type"] != "sole" {
+		return "", false
+	}
+
+	addressIDs := OwnerAddressIDs(ownership)
+	if len(addressIDs) != 1 {
+		return "", false
+	}
+
+	return addressIDs[0], true
+}
+
+// Transfer the stone to a new owner. The current ownership signature
+// is moved to the ownership history and a new ownership block naming the
+// new owner is signed by the current owner's private key. The new block
+// records the previous owner and the hash of the previous ownership signature.
+func (self *Stone) Transfer(newAddressID string, currentOwnerKey string) error {
+
+	signer, err := parseSigner(currentOwnerKey)
+	if err != nil {
+		return err
+	}
+
+	return self.TransferWith(newAddressID, signer)
+}
+
+// Transfer the stone to a new owner using the current owner's signer. See Transfer.
+func (self *Stone) TransferWith(newAddressID string, currentOwner Signer) error {
+
+	metaID, err := self.metaID()
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(newAddressID) == "" {
+		return errors.New("new owner address is required")
+	}
+
+	if !self.HasSignature("ownership") {
+		return errors.New("`ownership` block has no signature")
+	}
+
+	currentOwnerAddress, ok := soleOwner(self.Ownership)
+	if !ok {
+		return errors.New("only `sole` ownership can be transferred")
+	}
+
+	prevSignature, err := self.SignatureToken("ownership")
+	if err != nil {
+		return err
+	}
+
+	ownership := map[string]interface{}{
+		"ref_id": metaID,
+		"type": "sole",
+		"sole": map[string]interface{}{
+			"address_id": newAddressID,
+		},
+		"status": "transferred",
+		"transfer": map[string]interface{}{
+			"from": currentOwnerAddress,
+			"prev_hash": SignatureHash(prevSignature),
+		},
+	}
+
+	if err := ValidateOwnershipBlock(ownership, metaID); err != nil {
+		return err
+	}
+
+	// sign the new block, restoring the previous one if signing fails
+	prevOwnership := self.Ownership
+	self.Ownership = ownership
+	if _, err := self.SignWith("ownership", currentOwner); err != nil {
+		self.Ownership = prevOwnership
+		return err
+	}
+
+	self.Signatures["ownership_history"] = append(self.OwnershipHistory(), prevSignature)
+	delete(self.Signatures, "owners")
+	return nil
+}
+
+// Verify the ownership transfer chain. The oldest ownership signature must
+// be signed by the issuer; every later one must be signed by the owner named
+// in the ownership block before it and must link to it by hash. The owners
+// resolver is called with the previous owner's address id and the `kid` of
+// the transfer signature and must return that owner's PEM encoded public key.
+func (self *Stone) VerifyTransfers(issuerPublicKey string, owners KeyResolver) error {
+
+	issuerKey, err := parsePublicKey(issuerPublicKey)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Public Key Error: %v", err))
+	}
+
+	if owners == nil {
+		return errors.New("key resolver is required")
+	}
+
+	return self.VerifyTransfersWith(issuerKey, PublicKeyResolverFunc(func(addressID, keyID string) (crypto.PublicKey, error) {
+		publicKey, err := owners.ResolveKey(addressID, keyID)
+		if err != nil {
+			return nil, err
+		}
+		return parsePublicKey(publicKey)
+	}))
+}
+
+// Verify the ownership transfer chain using public key values. See VerifyTransfers.
+func (self *Stone) VerifyTransfersWith(issuerKey crypto.PublicKey, owners PublicKeyResolver) error {
+
+	if !self.HasSignature("ownership") {
+		return errors.New("`ownership` block has no signature")
+	}
+
+	metaID, _ := self.Meta["id"].(string)
+	token, err := self.SignatureToken("ownership")
+	if err != nil {
+		return err
+	}
+	chain := append(self.OwnershipHistory(), token)
+
+	var prevBlock map[string]interface{}
+	for i, token := range chain {
+
+		block, err := TokenToBlock(token, "ownership")
+		if err != nil {
+			return errors.New(fmt.Sprintf("ownership transfer %d: %s", i, err.Error()))
+		}
+
+		if err := ValidateOwnershipBlock(block, metaID); err != nil {
+			return errors.New(fmt.Sprintf("ownership transfer %d: %s", i, err.Error()))
+		}
+
+		// the first ownership is assigned by the issuer
+		if i == 0 {
+			if block["transfer"] != nil {
+				return errors.New("ownership transfer 0: first ownership must be assigned by the issuer")
+			}
+			if _, err := verifyJWS(token, issuerKey); err != nil {
+				return errors.New("ownership transfer 0: signature could not be verified with issuer key")
+			}
+			prevBlock = block
+			continue
+		}
+
+		if block["transfer"] == nil {
+			return errors.New(fmt.Sprintf("ownership transfer %d: missing `transfer` property", i))
+		}
+
+		transfer, ok := block["transfer"].(map[string]interface{})
+		if !ok {
+			return errors.New(fmt.Sprintf("ownership transfer %d: `transfer` property is malformed", i))
+		}
+
+		// only a `sole` ownership can be transferred
+		prevOwner, ok := soleOwner(prevBlock)
+		if !ok {
+			return errors.New(fmt.Sprintf("ownership transfer %d: previous ownership is not `sole` and cannot be transferred", i))
+		}
+
+		if transfer["from"] != prevOwner {
+			return errors.New(fmt.Sprintf("ownership transfer %d: `transfer.from` is not the previous owner", i))
+		}
+
+		if transfer["prev_hash"] != SignatureHash(chain[i-1]) {
+			return errors.New(fmt.Sprintf("ownership transfer %d: `transfer.prev_hash` does not match previous ownership signature", i))
+		}
+
+		header, err := tokenHeader(token)
+		if err != nil {
+			return errors.New(fmt.Sprintf("ownership transfer %d: signature header is malformed", i))
+		}
+
+		keyID, _ := header["kid"].(string)
+		ownerKey, err := owners.ResolvePublicKey(prevOwner, keyID)
+		if err != nil {
+			return errors.New(fmt.Sprintf("ownership transfer %d: unable to resolve key of `%s`: %s", i, prevOwner, err.Error()))
+		}
+
+		if _, err := verifyJWS(token, ownerKey); err != nil {
+			return errors.New(fmt.Sprintf("ownership transfer %d: signature could not be verified with key of `%s`", i, prevOwner))
+		}
+
+		prevBlock = block
+	}
+
+	// the verified chain must end in the current ownership block
+	current, _ := canonicalBlock(self.Ownership)
+	last, _ := canonicalBlock(prevBlock)
+	if current != last {
+		return errors.New("ownership block does not match its signature")
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package stone
+
+import (
+	"errors"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/ellcrys/util"
+)
+
+// ownerKeys resolves the public keys of the test owners by address id
+var ownerKeys = KeyResolverFunc(func(addressID, keyID string) (string, error) {
+	switch addressID {
+	case "alice":
+		return util.ReadFromFixtures("tests/fixtures/ec_p256_pub_1.txt"), nil
+	case "bob":
+		return util.ReadFromFixtures("tests/fixtures/ed25519_pub_1.txt"), nil
+	case "carol":
+		return util.ReadFromFixtures("tests/fixtures/rsa_pub_2.txt"), nil
+	}
+	return "", errors.New("unknown owner")
+})
+
+// NewOwnedStone creates a stone owned by `alice`
+func NewOwnedStone() *Stone {
+	sh := NewValidStone()
+	var ownership = map[string]interface{}{
+		"ref_id": sh.Meta["id"],
+		"type": "sole",
+		"sole": map[string]interface{}{
+			"address_id": "alice",
+		},
+	}
+	sh.AddOwnership(ownership, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	return sh
+}
+
+// TestTransfer tests that a stone can be transferred along a chain of owners
+// and that the chain verifies back to the issuer
+func TestTransfer(t *testing.T) {
+	sh := NewOwnedStone()
+	issuerSig := sh.Signatures["ownership"].(string)
+
+	err := sh.Transfer("bob", util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "bob", sh.Ownership["sole"].(map[string]interface{})["address_id"])
+	assert.Equal(t, "transferred", sh.Ownership["status"])
+	transfer := sh.Ownership["transfer"].(map[string]interface{})
+	assert.Equal(t, "alice", transfer["from"])
+	assert.Equal(t, SignatureHash(issuerSig), transfer["prev_hash"])
+	assert.Equal(t, []string{ issuerSig }, sh.OwnershipHistory())
+
+	err = sh.Transfer("carol", util.ReadFromFixtures("tests/fixtures/ed25519_priv_1.txt"))
+	assert.Nil(t, err)
+	assert.Len(t, sh.OwnershipHistory(), 2)
+
+	err = sh.VerifyTransfers(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt"), ownerKeys)
+	assert.Nil(t, err)
+
+	// the chain survives encoding
+	decStone, err := Decode(sh.Encode())
+	assert.Nil(t, err)
+	assert.Nil(t, decStone.VerifyTransfers(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt"), ownerKeys))
+}
+
+// TestTransferSignedByWrongOwner tests that a transfer signed by someone other
+// than the current owner fails verification
+func TestTransferSignedByWrongOwner(t *testing.T) {
+	sh := NewOwnedStone()
+	err := sh.Transfer("bob", util.ReadFromFixtures("tests/fixtures/ed25519_priv_1.txt"))
+	assert.Nil(t, err)
+	err = sh.VerifyTransfers(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt"), ownerKeys)
+	assert.NotNil(t, err)
+	assert.Equal(t, "ownership transfer 1: signature could not be verified with key of `alice`", err.Error())
+}
+
+// TestTransferWithBrokenChain tests that a tampered ownership history is detected
+func TestTransferWithBrokenChain(t *testing.T) {
+	sh := NewOwnedStone()
+	err := sh.Transfer("bob", util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	assert.Nil(t, err)
+	other := NewOwnedStone()
+	other.Meta = sh.Meta
+	other.AddOwnership(map[string]interface{}{
+		"ref_id": sh.Meta["id"],
+		"type": "sole",
+		"sole": map[string]interface{}{ "address_id": "alice" },
+	}, util.ReadFromFixtures("tests/fixtures/rsa_priv_2.txt"))
+	sh.Signatures["ownership_history"] = []string{ other.Signatures["ownership"].(string) }
+	err = sh.VerifyTransfers(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt"), ownerKeys)
+	assert.NotNil(t, err)
+	assert.Equal(t, "ownership transfer 0: signature could not be verified with issuer key", err.Error())
+
+	sh.Signatures["ownership_history"] = []string{ sh.Signatures["ownership"].(string) }
+	err = sh.VerifyTransfers(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt"), ownerKeys)
+	assert.NotNil(t, err)
+	assert.Equal(t, "ownership transfer 0: first ownership must be assigned by the issuer", err.Error())
+}
+
+// TestTransferFromGroupOwnership tests that a transfer from a `joint` ownership is rejected
+func TestTransferFromGroupOwnership(t *testing.T) {
+	sh := NewGroupStone("joint", map[string]interface{}{})
+	err := sh.Transfer("bob", util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	assert.NotNil(t, err)
+	assert.Equal(t, "only `sole` ownership can be transferred", err.Error())
+
+	// a forged transfer following the issuer's joint ownership
+	issuerSig, _ := sh.SignatureToken("ownership")
+	sh.Ownership = map[string]interface{}{
+		"ref_id": sh.Meta["id"],
+		"type": "sole",
+		"sole": map[string]interface{}{ "address_id": "mallory" },
+		"status": "transferred",
+		"transfer": map[string]interface{}{ "from": "alice", "prev_hash": SignatureHash(issuerSig) },
+	}
+	_, err = sh.Sign("ownership", util.ReadFromFixtures("tests/fixtures/rsa_priv_2.txt"))
+	assert.Nil(t, err)
+	sh.Signatures["ownership_history"] = []string{ issuerSig }
+	err = sh.VerifyTransfers(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt"), ownerKeys)
+	assert.NotNil(t, err)
+	assert.Equal(t, "ownership transfer 1: previous ownership is not `sole` and cannot be transferred", err.Error())
+}
+
+// TestTransferWithoutOwnership tests that a stone with no ownership cannot be transferred
+func TestTransferWithoutOwnership(t *testing.T) {
+	sh := NewValidStone()
+	err := sh.Transfer("bob", util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	assert.NotNil(t, err)
+	assert.Equal(t, "`ownership` block has no signature", err.Error())
+}
+
+// TestAddOwnershipResetsHistory tests that the issuer assigning ownership starts a new chain
+func TestAddOwnershipResetsHistory(t *testing.T) {
+	sh := NewOwnedStone()
+	err := sh.Transfer("bob", util.ReadFromFixtures("tests/fixtures/ec_p256_priv_1.txt"))
+	assert.Nil(t, err)
+	err = sh.AddOwnership(map[string]interface{}{
+		"ref_id": sh.Meta["id"],
+		"type": "sole",
+		"sole": map[string]interface{}{ "address_id": "alice" },
+	}, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.Nil(t, err)
+	assert.Len(t, sh.OwnershipHistory(), 0)
+	assert.Nil(t, sh.VerifyTransfers(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt"), ownerKeys))
+}
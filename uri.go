@@ -0,0 +1,263 @@
+package stone
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// The scheme of stone URIs
+const URIScheme = "stone"
+
+// The largest token a compressed URI payload may inflate to
+const MaxURITokenSize = 1 << 20
+
+// The largest number of URIs a stone may be split into
+const MaxURIParts = 1000
+
+// URIOptions controls how a stone is written as URIs
+type URIOptions struct {
+
+	// Compress the token with deflate before encoding it.
+	Compress bool
+
+	// The maximum length of each URI. The token is split into as many
+	// parts as needed. Zero means a single URI of any length.
+	MaxLength int
+}
+
+// URIAssembler collects the parts of a stone split by ToURIParts,
+// for instance as they are scanned. Parts may be added in any order.
+type URIAssembler struct {
+	total      int
+	checksum   string
+	compressed bool
+	parts      map[int]string
+}
+
+// uriPart is a parsed stone URI
+type uriPart struct {
+	seq        int
+	total      int
+	checksum   string
+	compressed bool
+	data       string
+}
+
+// Returns the checksum identifying the payload of a multi-part
+// stone: the first 8 hex characters of its SHA-256 hash
+func uriChecksum(payload string) string {
+	h := sha256.Sum256([]byte(payload))
+	return hex.EncodeToString(h[:4])
+}
+
+// Returns the stone as a single `stone:` URI. See ToURIParts.
+func (self *Stone) ToURI(compress bool) (string, error) {
+	parts, err := self.ToURIParts(URIOptions{ Compress: compress })
+	if err != nil {
+		return "", err
+	}
+	return parts[0], nil
+}
+
+// Returns the encoded stone (see Encode) as one or more `stone:` URIs.
+//
+// A single URI is `stone:[z/]<token>`. When the token does not fit in
+// opts.MaxLength, it is split and each part is
+// `stone:<seq>/<total>/<checksum>/[z/]<chunk>`, where seq counts from 1
+// and checksum identifies the whole payload. The `z/` flag marks a
+// payload compressed with deflate.
+func (self *Stone) ToURIParts(opts URIOptions) ([]string, error) {
+
+	payload := self.Encode()
+	flag := ""
+	if opts.Compress {
+		token, err := b64Decode(payload)
+		if err != nil {
+			return nil, errors.New("failed to compress token")
+		}
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, flate.BestCompression)
+		w.Write(token)
+		w.Close()
+		payload = b64Encode(buf.Bytes())
+		flag = "z/"
+	}
+
+	single := URIScheme + ":" + flag + payload
+	if opts.MaxLength <= 0 || len(single) <= opts.MaxLength {
+		return []string{ single }, nil
+	}
+
+	// find the number of parts: the header grows with the part count
+	checksum := uriChecksum(payload)
+	var total = 2
+	var chunkSize int
+	for {
+		header := fmt.Sprintf("%s:%d/%d/%s/%s", URIScheme, total, total, checksum, flag)
+		chunkSize = opts.MaxLength - len(header)
+		if chunkSize <= 0 {
+			return nil, errors.New(fmt.Sprintf("maximum URI length %d is too short", opts.MaxLength))
+		}
+		needed := (len(payload) + chunkSize - 1) / chunkSize
+		if needed <= total {
+			total = needed
+			break
+		}
+		total = needed
+	}
+	if total > MaxURIParts {
+		return nil, errors.New(fmt.Sprintf("token needs %d URIs, more than the maximum of %d", total, MaxURIParts))
+	}
+
+	var parts []string
+	for seq := 1; seq <= total; seq++ {
+		end := seq * chunkSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+		chunk := payload[(seq - 1) * chunkSize:end]
+		parts = append(parts, fmt.Sprintf("%s:%d/%d/%s/%s%s", URIScheme, seq, total, checksum, flag, chunk))
+	}
+
+	return parts, nil
+}
+
+// Parse a stone URI
+func parseURI(uri string) (*uriPart, error) {
+
+	uri = strings.TrimSpace(uri)
+	prefix := URIScheme + ":"
+	if len(uri) < len(prefix) || !strings.EqualFold(uri[:len(prefix)], prefix) {
+		return nil, errors.New("not a stone URI")
+	}
+
+	fields := strings.Split(uri[len(prefix):], "/")
+	var part = &uriPart{ seq: 1, total: 1 }
+
+	// multi-part header
+	if len(fields) >= 4 {
+		seq, seqErr := strconv.Atoi(fields[0])
+		total, totalErr := strconv.Atoi(fields[1])
+		if seqErr != nil || totalErr != nil || total < 1 || total > MaxURIParts || seq < 1 || seq > total {
+			return nil, errors.New("invalid stone URI part number")
+		}
+		if len(fields[2]) != 8 {
+			return nil, errors.New("invalid stone URI checksum")
+		}
+		part.seq, part.total, part.checksum = seq, total, strings.ToLower(fields[2])
+		fields = fields[3:]
+	}
+
+	if len(fields) == 2 && fields[0] == "z" {
+		part.compressed = true
+		fields = fields[1:]
+	}
+
+	if len(fields) != 1 || fields[0] == "" {
+		return nil, errors.New("malformed stone URI")
+	}
+
+	part.data = fields[0]
+	return part, nil
+}
+
+// Create an empty URIAssembler
+func NewURIAssembler() *URIAssembler {
+	return &URIAssembler{ parts: make(map[int]string) }
+}
+
+// Add a URI. It returns true once every part has been added. A part
+// belonging to another stone than the parts already added is rejected.
+func (self *URIAssembler) Add(uri string) (bool, error) {
+
+	part, err := parseURI(uri)
+	if err != nil {
+		return false, err
+	}
+
+	if len(self.parts) == 0 {
+		self.total, self.checksum, self.compressed = part.total, part.checksum, part.compressed
+	} else if part.total != self.total || part.checksum != self.checksum || part.compressed != self.compressed {
+		return false, errors.New("URI part belongs to another stone")
+	}
+
+	self.parts[part.seq] = part.data
+	return self.Complete(), nil
+}
+
+// Checks whether every part has been added
+func (self *URIAssembler) Complete() bool {
+	return self.total > 0 && len(self.parts) == self.total
+}
+
+// Returns the sequence numbers of the parts not added yet
+func (self *URIAssembler) Missing() []int {
+	var missing []int
+	for seq := 1; seq <= self.total; seq++ {
+		if _, ok := self.parts[seq]; !ok {
+			missing = append(missing, seq)
+		}
+	}
+	return missing
+}
+
+// Reassemble and decode the stone. Signatures are not verified; see Decode.
+func (self *URIAssembler) Stone() (*Stone, error) {
+
+	if !self.Complete() {
+		return &Stone{}, errors.New(fmt.Sprintf("stone URI is incomplete. Missing %d of %d parts", self.total - len(self.parts), self.total))
+	}
+
+	var payload string
+	for seq := 1; seq <= self.total; seq++ {
+		payload += self.parts[seq]
+	}
+
+	if self.total > 1 && uriChecksum(payload) != self.checksum {
+		return &Stone{}, errors.New("stone URI checksum does not match")
+	}
+
+	if self.compressed {
+		compressed, err := b64Decode(payload)
+		if err != nil {
+			return &Stone{}, errors.New("failed to decode token")
+		}
+		r := flate.NewReader(bytes.NewReader(compressed))
+		token, err := ioutil.ReadAll(io.LimitReader(r, MaxURITokenSize + 1))
+		if err != nil {
+			return &Stone{}, errors.New("failed to decompress token")
+		}
+		if len(token) > MaxURITokenSize {
+			return &Stone{}, errors.New("decompressed token is too large")
+		}
+		payload = b64Encode(token)
+	}
+
+	return Decode(payload)
+}
+
+// Decode a stone from its `stone:` URIs, given in any order.
+// Signatures are not verified; see Decode.
+func FromURI(uris ...string) (*Stone, error) {
+
+	if len(uris) == 0 {
+		return &Stone{}, errors.New("stone URI is required")
+	}
+
+	assembler := NewURIAssembler()
+	for _, uri := range uris {
+		if _, err := assembler.Add(uri); err != nil {
+			return &Stone{}, err
+		}
+	}
+
+	return assembler.Stone()
+}
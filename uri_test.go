@@ -0,0 +1,148 @@
+package stone
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/ellcrys/util"
+)
+
+// uriStone returns a signed stone with attributes large enough to need several parts
+func uriStone(t *testing.T) *Stone {
+	sh := NewValidStone()
+	err := sh.AddAttributes(map[string]interface{}{
+		"ref_id": sh.Meta["id"],
+		"data": map[string]interface{}{ "terms": strings.Repeat("valid in all stores ", 20) },
+	}, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.Nil(t, err)
+	return sh
+}
+
+// TestToURI tests that a stone is written as a single URI and read back
+func TestToURI(t *testing.T) {
+	sh := uriStone(t)
+	uri, err := sh.ToURI(false)
+	assert.Nil(t, err)
+	assert.Equal(t, "stone:" + sh.Encode(), uri)
+
+	decStone, err := FromURI(uri)
+	assert.Nil(t, err)
+	assert.Equal(t, sh.Encode(), decStone.Encode())
+}
+
+// TestToURICompressed tests that a compressed URI is flagged, shorter and read back
+func TestToURICompressed(t *testing.T) {
+	sh := uriStone(t)
+	uri, err := sh.ToURI(true)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(uri, "stone:z/"))
+	assert.True(t, len(uri) < len(sh.Encode()))
+
+	decStone, err := FromURI(uri)
+	assert.Nil(t, err)
+	assert.Equal(t, sh.Encode(), decStone.Encode())
+}
+
+// TestToURIParts tests that a stone is split into parts within the maximum length and reassembled in any order
+func TestToURIParts(t *testing.T) {
+	sh := uriStone(t)
+	for _, compress := range []bool{ false, true } {
+		parts, err := sh.ToURIParts(URIOptions{ Compress: compress, MaxLength: 300 })
+		assert.Nil(t, err)
+		assert.True(t, len(parts) > 1)
+		for i, part := range parts {
+			assert.True(t, len(part) <= 300)
+			assert.True(t, strings.HasPrefix(part, fmt.Sprintf("stone:%d/", i + 1)))
+		}
+
+		// reverse the parts
+		for i, j := 0, len(parts) - 1; i < j; i, j = i + 1, j - 1 {
+			parts[i], parts[j] = parts[j], parts[i]
+		}
+		decStone, err := FromURI(parts...)
+		assert.Nil(t, err)
+		assert.Equal(t, sh.Encode(), decStone.Encode())
+	}
+}
+
+// TestURIAssembler tests that missing parts are reported until all parts are added
+func TestURIAssembler(t *testing.T) {
+	parts, err := uriStone(t).ToURIParts(URIOptions{ MaxLength: 500 })
+	assert.Nil(t, err)
+	assembler := NewURIAssembler()
+
+	complete, err := assembler.Add(parts[1])
+	assert.Nil(t, err)
+	assert.False(t, complete)
+	assert.Equal(t, len(parts) - 1, len(assembler.Missing()))
+	assert.Equal(t, 1, assembler.Missing()[0])
+	_, err = assembler.Stone()
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf("stone URI is incomplete. Missing %d of %d parts", len(parts) - 1, len(parts)), err.Error())
+
+	// a part of another stone is rejected
+	otherParts, _ := uriStone(t).ToURIParts(URIOptions{ MaxLength: 500 })
+	_, err = assembler.Add(otherParts[0])
+	assert.NotNil(t, err)
+	assert.Equal(t, "URI part belongs to another stone", err.Error())
+
+	for _, part := range parts {
+		complete, err = assembler.Add(part)
+		assert.Nil(t, err)
+	}
+	assert.True(t, complete)
+	_, err = assembler.Stone()
+	assert.Nil(t, err)
+}
+
+// TestFromURIChecksumMismatch tests that corrupted parts are detected
+func TestFromURIChecksumMismatch(t *testing.T) {
+	parts, err := uriStone(t).ToURIParts(URIOptions{ MaxLength: 300 })
+	assert.Nil(t, err)
+	last := parts[len(parts) - 1]
+	parts[len(parts) - 1] = last[:len(last) - 1] + "A"
+	if parts[len(parts) - 1] == last {
+		parts[len(parts) - 1] = last[:len(last) - 1] + "B"
+	}
+	_, err = FromURI(parts...)
+	assert.NotNil(t, err)
+	assert.Equal(t, "stone URI checksum does not match", err.Error())
+}
+
+// TestFromURIInvalid tests that malformed URIs are rejected
+func TestFromURIInvalid(t *testing.T) {
+	var cases = map[string]string{
+		"https://example.com": "not a stone URI",
+		"stone:": "malformed stone URI",
+		"stone:3/2/abcdef12/AAAA": "invalid stone URI part number",
+		"stone:1/2/abc/AAAA": "invalid stone URI checksum",
+		"stone:1/1000000000/abcdef12/AAAA": "invalid stone URI part number",
+	}
+	for uri, expected := range cases {
+		_, err := FromURI(uri)
+		assert.NotNil(t, err)
+		assert.Equal(t, expected, err.Error())
+	}
+}
+
+// TestToURIPartsTooShort tests that a maximum length leaving no room for data is rejected
+func TestToURIPartsTooShort(t *testing.T) {
+	_, err := NewValidStone().ToURIParts(URIOptions{ MaxLength: 20 })
+	assert.NotNil(t, err)
+	assert.Equal(t, "maximum URI length 20 is too short", err.Error())
+
+}
+
+// TestToURIPartsTooMany tests that a token needing more than MaxURIParts URIs is rejected
+func TestToURIPartsTooMany(t *testing.T) {
+	sh := NewValidStone()
+	err := sh.AddAttributes(map[string]interface{}{
+		"ref_id": sh.Meta["id"],
+		"data": map[string]interface{}{ "terms": strings.Repeat("valid in all stores ", 400) },
+	}, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.Nil(t, err)
+	_, err = sh.ToURIParts(URIOptions{ MaxLength: 30 })
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasSuffix(err.Error(), "URIs, more than the maximum of 1000"))
+}
@@ -1,44 +1,171 @@
 package stone
 
 import (
-	"errors"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 	"github.com/ellcrys/util"
 )
 
 // This is the minimum time a stone's
-// `meta.created_at` property can have. 
+// `meta.created_at` property can have.
 // This is also the time host was created.
+// Deprecated: use a Validator.
 var START_TIME int64 = 1453975575
 
 
-// Set the start time
+// The validator used by the package level functions. SetStartTime
+// replaces it; a Validator is never modified once in use.
+var defaults = struct {
+	sync.RWMutex
+	validator *Validator
+}{ validator: &Validator{ StartTime: START_TIME, Clock: time.Now } }
+
+// Set the start time used by the package level validation functions.
+// Deprecated: use a Validator.
 func SetStartTime(t int64) {
+	defaults.Lock()
+	defer defaults.Unlock()
 	START_TIME = t
+	defaults.validator = &Validator{ StartTime: t, Clock: time.Now }
+}
+
+// A Validator validates stones according to its policy. A Validator is
+// not modified by validation and can be shared by goroutines. Stones are
+// created and loaded with a Validator's policy by Validator.Create,
+// Validator.AddMeta and Validator.LoadJSON; the validation of the other
+// blocks does not depend on the policy.
+type Validator struct {
+
+	// The minimum unix time `meta.created_at` can have.
+	StartTime int64
+
+	// Returns the current time. `meta.created_at` cannot be in
+	// the future. Defaults to time.Now if nil.
+	Clock func() time.Time
+
+	// How far in the future `meta.created_at` and `meta.not_before`
+	// can be and how far in the past `meta.expires_at` can be, allowing
+	// for clock differences between issuer and validator.
+	ClockSkew time.Duration
+
+	// Consulted by DecodeAndVerify to reject revoked stones. Revocation
+	// is not checked if nil.
+	Revocations RevocationList
+
+	// The schemas `attributes.data` must satisfy, by stone type.
+	// Stones of a type with a schema must have an `attributes` block.
+	Schemas *SchemaRegistry
+}
+
+// Create a Validator with the default start time (see SetStartTime),
+// the system clock and no clock skew.
+func NewValidator() *Validator {
+	return &Validator{ StartTime: defaultValidator().StartTime, Clock: time.Now }
+}
+
+// Returns the validator used by the package level validation functions
+func defaultValidator() *Validator {
+	defaults.RLock()
+	defer defaults.RUnlock()
+	return defaults.validator
+}
+
+// Returns the current time
+func (self *Validator) now() time.Time {
+	if self.Clock == nil {
+		return time.Now()
+	}
+	return self.Clock()
 }
 
-// Validate `meta` block. 
-// 
+// validation records the errors found while walking a stone.
+// By default only the first error is kept; later errors are ignored.
+// With collectAll set, every error is kept and nested embeds are
+// validated too.
+type validation struct {
+	validator  *Validator
+	collectAll bool
+	errs       ValidationErrors
+
+	// the format version of the stone; 0 when validating
+	// a block on its own, which uses the current version
+	version    int
+}
+
+// Record a validation error
+func (self *validation) fail(err *ValidationError) {
+	if self.collectAll || len(self.errs) == 0 {
+		self.errs = append(self.errs, err)
+	}
+}
+
+// Checks whether no further error will be recorded
+func (self *validation) done() bool {
+	return !self.collectAll && len(self.errs) > 0
+}
+
+// Returns the result of the validation: nil, the first
+// error or, when collecting all errors, ValidationErrors.
+func (self *validation) err() error {
+	if len(self.errs) == 0 {
+		return nil
+	}
+	if !self.collectAll {
+		return self.errs[0]
+	}
+	return self.errs
+}
+
+// Returns the keys of a map in sorted order so errors
+// are reported in the same order on every run
+func sortedKeys(m map[string]interface{}) []string {
+	var keys []string
+	for key, _ := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Validate `meta` block.
+//
 //  Rules:
-//  
+//
 //  - It must not contain unknown properties.
 //  - It must contain the following properties: `id`, `type` and `created_at`.
 //  - `id` property value type must be a string and 40 characters in length.
 //  - `type` property value type must be string.
 //  - `created_at` must be an interger and a valid unix date in the past but not beyond a start/launch time.
+//  - `expires_at`, if set, must be an integer unix date after `created_at` and in the future.
+//  - `not_before`, if set, must be an integer unix date before `expires_at` and in the past.
 func ValidateMetaBlock(meta map[string]interface{}) error {
+	return defaultValidator().ValidateMetaBlock(meta)
+}
+
+// Validate `meta` block. See the package level ValidateMetaBlock.
+func (self *Validator) ValidateMetaBlock(meta map[string]interface{}) error {
+	v := &validation{ validator: self }
+	v.metaBlock(meta)
+	return v.err()
+}
+
+func (self *validation) metaBlock(meta map[string]interface{}) {
 
 	var createdAt int64
 	var err error
 
 	// must reject unexpected properties
-	accetableProps := []string{ "id", "type", "created_at" } 
-	for prop, _ := range meta {
+	accetableProps := []string{ "id", "type", "created_at", "expires_at", "not_before" }
+	if self.version == FormatVersion1 {
+		accetableProps = []string{ "id", "type", "created_at" }
+	}
+	for _, prop := range sortedKeys(meta) {
 		if !util.InStringSlice(accetableProps, prop) {
-			return errors.New(fmt.Sprintf("`%s` property is unexpected in `meta` block", prop))
+			self.fail(newValidationError(CodeUnexpectedProperty, jsonPointer("meta", prop), fmt.Sprintf("`%s` property is unexpected in `meta` block", prop)))
 		}
 	}
 
@@ -46,323 +173,656 @@ func ValidateMetaBlock(meta map[string]interface{}) error {
 	props := []string{"id", "type", "created_at"}
 	for _, prop := range props {
 		if !util.HasKey(meta, prop) {
-			return errors.New(fmt.Sprintf("`meta` block is missing `%s` property", prop))
-		} 
+			self.fail(newValidationError(CodeMissingProperty, jsonPointer("meta", prop), fmt.Sprintf("`meta` block is missing `%s` property", prop)))
+		}
 	}
 
-	// stone id must be a string
-	if !util.IsStringValue(meta["id"]) {
-		return errors.New("`meta.id` value type is invalid. Expects a string")
-	}
+	if util.HasKey(meta, "id") {
 
-	// stone id must be 40 characters in length
-	if len(meta["id"].(string)) != 40 {
-		return errors.New("`meta.id` must have 40 characters. Preferrable a UUIDv4 SHA1 hashed string")
+		// stone id must be a string
+		if !util.IsStringValue(meta["id"]) {
+			self.fail(newValidationError(CodeInvalidType, "/meta/id", "`meta.id` value type is invalid. Expects a string"))
+
+		// stone id must be 40 characters in length
+		} else if len(meta["id"].(string)) != 40 {
+			self.fail(newValidationError(CodeInvalidValue, "/meta/id", "`meta.id` must have 40 characters. Preferrable a UUIDv4 SHA1 hashed string"))
+		}
 	}
-	
+
 	// type must be string
-	if !util.IsStringValue(meta["type"]) {
-		return errors.New("`meta.type` value type is invalid. Expects a string")
+	if util.HasKey(meta, "type") && !util.IsStringValue(meta["type"]) {
+		self.fail(newValidationError(CodeInvalidType, "/meta/type", "`meta.type` value type is invalid. Expects a string"))
+	}
+
+	if !util.HasKey(meta, "created_at") {
+		return
 	}
 
 	// created_at must be a json number or a float or integer
 	if !util.IsJSONNumber(meta["created_at"]) && !util.IsNumberValue(meta["created_at"]) {
-		return errors.New("`meta.created_at` value type is invalid. Expects a number")
+		self.fail(newValidationError(CodeInvalidType, "/meta/created_at", "`meta.created_at` value type is invalid. Expects a number"))
+		return
 	}
 
 	// created_at is json.Number, convert to int64
 	if util.IsJSONNumber(meta["created_at"]) {
 		createdAt, err = meta["created_at"].(json.Number).Int64()
 		if err != nil {
-			return errors.New("`meta.created_at` value type is invalid. Expects a number")
+			self.fail(newValidationError(CodeInvalidType, "/meta/created_at", "`meta.created_at` value type is invalid. Expects a number"))
+			return
 		}
 	}
 
-	// created_at is an integer
-	if util.IsInt(meta["created_at"]) {
-		createdAt = util.ToInt64(meta["created_at"])
+	// created_at is an integer or a float holding a whole number
+	if n, ok := toInt(meta["created_at"]); ok {
+		createdAt = n
 	}
-	
+
 	// make time objects
 	createdAtTime := util.UnixToTime(createdAt)
-	startTime := util.UnixToTime(START_TIME)
+	startTime := util.UnixToTime(self.validator.StartTime)
 
 	// date of creation cannot be before the start time
 	if createdAtTime.Before(startTime) {
-		return errors.New("`meta.created_at` value is too far in the past. Expects unix time on or after " + startTime.Format(time.RFC3339))
+		self.fail(newValidationError(CodeCreatedAtTooEarly, "/meta/created_at", "`meta.created_at` value is too far in the past. Expects unix time on or after " + startTime.Format(time.RFC3339)))
 	}
 
 	// date of creation cannot be a time in the future
-	if createdAtTime.After(time.Now().UTC()) {
-		return errors.New("`meta.created_at` value cannot be a unix time in the future")
+	if createdAtTime.After(self.validator.now().Add(self.validator.ClockSkew)) {
+		self.fail(newValidationError(CodeCreatedAtInFuture, "/meta/created_at", "`meta.created_at` value cannot be a unix time in the future"))
+	}
+
+	self.validityPeriod(meta, createdAt)
+}
+
+// Validate the optional `expires_at` and `not_before` properties
+// of a `meta` block against its creation time and the clock
+func (self *validation) validityPeriod(meta map[string]interface{}, createdAt int64) {
+
+	expiresAt, hasExpiresAt := self.metaTime(meta, "expires_at")
+	notBefore, hasNotBefore := self.metaTime(meta, "not_before")
+	now := self.validator.now()
+	skew := self.validator.ClockSkew
+
+	if hasExpiresAt {
+		expiresAtTime := util.UnixToTime(expiresAt)
+		if expiresAt <= createdAt {
+			self.fail(newValidationError(CodeInvalidValue, "/meta/expires_at", "`meta.expires_at` must be after `meta.created_at`"))
+		} else if !now.Add(-skew).Before(expiresAtTime) {
+			self.fail(newValidationError(CodeExpired, "/meta/expires_at", "stone expired at " + expiresAtTime.Format(time.RFC3339)))
+		}
 	}
 
-	return nil
+	if hasNotBefore {
+		notBeforeTime := util.UnixToTime(notBefore)
+		if hasExpiresAt && notBefore >= expiresAt {
+			self.fail(newValidationError(CodeInvalidValue, "/meta/not_before", "`meta.not_before` must be before `meta.expires_at`"))
+		} else if now.Add(skew).Before(notBeforeTime) {
+			self.fail(newValidationError(CodeNotYetValid, "/meta/not_before", "stone is not valid before " + notBeforeTime.Format(time.RFC3339)))
+		}
+	}
+}
+
+// Returns the value of an optional unix time property of a `meta`
+// block. False is returned if the property is not set or is invalid.
+func (self *validation) metaTime(meta map[string]interface{}, prop string) (int64, bool) {
+
+	if !util.HasKey(meta, prop) {
+		return 0, false
+	}
+
+	t, ok := toInt(meta[prop])
+	if !ok {
+		self.fail(newValidationError(CodeInvalidType, jsonPointer("meta", prop), fmt.Sprintf("`meta.%s` value type is invalid. Expects an integer", prop)))
+		return 0, false
+	}
+
+	return t, true
 }
 
 // Validate `signature` block.
-// 
+//
 //  Rules:
-//  
-//  - It must contain only acceptable properties (meta, ownership, embeds).
+//
+//  - It must contain only acceptable properties (meta, ownership, embeds and custom blocks).
 //  - `meta` signature must be present and must be a string type.
 //  - `attributes` property must be string type if set.
 //  - `ownership` property must be string type if set.
 //  - `embeds` property must be string type if set.
+//  - `ownership_history` property must be an array of strings if set.
+//  - `owners` property must be an object with string values if set.
 func ValidateSignaturesBlock(signatures map[string]interface{}) error {
+	return defaultValidator().ValidateSignaturesBlock(signatures)
+}
+
+// Validate `signatures` block. See the package level ValidateSignaturesBlock.
+func (self *Validator) ValidateSignaturesBlock(signatures map[string]interface{}) error {
+	v := &validation{ validator: self }
+	v.signaturesBlock(signatures)
+	return v.err()
+}
+
+func (self *validation) signaturesBlock(signatures map[string]interface{}) {
 
 	// must reject unexpected properties
-	accetableProps := []string{ "meta", "ownership", "attributes", "embeds" } 
-	for prop, _ := range signatures {
+	accetableProps := append([]string{ "meta", "ownership", "attributes", "embeds", "ownership_history", "owners", "disclosures" }, CustomBlockNames()...)
+	for _, prop := range sortedKeys(signatures) {
 		if !util.InStringSlice(accetableProps, prop) {
-			return errors.New(fmt.Sprintf("`%s` property is unexpected in `signatures` block", prop))
+			self.fail(newValidationError(CodeUnexpectedProperty, jsonPointer("signatures", prop), fmt.Sprintf("`%s` property is unexpected in `signatures` block", prop)))
 		}
 	}
 
 	// must have `meta` property
 	if signatures["meta"] == nil {
-		return errors.New("missing `signatures.meta` property")
-	} else {
-		// meta value type must be string
-		if !util.IsStringValue(signatures["meta"]) {
-			return errors.New("`signatures.meta` value type is invalid. Expects a string")
+		self.fail(newValidationError(CodeMissingProperty, "/signatures/meta", "missing `signatures.meta` property"))
+	}
+
+	// block signatures must be compact JWS strings or JWS JSON serializations
+	for _, prop := range BlockNames() {
+		if signatures[prop] != nil {
+			self.blockSignature(prop, signatures[prop])
+		}
+	}
+
+	// if signature has `ownership_history` property, it must be a slice of strings
+	if signatures["ownership_history"] != nil {
+		if !isStringSlice(signatures["ownership_history"]) {
+			self.fail(newValidationError(CodeInvalidType, "/signatures/ownership_history", "`signatures.ownership_history` value type is invalid. Expects an array of strings"))
 		}
 	}
 
-	// if signature has `ownership` property, it's value type must be string
-	if signatures["ownership"] != nil {
-		if !util.IsStringValue(signatures["ownership"]) {
-			return errors.New("`signatures.ownership` value type is invalid. Expects a string")
+	// if signature has `owners` property, it must map address ids to signatures
+	if signatures["owners"] != nil {
+		if !isStringMap(signatures["owners"]) {
+			self.fail(newValidationError(CodeInvalidType, "/signatures/owners", "`signatures.owners` value type is invalid. Expects a JSON object of strings"))
 		}
 	}
 
-	// if signature has `attributes` property, it's value type must be string
-	if signatures["attributes"] != nil {
-		if !util.IsStringValue(signatures["attributes"]) {
-			return errors.New("`signatures.attributes` value type is invalid. Expects a string")
+	// if signature has `disclosures` property, it must be a slice of strings
+	if signatures["disclosures"] != nil {
+		if !isStringSlice(signatures["disclosures"]) {
+			self.fail(newValidationError(CodeInvalidType, "/signatures/disclosures", "`signatures.disclosures` value type is invalid. Expects an array of strings"))
 		}
 	}
+}
+
+// Validates the signature of a block: a compact JWS string or, for
+// counter-signed blocks, a JWS in general JSON serialization
+func (self *validation) blockSignature(blockName string, signature interface{}) {
+
+	if util.IsStringValue(signature) {
+		return
+	}
+
+	// the message predates JWS JSON serializations and is kept unchanged
+	sig, ok := signature.(map[string]interface{})
+	if !ok {
+		self.fail(newValidationError(CodeInvalidType, jsonPointer("signatures", blockName), fmt.Sprintf("`signatures.%s` value type is invalid. Expects a string", blockName)))
+		return
+	}
+
+	if _, err := parseGeneralJWS(sig); err != nil {
+		self.fail(newValidationError(CodeInvalidValue, jsonPointer("signatures", blockName), fmt.Sprintf("`signatures.%s` is not a valid JWS JSON serialization: %s", blockName, err.Error())))
+	}
+}
+
+// Checks whether a value is a slice of strings. Both []string and
+// []interface{} holding only strings (as decoded from JSON) are accepted.
+func isStringSlice(v interface{}) bool {
+	switch s := v.(type) {
+	case []string:
+		return true
+	case []interface{}:
+		return util.IsSliceOfStrings(s)
+	}
+	return false
+}
 
-	// if signature has `embeds` property, it's value type must be string
-	if signatures["embeds"] != nil {
-		if !util.IsStringValue(signatures["embeds"]) {
-			return errors.New("`signatures.embeds` value type is invalid. Expects a string")
+// Checks whether a value is a map of strings. Both map[string]string and
+// map[string]interface{} holding only strings are accepted.
+func isStringMap(v interface{}) bool {
+	switch m := v.(type) {
+	case map[string]string:
+		return true
+	case map[string]interface{}:
+		for _, val := range m {
+			if !util.IsStringValue(val) {
+				return false
+			}
 		}
+		return true
+	}
+	return false
+}
+
+// Validate the `ref_id` property of a block. It must be
+// set, be a string and be equal to the meta id.
+func (self *validation) refID(blockName string, block map[string]interface{}, metaID string) {
+
+	// `ref_id` property must be set
+	if block["ref_id"] == nil {
+		self.fail(newValidationError(CodeMissingProperty, jsonPointer(blockName, "ref_id"), fmt.Sprintf("`%s` block is missing `ref_id` property", blockName)))
+
+	// `ref_id` property must be a string value
+	} else if !util.IsStringValue(block["ref_id"]) {
+		self.fail(newValidationError(CodeInvalidType, jsonPointer(blockName, "ref_id"), fmt.Sprintf("`%s.ref_id` value type is invalid. Expects string value", blockName)))
+
+	// `ref_id` property must be equal to meta id
+	} else if block["ref_id"].(string) != metaID {
+		self.fail(newValidationError(CodeRefIDMismatch, jsonPointer(blockName, "ref_id"), fmt.Sprintf("`%s.ref_id` not equal to `meta.id`", blockName)))
 	}
-	
-	return nil
 }
 
 // Validate ownership block.
-// 
+//
 //  Rules:
-// 
+//
 //  - It must not contain unknown properties.
-//  - A valid ownership block can only contain ref_id, type, sole and status properties.
+//  - A valid ownership block can only contain ref_id, type, sole, joint, threshold, status and transfer properties.
 //  - `ownership.ref_id` property must be set and value type must be string.
 //  - `ref_id` property must be equal to the meta id.
 //  - A valid ownership block can only contain type, sole and status properties.
 //  - `ownership.type` property must be set, value type must be a string and value must be known.
-// 
+//
 //  If ownership.type is 'sole':
 //  - `ownership.sole` must be set to an object.
 //  - `ownership.sole.address_id` must be set and it must be a string.
 //  - `ownership.status` is optional, but if set.
 //  - `ownership.status` must be a string value. The value must also be known.
+//
+//  If ownership.type is 'joint' or 'threshold':
+//  - `ownership.<type>` must be set to an object.
+//  - `ownership.<type>.address_ids` must be an array of at least 2 distinct strings.
+//  - `ownership.threshold.required` must be an integer between 1 and the number of address ids.
+//
+//  If ownership.transfer is set:
+//  - `ownership.transfer` must be an object.
+//  - `ownership.transfer.from` must be set and it must be a string.
+//  - `ownership.transfer.prev_hash` must be set and it must be a string.
+//  - `ownership.status` must be `transferred`.
 func ValidateOwnershipBlock(ownership map[string]interface{}, metaID string) error {
+	return defaultValidator().ValidateOwnershipBlock(ownership, metaID)
+}
+
+// Validate `ownership` block. See the package level ValidateOwnershipBlock.
+func (self *Validator) ValidateOwnershipBlock(ownership map[string]interface{}, metaID string) error {
+	v := &validation{ validator: self }
+	v.ownershipBlock(ownership, metaID)
+	return v.err()
+}
+
+func (self *validation) ownershipBlock(ownership map[string]interface{}, metaID string) {
 
 	// must reject unexpected properties
-	accetableProps := []string{ "ref_id", "type", "sole", "status" } 
-	for prop, _ := range ownership {
+	accetableProps := []string{ "ref_id", "type", "sole", "joint", "threshold", "status", "transfer" }
+	for _, prop := range sortedKeys(ownership) {
 		if !util.InStringSlice(accetableProps, prop) {
-			return errors.New(fmt.Sprintf("`%s` property is unexpected in `ownership` block", prop))
+			self.fail(newValidationError(CodeUnexpectedProperty, jsonPointer("ownership", prop), fmt.Sprintf("`%s` property is unexpected in `ownership` block", prop)))
 		}
 	}
 
-	// `ref_id` property must be set
-	if ownership["ref_id"] == nil {
-		return errors.New("`ownership` block is missing `ref_id` property")
-	}
+	self.refID("ownership", ownership, metaID)
 
-	// `ref_id` property must be a string value
-	if !util.IsStringValue(ownership["ref_id"]) {
-		return errors.New("`ownership.ref_id` value type is invalid. Expects string value")
-	}
+	var ownershipType string
+	acceptableValues := []string{"sole", "joint", "threshold"}
 
-	// `ref_id` property must be equal to meta id 
-	if ownership["ref_id"].(string) != metaID {
-		return errors.New("`ownership.ref_id` not equal to `meta.id`");
-	}
- 
 	// `type` property must be set
 	if ownership["type"] == nil {
-		return errors.New("`ownership` block is missing `type` property")
-	}
+		self.fail(newValidationError(CodeMissingProperty, "/ownership/type", "`ownership` block is missing `type` property"))
 
 	// type property must have string value
-	if !util.IsStringValue(ownership["type"]) {
-		return errors.New("`ownership.type` value type is invalid. Expects a string")
-	}
-	
+	} else if !util.IsStringValue(ownership["type"]) {
+		self.fail(newValidationError(CodeInvalidType, "/ownership/type", "`ownership.type` value type is invalid. Expects a string"))
+
 	// type property value must be known
-	acceptableValues := []string{"sole"}
-	if !util.InStringSlice(acceptableValues, ownership["type"].(string)) {
-		return errors.New("`ownership.type` property has unexpected value")
+	} else if !util.InStringSlice(acceptableValues, ownership["type"].(string)) {
+		self.fail(newValidationError(CodeInvalidValue, "/ownership/type", "`ownership.type` property has unexpected value"))
+	} else {
+		ownershipType = ownership["type"].(string)
+	}
+
+	// only the property of the ownership type may be set
+	if ownershipType != "" {
+		for _, prop := range acceptableValues {
+			if prop != ownershipType && ownership[prop] != nil {
+				self.fail(newValidationError(CodeUnexpectedProperty, jsonPointer("ownership", prop), fmt.Sprintf("`%s` property is unexpected in `%s` ownership", prop, ownershipType)))
+			}
+		}
 	}
 
+	switch ownershipType {
+	case "joint", "threshold":
+		self.ownerGroup(ownership, ownershipType)
+
 	// if ownership.type is `sole`, `sole` property is required
-	if ownership["type"].(string) == "sole" && ownership["sole"] == nil {
-		return errors.New("`ownership` block is missing `sole` property")
-	} else {
+	case "sole":
+		if ownership["sole"] == nil {
+			self.fail(newValidationError(CodeMissingProperty, "/ownership/sole", "`ownership` block is missing `sole` property"))
 
 		// `sole` property must be a map
-		if !util.IsMapOfAny(ownership["sole"]) {
-			return errors.New("`ownership.sole` value type is invalid. Expects a JSON object")
-		}
+		} else if !util.IsMapOfAny(ownership["sole"]) {
+			self.fail(newValidationError(CodeInvalidType, "/ownership/sole", "`ownership.sole` value type is invalid. Expects a JSON object"))
 
 		// `sole` property must have `address_id` property
-		soleProperty := ownership["sole"].(map[string]interface{})
-		if soleProperty["address_id"] == nil {
-			return errors.New("`ownership.sole` property is missing `address_id` property")
-		}
+		} else if soleProperty := ownership["sole"].(map[string]interface{}); soleProperty["address_id"] == nil {
+			self.fail(newValidationError(CodeMissingProperty, "/ownership/sole/address_id", "`ownership.sole` property is missing `address_id` property"))
 
 		// `sole.address_id` value type must be string
-		if !util.IsStringValue(soleProperty["address_id"]) {
-			return errors.New("`ownership.sole.address_id` value type is invalid. Expects a string")
+		} else if !util.IsStringValue(soleProperty["address_id"]) {
+			self.fail(newValidationError(CodeInvalidType, "/ownership/sole/address_id", "`ownership.sole.address_id` value type is invalid. Expects a string"))
 		}
 	}
 
-	// `status` property is optional, but if set, it's type must be string 
+	// `status` property is optional, but if set, it's type must be string
 	// and must have acceptable values
 	if ownership["status"] != nil {
 		if !util.IsStringValue(ownership["status"]) {
-			return errors.New("`ownership.status` value type is invalid. Expects a string")
+			self.fail(newValidationError(CodeInvalidType, "/ownership/status", "`ownership.status` value type is invalid. Expects a string"))
+		} else if !util.InStringSlice([]string{ "transferred" }, ownership["status"].(string)) {
+			self.fail(newValidationError(CodeInvalidValue, "/ownership/status", "`ownership.status` property has unexpected value"))
 		}
-		if !util.InStringSlice([]string{ "transferred" }, ownership["status"].(string)) {
-			return errors.New("`ownership.status` property has unexpected value")
+	}
+
+	// `transfer` property is optional, but if set, it must link
+	// to the previous owner and ownership signature
+	if ownership["transfer"] == nil {
+		return
+	}
+
+	if !util.IsMapOfAny(ownership["transfer"]) {
+		self.fail(newValidationError(CodeInvalidType, "/ownership/transfer", "`ownership.transfer` value type is invalid. Expects a JSON object"))
+		return
+	}
+
+	transfer := ownership["transfer"].(map[string]interface{})
+	for _, prop := range sortedKeys(transfer) {
+		if !util.InStringSlice([]string{ "from", "prev_hash" }, prop) {
+			self.fail(newValidationError(CodeUnexpectedProperty, jsonPointer("ownership", "transfer", prop), fmt.Sprintf("`%s` property is unexpected in `ownership.transfer`", prop)))
 		}
 	}
-	
-	return nil
+
+	for _, prop := range []string{ "from", "prev_hash" } {
+		if transfer[prop] == nil {
+			self.fail(newValidationError(CodeMissingProperty, jsonPointer("ownership", "transfer", prop), fmt.Sprintf("`ownership.transfer` property is missing `%s` property", prop)))
+		} else if !util.IsStringValue(transfer[prop]) {
+			self.fail(newValidationError(CodeInvalidType, jsonPointer("ownership", "transfer", prop), fmt.Sprintf("`ownership.transfer.%s` value type is invalid. Expects a string", prop)))
+		}
+	}
+
+	if ownership["status"] != "transferred" {
+		self.fail(newValidationError(CodeInvalidValue, "/ownership/status", "`ownership.status` must be `transferred` when `ownership.transfer` is set"))
+	}
 }
 
 
+// Validate the owner group of a `joint` or `threshold` ownership.
+// The group must list at least two distinct address ids. A threshold
+// group must also state how many owners are `required` to sign.
+func (self *validation) ownerGroup(ownership map[string]interface{}, ownershipType string) {
+
+	if ownership[ownershipType] == nil {
+		self.fail(newValidationError(CodeMissingProperty, jsonPointer("ownership", ownershipType), fmt.Sprintf("`ownership` block is missing `%s` property", ownershipType)))
+		return
+	}
+
+	if !util.IsMapOfAny(ownership[ownershipType]) {
+		self.fail(newValidationError(CodeInvalidType, jsonPointer("ownership", ownershipType), fmt.Sprintf("`ownership.%s` value type is invalid. Expects a JSON object", ownershipType)))
+		return
+	}
+
+	group := ownership[ownershipType].(map[string]interface{})
+	props := []string{ "address_ids" }
+	if ownershipType == "threshold" {
+		props = append(props, "required")
+	}
+
+	for _, prop := range sortedKeys(group) {
+		if !util.InStringSlice(props, prop) {
+			self.fail(newValidationError(CodeUnexpectedProperty, jsonPointer("ownership", ownershipType, prop), fmt.Sprintf("`%s` property is unexpected in `ownership.%s`", prop, ownershipType)))
+		}
+	}
+
+	for _, prop := range props {
+		if group[prop] == nil {
+			self.fail(newValidationError(CodeMissingProperty, jsonPointer("ownership", ownershipType, prop), fmt.Sprintf("`ownership.%s` property is missing `%s` property", ownershipType, prop)))
+		}
+	}
+
+	if group["address_ids"] == nil {
+		return
+	}
+
+	if !isStringSlice(group["address_ids"]) {
+		self.fail(newValidationError(CodeInvalidType, jsonPointer("ownership", ownershipType, "address_ids"), fmt.Sprintf("`ownership.%s.address_ids` value type is invalid. Expects an array of strings", ownershipType)))
+		return
+	}
+
+	addressIDs := OwnerAddressIDs(ownership)
+	if len(addressIDs) < 2 {
+		self.fail(newValidationError(CodeInvalidValue, jsonPointer("ownership", ownershipType, "address_ids"), fmt.Sprintf("`ownership.%s.address_ids` must contain at least 2 address ids", ownershipType)))
+	}
+
+	for i, addressID := range addressIDs {
+		if util.InStringSlice(addressIDs[:i], addressID) {
+			self.fail(newValidationError(CodeDuplicateValue, jsonPointer("ownership", ownershipType, "address_ids", fmt.Sprint(i)), fmt.Sprintf("`ownership.%s.address_ids` contains duplicate address id `%s`", ownershipType, addressID)))
+		}
+	}
+
+	if ownershipType == "threshold" && group["required"] != nil {
+		required, ok := toInt(group["required"])
+		if !ok {
+			self.fail(newValidationError(CodeInvalidType, "/ownership/threshold/required", "`ownership.threshold.required` value type is invalid. Expects an integer"))
+		} else if required < 1 || required > int64(len(addressIDs)) {
+			self.fail(newValidationError(CodeInvalidValue, "/ownership/threshold/required", "`ownership.threshold.required` must be between 1 and the number of address ids"))
+		}
+	}
+}
+
+// Converts an integer value (int, int64, an integral float64
+// or json.Number) to int64.
+func toInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	case float64:
+		return int64(n), n == float64(int64(n))
+	}
+	if util.IsInt(v) {
+		return util.ToInt64(v), true
+	}
+	return 0, false
+}
+
 // Validate attributes block.
-// 
+//
 //  Rules:
-// 
+//
 //  - It must accept only `ref_id` and `data` properties.
 //  - `ref_id` property must be provided.
 //  - `ref_id` property must be a string.
 //  - `ref_id` property must equal meta id (meta.id property).
 //  - `data` property must be set.
 func ValidateAttributesBlock(attributes map[string]interface{}, metaID string) error {
+	return defaultValidator().ValidateAttributesBlock(attributes, metaID)
+}
+
+// Validate `attributes` block. See the package level ValidateAttributesBlock.
+func (self *Validator) ValidateAttributesBlock(attributes map[string]interface{}, metaID string) error {
+	v := &validation{ validator: self }
+	v.attributesBlock(attributes, metaID)
+	return v.err()
+}
+
+func (self *validation) attributesBlock(attributes map[string]interface{}, metaID string) {
 
 	// must reject unexpected properties
-	for prop, _ := range attributes {
+	for _, prop := range sortedKeys(attributes) {
 		if !util.InStringSlice([]string{ "ref_id", "data" }, prop) {
-			return errors.New(fmt.Sprintf("`%s` property is unexpected in `attributes` block", prop))
+			self.fail(newValidationError(CodeUnexpectedProperty, jsonPointer("attributes", prop), fmt.Sprintf("`%s` property is unexpected in `attributes` block", prop)))
 		}
 	}
 
-	// `ref_id` property must be set
-	if attributes["ref_id"] == nil {
-		return errors.New("`attributes` block is missing `ref_id` property")
-	}
-
-	// `ref_id` property must be a string value
-	if !util.IsStringValue(attributes["ref_id"]) {
-		return errors.New("`attributes.ref_id` value type is invalid. Expects string value")
-	}
-
-	// `ref_id` property must be equal to meta id 
-	if attributes["ref_id"].(string) != metaID {
-		return errors.New("`attributes.ref_id` not equal to `meta.id`");
-	}
+	self.refID("attributes", attributes, metaID)
 
 	// `data` property must be provided
 	if (attributes["data"] == nil) {
-		return errors.New("`attributes` block is missing `data` property");
+		self.fail(newValidationError(CodeMissingProperty, "/attributes/data", "`attributes` block is missing `data` property"))
 	}
-
-	return nil
 }
 
 
 // Validate embeds block.
-// 
+//
 //  Rules:
-//  
+//
 //  - It must not contain only `ref_id` and `data` properties.
 //  - `ref_id` property must be set and should have a string value.
 //  - `ref_id` property must be equal to meta id.
 //  - `data` property must be set and value type must be an array of json objects.
 func ValidateEmbedsBlock(embeds map[string]interface{}, metaID string) error {
+	return defaultValidator().ValidateEmbedsBlock(embeds, metaID)
+}
+
+// Validate `embeds` block. See the package level ValidateEmbedsBlock.
+func (self *Validator) ValidateEmbedsBlock(embeds map[string]interface{}, metaID string) error {
+	v := &validation{ validator: self }
+	v.embedsBlock(embeds, metaID)
+	return v.err()
+}
+
+func (self *validation) embedsBlock(embeds map[string]interface{}, metaID string) {
 
 	// must reject unexpected properties
-	for prop, _ := range embeds {
+	for _, prop := range sortedKeys(embeds) {
 		if !util.InStringSlice([]string{ "ref_id", "data" }, prop) {
-			return errors.New(fmt.Sprintf("`%s` property is unexpected in `embeds` block", prop))
+			self.fail(newValidationError(CodeUnexpectedProperty, jsonPointer("embeds", prop), fmt.Sprintf("`%s` property is unexpected in `embeds` block", prop)))
 		}
 	}
 
-	// `ref_id` property must be set
-	if embeds["ref_id"] == nil {
-		return errors.New("`embeds` block is missing `ref_id` property")
-	}
-
-	// `ref_id` property must be a string value
-	if !util.IsStringValue(embeds["ref_id"]) {
-		return errors.New("`embeds.ref_id` value type is invalid. Expects string value")
-	}
-
-	// `ref_id` property must be equal to meta id 
-	if embeds["ref_id"].(string) != metaID {
-		return errors.New("`embeds.ref_id` not equal to `meta.id`");
-	}
+	self.refID("embeds", embeds, metaID)
 
 	// `data` property must be provided
 	if (embeds["data"] == nil) {
-		return errors.New("`embeds` block is missing `data` property");
+		self.fail(newValidationError(CodeMissingProperty, "/embeds/data", "`embeds` block is missing `data` property"))
+		return
 	}
 
 	// `data` property must be a map
 	if !util.IsSlice(embeds["data"]) || !util.ContainsOnlyMapType(embeds["data"].([]interface{})) {
-		return errors.New("`embeds.data` value type is invalid. Expects a slice of JSON objects")
+		self.fail(newValidationError(CodeInvalidType, "/embeds/data", "`embeds.data` value type is invalid. Expects a slice of JSON objects"))
+		return
 	}
 
 	allEmbeds := embeds["data"].([]interface{})
 
-	// validate each embeds. To prevent continues validaton of child embeds,  
-	// we will remove the `embeds` block before calling Validate() for every objects, 
-	// Reassigning the values of the `embeds` block after validation.
+	// validate each embeds. Unless all errors are collected, child embeds are not
+	// validated: we will remove the `embeds` block before validating every object,
+	// reassigning the values of the `embeds` block after validation.
 	for i, embed := range allEmbeds {
-		
-		var embedsClone map[string]interface{}
+
+		if self.done() {
+			return
+		}
+
 		item := embed.(map[string]interface{})
-		
+		embedValidation := &validation{ validator: self.validator, collectAll: self.collectAll }
+
 		// Ensure the item has a embeds block set.
 		// If so, temporary remove embeds property of the object
-		if item["embeds"] != nil {
-			embedsClone = item["embeds"].(map[string]interface{})
+		embedsClone, hasEmbeds := item["embeds"]
+		if hasEmbeds && !self.collectAll {
 			item["embeds"] = map[string]interface{}{}
 		}
 
-		if err := Validate(item); err != nil {
-			return errors.New(fmt.Sprintf("unable to validate embed at index %d. Reason: %s", i, err.Error()))
-		}
+		embedValidation.stone(item)
 
 		// reassign stone's embeds
-		item["embeds"] = embedsClone
+		if hasEmbeds {
+			item["embeds"] = embedsClone
+		}
+
+		for _, err := range embedValidation.errs {
+			self.fail(embedValidationError(i, err))
+		}
+	}
+}
+
+// Validate a custom block registered with RegisterBlock.
+//
+//  Rules:
+//
+//  - `ref_id` property must be set, must be a string and must be equal to meta id.
+//  - It must satisfy the validator the block was registered with.
+func ValidateCustomBlock(name string, block map[string]interface{}, metaID string) error {
+	return defaultValidator().ValidateCustomBlock(name, block, metaID)
+}
+
+// Validate a custom block. See the package level ValidateCustomBlock.
+func (self *Validator) ValidateCustomBlock(name string, block map[string]interface{}, metaID string) error {
+	v := &validation{ validator: self }
+	v.customBlock(name, block, metaID)
+	return v.err()
+}
+
+func (self *validation) customBlock(name string, block map[string]interface{}, metaID string) {
+
+	validator, ok := customBlockValidator(name)
+	if !ok {
+		self.fail(newValidationError(CodeUnexpectedProperty, jsonPointer(name), fmt.Sprintf("`%s` block is unknown", name)))
+		return
+	}
+
+	self.refID(name, block, metaID)
+	if self.done() {
+		return
+	}
+
+	err := validator(block, metaID)
+	if err == nil {
+		return
 	}
 
-	return nil
+	switch e := err.(type) {
+	case *ValidationError:
+		self.fail(e)
+	case ValidationErrors:
+		for _, item := range e {
+			self.fail(item)
+		}
+	default:
+		self.fail(newValidationError(CodeInvalidValue, jsonPointer(name), err.Error()))
+	}
 }
 
-// Validate a stone. 
+// Validate a stone.
+// Errors are of type *ValidationError.
 func Validate(stoneData interface{}) error {
+	return defaultValidator().Validate(stoneData)
+}
 
-	var metaID string
+// Validate a stone. See the package level Validate.
+func (self *Validator) Validate(stoneData interface{}) error {
+	v := &validation{ validator: self }
+	v.stone(stoneData)
+	return v.err()
+}
+
+// Validate a stone, reporting every error found instead of only the
+// first. Unlike Validate, the embeds of embedded stones are validated too.
+// Errors are of type ValidationErrors.
+func ValidateAll(stoneData interface{}) error {
+	return defaultValidator().ValidateAll(stoneData)
+}
+
+// Validate a stone, reporting every error found. See the package level ValidateAll.
+func (self *Validator) ValidateAll(stoneData interface{}) error {
+	v := &validation{ validator: self, collectAll: true }
+	v.stone(stoneData)
+	return v.err()
+}
+
+func (self *validation) stone(stoneData interface{}) {
 
 	// parse stone data to map[string]interface{} stoneData is string
 	var data map[string]interface{}
@@ -371,65 +831,111 @@ func Validate(stoneData interface{}) error {
 		decoder := json.NewDecoder(strings.NewReader(d))
 		decoder.UseNumber();
 		if err := decoder.Decode(&data); err != nil {
-	        return errors.New("unable to parse json string");
-	    }
-	    break;
+			self.fail(newValidationError(CodeMalformedJSON, "", "unable to parse json string"))
+			return
+		}
 	case map[string]interface{}:
 		data = d
-		break
 	default:
-		return errors.New("unsupported parameter type");
+		self.fail(newValidationError(CodeUnsupportedInput, "", "unsupported parameter type"))
+		return
+	}
+
+	// rules depend on the format version
+	version, ok := formatVersion(data["version"])
+	if !ok {
+		self.fail(newValidationError(CodeUnsupportedVersion, "/version", fmt.Sprintf("format version is not supported. Expects an integer from %d to %d", FormatVersion1, CurrentFormatVersion)))
+		return
+	}
+	self.version = version
+
+	// must have `meta` block
+	if data["meta"] == nil {
+		self.fail(newValidationError(CodeMissingProperty, "/meta", "missing `meta` block"))
+		return
 	}
 
-    // must have `meta` block
-    if data["meta"] == nil {
-    	return errors.New("missing `meta` block")
-    } else {
-		if !util.IsMapOfAny(data["meta"]) {
-			return errors.New("`meta` block value type is invalid. Expects a JSON object")
+	if !util.IsMapOfAny(data["meta"]) {
+		self.fail(newValidationError(CodeInvalidType, "/meta", "`meta` block value type is invalid. Expects a JSON object"))
+		return
+	}
+
+	metaBlock := data["meta"].(map[string]interface{})
+	self.metaBlock(metaBlock)
+
+	// other blocks reference the meta id; they can't be checked without it
+	metaID, ok := metaBlock["id"].(string)
+	if !ok {
+		return
+	}
+
+	// if `ownership` block exists, it must be a map
+	if data["ownership"] != nil {
+		if !util.IsMapOfAny(data["ownership"]) {
+			self.fail(newValidationError(CodeInvalidType, "/ownership", "`ownership` block value type is invalid. Expects a JSON object"))
+		} else if !util.IsMapEmpty(data["ownership"].(map[string]interface{})) {
+			self.ownershipBlock(data["ownership"].(map[string]interface{}), metaID)
 		}
-		if  err := ValidateMetaBlock(data["meta"].(map[string]interface{})); err != nil {
-			return err
+	}
+
+	// if `attributes` block exists, it must be a map
+	if data["attributes"] != nil {
+		if !util.IsMapOfAny(data["attributes"]) {
+			self.fail(newValidationError(CodeInvalidType, "/attributes", "`attributes` block value type is invalid. Expects a JSON object"))
+		} else if !util.IsMapEmpty(data["attributes"].(map[string]interface{})) {
+			self.attributesBlock(data["attributes"].(map[string]interface{}), metaID)
 		}
-		metaBlock := data["meta"].(map[string]interface{})
-		metaID = metaBlock["id"].(string)
 	}
 
-    // if `ownership` block exists, it must be a map
-    if data["ownership"] != nil {
-    	if !util.IsMapOfAny(data["ownership"]) {
-    		return errors.New("`ownership` block value type is invalid. Expects a JSON object")
-    	} 
-		if !util.IsMapEmpty(data["ownership"].(map[string]interface{})) {
-    		if err := ValidateOwnershipBlock(data["ownership"].(map[string]interface{}), metaID); err != nil {
-				return err
-			}
-    	}
-    }
-
-    // if `attributes` block exists, it must be a map
-    if data["attributes"] != nil {
-    	if !util.IsMapOfAny(data["attributes"]) {
-    		return errors.New("`attributes` block value type is invalid. Expects a JSON object")
-    	}
-		if !util.IsMapEmpty(data["attributes"].(map[string]interface{})) {
-    		if err := ValidateAttributesBlock(data["attributes"].(map[string]interface{}), metaID); err != nil {
-				return err
-			}
-    	}
-    }
-
-    // if `embeds` block exists, it must be a map
-    if data["embeds"] != nil {
-    	if !util.IsMapOfAny(data["embeds"]) {
-    		return errors.New("`embeds` block value type is invalid. Expects a JSON object")
-    	}
-    	if !util.IsMapEmpty(data["embeds"].(map[string]interface{})) {
-    		if err := ValidateEmbedsBlock(data["embeds"].(map[string]interface{}), metaID); err != nil {
-				return err
-			}
-    	}
-    }
+	self.attributesSchema(metaBlock, data["attributes"])
 
-    return nil
-}
\ No newline at end of file
+	// if `embeds` block exists, it must be a map
+	if data["embeds"] != nil {
+		if !util.IsMapOfAny(data["embeds"]) {
+			self.fail(newValidationError(CodeInvalidType, "/embeds", "`embeds` block value type is invalid. Expects a JSON object"))
+		} else if !util.IsMapEmpty(data["embeds"].(map[string]interface{})) {
+			self.embedsBlock(data["embeds"].(map[string]interface{}), metaID)
+		}
+	}
+
+	// if a custom block exists, it must be a map
+	for _, name := range CustomBlockNames() {
+		if data[name] == nil {
+			continue
+		}
+		if !util.IsMapOfAny(data[name]) {
+			self.fail(newValidationError(CodeInvalidType, jsonPointer(name), fmt.Sprintf("`%s` block value type is invalid. Expects a JSON object", name)))
+		} else if !util.IsMapEmpty(data[name].(map[string]interface{})) {
+			self.customBlock(name, data[name].(map[string]interface{}), metaID)
+		}
+	}
+}
+
+// Validate `attributes.data` against the schema of the stone type
+func (self *validation) attributesSchema(meta map[string]interface{}, attributes interface{}) {
+
+	if self.validator.Schemas == nil {
+		return
+	}
+
+	stoneType, _ := meta["type"].(string)
+	schema, ok := self.validator.Schemas.Lookup(stoneType)
+	if !ok {
+		return
+	}
+
+	block, _ := attributes.(map[string]interface{})
+	if len(block) == 0 {
+		self.fail(newValidationError(CodeMissingProperty, "/attributes", fmt.Sprintf("`attributes` block is required by the `%s` schema", stoneType)))
+		return
+	}
+
+	if block["data"] == nil {
+		return
+	}
+
+	errs, _ := schema.Validate(block["data"]).(ValidationErrors)
+	for _, err := range errs {
+		self.fail(newValidationError(err.Code, "/attributes/data" + err.Pointer, fmt.Sprintf("`attributes.data` does not satisfy the `%s` schema: %s", stoneType, err.Message)))
+	}
+}
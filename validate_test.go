@@ -451,4 +451,382 @@ func TestIgnoreChildEmbedsOfEmbeds(t *testing.T) {
 	childEmbed := d["data"].([]interface{})[0].(map[string]interface{})
 	assert.NotNil(t, childEmbed["embeds"])
 	assert.NotNil(t, childEmbed["embeds"].(map[string]interface{})["data"])
-}
\ No newline at end of file
+}
+// TestOwnershipTransferRequiresTransferredStatus tests that a transfer record requires the `transferred` status
+func TestOwnershipTransferRequiresTransferredStatus(t *testing.T) {
+	d := map[string]interface{}{
+		"ref_id": "xxx",
+		"type": "sole",
+		"sole": map[string]interface{}{
+			"address_id": "abcde",
+		},
+		"transfer": map[string]interface{}{
+			"from": "xyz",
+			"prev_hash": "abc",
+		},
+	}
+	err := ValidateOwnershipBlock(d, "xxx")
+	assert.NotNil(t, err)
+	expectedMsg := "`ownership.status` must be `transferred` when `ownership.transfer` is set"
+	assert.Equal(t, expectedMsg, err.Error())
+}
+
+// TestOwnershipTransferMissingPrevHash tests that a transfer record must link to the previous signature
+func TestOwnershipTransferMissingPrevHash(t *testing.T) {
+	d := map[string]interface{}{
+		"ref_id": "xxx",
+		"type": "sole",
+		"sole": map[string]interface{}{
+			"address_id": "abcde",
+		},
+		"status": "transferred",
+		"transfer": map[string]interface{}{
+			"from": "xyz",
+		},
+	}
+	err := ValidateOwnershipBlock(d, "xxx")
+	assert.NotNil(t, err)
+	expectedMsg := "`ownership.transfer` property is missing `prev_hash` property"
+	assert.Equal(t, expectedMsg, err.Error())
+}
+
+// TestSignaturesWithInvalidOwnershipHistory tests that the ownership history must be an array of strings
+func TestSignaturesWithInvalidOwnershipHistory(t *testing.T) {
+	d := map[string]interface{}{
+		"meta": "abc",
+		"ownership_history": "abc",
+	}
+	err := ValidateSignaturesBlock(d)
+	assert.NotNil(t, err)
+	expectedMsg := "`signatures.ownership_history` value type is invalid. Expects an array of strings"
+	assert.Equal(t, expectedMsg, err.Error())
+}
+
+// TestJointOwnershipWithTooFewOwners tests that a joint ownership needs at least two owners
+func TestJointOwnershipWithTooFewOwners(t *testing.T) {
+	d := map[string]interface{}{
+		"ref_id": "xxx",
+		"type": "joint",
+		"joint": map[string]interface{}{
+			"address_ids": []interface{}{ "abcde" },
+		},
+	}
+	err := ValidateOwnershipBlock(d, "xxx")
+	assert.NotNil(t, err)
+	expectedMsg := "`ownership.joint.address_ids` must contain at least 2 address ids"
+	assert.Equal(t, expectedMsg, err.Error())
+}
+
+// TestJointOwnershipWithDuplicateOwners tests that owners of a joint ownership must be distinct
+func TestJointOwnershipWithDuplicateOwners(t *testing.T) {
+	d := map[string]interface{}{
+		"ref_id": "xxx",
+		"type": "joint",
+		"joint": map[string]interface{}{
+			"address_ids": []interface{}{ "abcde", "abcde" },
+		},
+	}
+	err := ValidateOwnershipBlock(d, "xxx")
+	assert.NotNil(t, err)
+	expectedMsg := "`ownership.joint.address_ids` contains duplicate address id `abcde`"
+	assert.Equal(t, expectedMsg, err.Error())
+}
+
+// TestThresholdOwnershipRequiredOutOfRange tests that the threshold cannot exceed the number of owners
+func TestThresholdOwnershipRequiredOutOfRange(t *testing.T) {
+	d := map[string]interface{}{
+		"ref_id": "xxx",
+		"type": "threshold",
+		"threshold": map[string]interface{}{
+			"address_ids": []interface{}{ "abcde", "fghij" },
+			"required": 3,
+		},
+	}
+	err := ValidateOwnershipBlock(d, "xxx")
+	assert.NotNil(t, err)
+	expectedMsg := "`ownership.threshold.required` must be between 1 and the number of address ids"
+	assert.Equal(t, expectedMsg, err.Error())
+}
+
+// TestThresholdOwnershipMissingRequired tests that a threshold ownership must state the threshold
+func TestThresholdOwnershipMissingRequired(t *testing.T) {
+	d := map[string]interface{}{
+		"ref_id": "xxx",
+		"type": "threshold",
+		"threshold": map[string]interface{}{
+			"address_ids": []interface{}{ "abcde", "fghij" },
+		},
+	}
+	err := ValidateOwnershipBlock(d, "xxx")
+	assert.NotNil(t, err)
+	expectedMsg := "`ownership.threshold` property is missing `required` property"
+	assert.Equal(t, expectedMsg, err.Error())
+}
+
+// TestOwnershipWithPropertyOfOtherType tests that only the property of the ownership type is allowed
+func TestOwnershipWithPropertyOfOtherType(t *testing.T) {
+	d := map[string]interface{}{
+		"ref_id": "xxx",
+		"type": "sole",
+		"sole": map[string]interface{}{
+			"address_id": "abcde",
+		},
+		"joint": map[string]interface{}{},
+	}
+	err := ValidateOwnershipBlock(d, "xxx")
+	assert.NotNil(t, err)
+	expectedMsg := "`joint` property is unexpected in `sole` ownership"
+	assert.Equal(t, expectedMsg, err.Error())
+}
+
+// TestValidateAllReportsEveryError tests that ValidateAll reports the errors of all blocks
+func TestValidateAllReportsEveryError(t *testing.T) {
+	metaID := util.NewID()
+	d := map[string]interface{}{
+		"meta": map[string]interface{}{
+			"id": metaID,
+			"type": 10,
+			"created_at": time.Now().Unix(),
+			"extra": true,
+		},
+		"ownership": map[string]interface{}{
+			"ref_id": "xyz",
+			"type": "sole",
+		},
+		"attributes": map[string]interface{}{
+			"ref_id": metaID,
+		},
+	}
+	err := ValidateAll(d)
+	assert.NotNil(t, err)
+	errs, ok := err.(ValidationErrors)
+	assert.True(t, ok)
+	var pointers []string
+	for _, e := range errs {
+		pointers = append(pointers, e.Pointer)
+	}
+	assert.Equal(t, []string{ "/meta/extra", "/meta/type", "/ownership/ref_id", "/ownership/sole", "/attributes/data" }, pointers)
+	assert.Equal(t, "`extra` property is unexpected in `meta` block; `meta.type` value type is invalid. Expects a string; `ownership.ref_id` not equal to `meta.id`; `ownership` block is missing `sole` property; `attributes` block is missing `data` property", err.Error())
+
+	// Validate stops at the first error
+	assert.Equal(t, errs[0], Validate(d))
+}
+
+// TestValidateAllValidatesNestedEmbeds tests that ValidateAll walks the embeds of embedded stones
+func TestValidateAllValidatesNestedEmbeds(t *testing.T) {
+	childID := util.NewID()
+	d := map[string]interface{}{
+		"meta": map[string]interface{}{
+			"id": "xxx",
+			"type": "coupon",
+			"created_at": time.Now().Unix(),
+		},
+		"embeds": map[string]interface{}{
+			"ref_id": "xxx",
+			"data": []interface{}{
+				map[string]interface{}{
+					"meta": map[string]interface{}{
+						"id": childID,
+						"type": "coupon",
+						"created_at": time.Now().Unix(),
+					},
+					"embeds": map[string]interface{}{
+						"ref_id": childID,
+						"data": []interface{}{
+							map[string]interface{}{ "meta": map[string]interface{}{} },
+						},
+					},
+				},
+			},
+		},
+	}
+	errs := ValidateAll(d).(ValidationErrors)
+	assert.Len(t, errs, 4)
+	assert.Equal(t, "/meta/id", errs[0].Pointer)
+	assert.Equal(t, "/embeds/data/0/embeds/data/0/meta/id", errs[1].Pointer)
+	assert.Equal(t, []int{ 0, 0 }, errs[1].EmbedPath)
+	assert.Equal(t, CodeMissingProperty, errs[1].Code)
+	assert.Equal(t, "meta", errs[1].Block)
+	assert.Equal(t, "/embeds/data/0/embeds/data/0/meta/created_at", errs[3].Pointer)
+	assert.NotNil(t, d["embeds"].(map[string]interface{})["data"].([]interface{})[0].(map[string]interface{})["embeds"])
+}
+
+// TestValidateAllWithValidStone tests that a valid stone has no errors
+func TestValidateAllWithValidStone(t *testing.T) {
+	assert.Nil(t, ValidateAll(util.ReadFromFixtures("tests/fixtures/stone_5.json")))
+	assert.Nil(t, NewValidStone().ValidateAll())
+}
+
+// TestValidatorWithClock tests that a validator's clock decides whether `created_at` is in the future
+func TestValidatorWithClock(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	validator := &Validator{ StartTime: START_TIME, Clock: func() time.Time { return now } }
+	d := map[string]interface{}{
+		"id": util.Sha1("abcd"),
+		"type": "coupon",
+		"created_at": now.Unix(),
+	}
+	assert.Nil(t, validator.ValidateMetaBlock(d))
+
+	d["created_at"] = now.Unix() + 30
+	err := validator.ValidateMetaBlock(d)
+	assert.NotNil(t, err)
+	assert.Equal(t, CodeCreatedAtInFuture, err.(*ValidationError).Code)
+
+	validator.ClockSkew = time.Minute
+	assert.Nil(t, validator.ValidateMetaBlock(d))
+}
+
+// TestValidatorWithStartTime tests that validators with different start times do not affect each other
+func TestValidatorWithStartTime(t *testing.T) {
+	createdAt := time.Now().Unix() - 100
+	d := map[string]interface{}{
+		"meta": map[string]interface{}{
+			"id": util.Sha1("abcd"),
+			"type": "coupon",
+			"created_at": createdAt,
+		},
+	}
+
+	tenantA := NewValidator()
+	tenantB := NewValidator()
+	tenantB.StartTime = createdAt + 10
+
+	assert.Nil(t, tenantA.Validate(d))
+	err := tenantB.Validate(d)
+	assert.NotNil(t, err)
+	assert.Equal(t, CodeCreatedAtTooEarly, err.(*ValidationError).Code)
+	assert.Nil(t, Validate(d))
+}
+
+// TestSetStartTimeAffectsPackageFunctions tests that the package level functions use the start time set by SetStartTime
+func TestSetStartTimeAffectsPackageFunctions(t *testing.T) {
+	defer SetStartTime(START_TIME)
+	createdAt := time.Now().Unix() - 100
+	d := map[string]interface{}{
+		"id": util.Sha1("abcd"),
+		"type": "coupon",
+		"created_at": createdAt,
+	}
+	SetStartTime(createdAt + 10)
+	assert.NotNil(t, ValidateMetaBlock(d))
+}
+
+// TestSetStartTimeConcurrently tests that the start time can be set while the package level functions validate
+func TestSetStartTimeConcurrently(t *testing.T) {
+	defer SetStartTime(START_TIME)
+	startTime := START_TIME
+	d := map[string]interface{}{
+		"id": util.Sha1("abcd"),
+		"type": "coupon",
+		"created_at": time.Now().Unix(),
+	}
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			SetStartTime(startTime)
+		}
+		done <- true
+	}()
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, ValidateMetaBlock(d))
+	}
+	<-done
+}
+
+// TestValidatorCreate tests that stones are created, signed and loaded with the validator's policy
+func TestValidatorCreate(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	validator := &Validator{ StartTime: START_TIME, Clock: func() time.Time { return future } }
+	meta := map[string]interface{}{
+		"id": util.NewID(),
+		"type": "coupon",
+		"created_at": future.Unix() - 10,
+	}
+
+	_, err := Create(meta, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta.created_at` value cannot be a unix time in the future", err.Error())
+
+	sh, err := validator.Create(meta, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.Nil(t, err)
+	_, err = validator.LoadJSON(sh.JSON())
+	assert.Nil(t, err)
+	_, err = LoadJSON(sh.JSON())
+	assert.NotNil(t, err)
+
+	sh = Empty()
+	err = sh.AddMeta(meta, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	assert.NotNil(t, err)
+	assert.Nil(t, validator.AddMeta(sh, meta, util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt")))
+	assert.Equal(t, meta, sh.Meta)
+}
+
+// TestValidateMetaBlockExpiresAt tests that a stone is rejected once the clock passes `expires_at`
+func TestValidateMetaBlockExpiresAt(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	validator := &Validator{ StartTime: START_TIME, Clock: func() time.Time { return now } }
+	d := map[string]interface{}{
+		"id": util.Sha1("abcd"),
+		"type": "coupon",
+		"created_at": now.Unix() - 100,
+		"expires_at": now.Unix() + 100,
+	}
+	assert.Nil(t, validator.ValidateMetaBlock(d))
+
+	d["expires_at"] = now.Unix()
+	err := validator.ValidateMetaBlock(d)
+	assert.NotNil(t, err)
+	assert.Equal(t, CodeExpired, err.(*ValidationError).Code)
+	assert.Equal(t, "/meta/expires_at", err.(*ValidationError).Pointer)
+
+	validator.ClockSkew = time.Minute
+	assert.Nil(t, validator.ValidateMetaBlock(d))
+}
+
+// TestValidateMetaBlockNotBefore tests that a stone is rejected until the clock reaches `not_before`
+func TestValidateMetaBlockNotBefore(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	validator := &Validator{ StartTime: START_TIME, Clock: func() time.Time { return now } }
+	d := map[string]interface{}{
+		"id": util.Sha1("abcd"),
+		"type": "coupon",
+		"created_at": now.Unix() - 100,
+		"not_before": now.Unix(),
+	}
+	assert.Nil(t, validator.ValidateMetaBlock(d))
+
+	d["not_before"] = now.Unix() + 30
+	err := validator.ValidateMetaBlock(d)
+	assert.NotNil(t, err)
+	assert.Equal(t, CodeNotYetValid, err.(*ValidationError).Code)
+
+	validator.ClockSkew = time.Minute
+	assert.Nil(t, validator.ValidateMetaBlock(d))
+}
+
+// TestValidateMetaBlockInvalidValidityPeriod tests that inconsistent or mistyped `expires_at` and `not_before` are rejected
+func TestValidateMetaBlockInvalidValidityPeriod(t *testing.T) {
+	now := time.Now().Unix()
+	d := map[string]interface{}{
+		"id": util.Sha1("abcd"),
+		"type": "coupon",
+		"created_at": now - 100,
+		"expires_at": now - 200,
+	}
+	err := ValidateMetaBlock(d)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta.expires_at` must be after `meta.created_at`", err.Error())
+
+	d["expires_at"] = now + 100
+	d["not_before"] = now + 100
+	err = ValidateMetaBlock(d)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta.not_before` must be before `meta.expires_at`", err.Error())
+
+	d["not_before"] = "tomorrow"
+	err = ValidateMetaBlock(d)
+	assert.NotNil(t, err)
+	assert.Equal(t, CodeInvalidType, err.(*ValidationError).Code)
+	assert.Equal(t, "`meta.not_before` value type is invalid. Expects an integer", err.Error())
+}
@@ -0,0 +1,97 @@
+package stone
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Validation error codes. Codes are stable; messages may change.
+const (
+	CodeUnexpectedProperty = "unexpected_property"
+	CodeMissingProperty    = "missing_property"
+	CodeInvalidType        = "invalid_type"
+	CodeInvalidValue       = "invalid_value"
+	CodeDuplicateValue     = "duplicate_value"
+	CodeRefIDMismatch      = "ref_id_mismatch"
+	CodeCreatedAtTooEarly  = "created_at_too_early"
+	CodeCreatedAtInFuture  = "created_at_in_future"
+	CodeExpired            = "expired"
+	CodeNotYetValid        = "not_yet_valid"
+	CodeRevoked            = "revoked"
+	CodeSchemaViolation    = "schema_violation"
+	CodeMalformedJSON      = "malformed_json"
+	CodeUnsupportedInput   = "unsupported_input"
+	CodeUnsupportedVersion = "unsupported_version"
+)
+
+// ValidationError is returned by the validation functions. Its
+// message (Error()) is the human readable reason; Code identifies the
+// rule that failed and Pointer is the JSON pointer (RFC 6901) of the
+// offending value, relative to the validated stone.
+// 
+// For errors found in an embedded stone, Block is the block of the embedded
+// stone, EmbedPath holds the index of the embed at each level of nesting
+// (outermost first) and Pointer is relative to the outermost stone.
+type ValidationError struct {
+	Code      string
+	Pointer   string
+	Block     string
+	EmbedPath []int
+	Message   string
+}
+
+// Returns the error message
+func (self *ValidationError) Error() string {
+	return self.Message
+}
+
+// Create a validation error. The block is taken from the first
+// reference token of the pointer.
+func newValidationError(code, pointer, message string) *ValidationError {
+	block := strings.SplitN(strings.TrimPrefix(pointer, "/"), "/", 2)[0]
+	return &ValidationError{ Code: code, Pointer: pointer, Block: block, Message: message }
+}
+
+// Returns the JSON pointer made of the given reference tokens
+func jsonPointer(tokens ...string) string {
+	var pointer string
+	for _, token := range tokens {
+		token = strings.Replace(token, "~", "~0", -1)
+		token = strings.Replace(token, "/", "~1", -1)
+		pointer += "/" + token
+	}
+	return pointer
+}
+
+// Wrap the validation error of the embed at the given index so
+// it reads and points relative to the embedding stone.
+func embedValidationError(index int, err *ValidationError) *ValidationError {
+	return &ValidationError{
+		Code: err.Code,
+		Pointer: jsonPointer("embeds", "data", fmt.Sprint(index)) + err.Pointer,
+		Block: err.Block,
+		EmbedPath: append([]int{ index }, err.EmbedPath...),
+		Message: fmt.Sprintf("unable to validate embed at index %d. Reason: %s", index, err.Message),
+	}
+}
+
+// ValidationErrors holds every error found by ValidateAll
+type ValidationErrors []*ValidationError
+
+// Returns the error messages separated by semicolons
+func (self ValidationErrors) Error() string {
+	var messages []string
+	for _, err := range self {
+		messages = append(messages, err.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Returns the errors, for use with errors.Is and errors.As
+func (self ValidationErrors) Unwrap() []error {
+	var errs []error
+	for _, err := range self {
+		errs = append(errs, err)
+	}
+	return errs
+}
@@ -0,0 +1,89 @@
+package stone
+
+import (
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"github.com/ellcrys/util"
+)
+
+// TestValidationErrorHasCodeAndPointer tests that validation errors carry a code, block and JSON pointer
+func TestValidationErrorHasCodeAndPointer(t *testing.T) {
+	d := map[string]interface{}{
+		"ref_id": "abc",
+		"type": "sole",
+		"sole": map[string]interface{}{
+			"address_id": "xyz",
+		},
+	}
+	err := ValidateOwnershipBlock(d, "xyz")
+	assert.NotNil(t, err)
+	verr, ok := err.(*ValidationError)
+	assert.True(t, ok)
+	assert.Equal(t, CodeRefIDMismatch, verr.Code)
+	assert.Equal(t, "/ownership/ref_id", verr.Pointer)
+	assert.Equal(t, "ownership", verr.Block)
+	assert.Nil(t, verr.EmbedPath)
+	assert.Equal(t, "`ownership.ref_id` not equal to `meta.id`", verr.Error())
+}
+
+// TestValidationErrorPointerOfUnexpectedProperty tests that the pointer of an unexpected property is escaped
+func TestValidationErrorPointerOfUnexpectedProperty(t *testing.T) {
+	d := map[string]interface{}{
+		"ref_id": "xyz",
+		"a/b~c": "",
+	}
+	err := ValidateAttributesBlock(d, "xyz")
+	assert.NotNil(t, err)
+	assert.Equal(t, CodeUnexpectedProperty, err.(*ValidationError).Code)
+	assert.Equal(t, "/attributes/a~1b~0c", err.(*ValidationError).Pointer)
+}
+
+// TestValidationErrorOfMalformedJSON tests the code of an unparsable stone
+func TestValidationErrorOfMalformedJSON(t *testing.T) {
+	err := Validate(`{ "meta : "" }`)
+	assert.NotNil(t, err)
+	assert.Equal(t, CodeMalformedJSON, err.(*ValidationError).Code)
+	assert.Equal(t, "", err.(*ValidationError).Pointer)
+}
+
+// TestValidationErrorOfEmbed tests that an error in an embed points into the embeds block
+// and records the embed index
+func TestValidationErrorOfEmbed(t *testing.T) {
+	d := map[string]interface{}{
+		"ref_id": "xxx",
+		"data": []interface{}{
+			map[string]interface{}{
+				"meta": map[string]interface{}{
+					"id": util.NewID(),
+					"type": "coupon",
+					"created_at": time.Now().Unix(),
+				},
+			},
+			map[string]interface{}{
+				"meta": map[string]interface{}{
+					"id": util.NewID(),
+					"type": "coupon",
+					"created_at": time.Now().Unix() + 1000,
+				},
+			},
+		},
+	}
+	err := ValidateEmbedsBlock(d, "xxx")
+	assert.NotNil(t, err)
+	verr := err.(*ValidationError)
+	assert.Equal(t, CodeCreatedAtInFuture, verr.Code)
+	assert.Equal(t, "/embeds/data/1/meta/created_at", verr.Pointer)
+	assert.Equal(t, "meta", verr.Block)
+	assert.Equal(t, []int{ 1 }, verr.EmbedPath)
+	assert.Equal(t, "unable to validate embed at index 1. Reason: `meta.created_at` value cannot be a unix time in the future", verr.Error())
+}
+
+// TestNestedEmbedValidationError tests that embed indexes accumulate outermost first
+func TestNestedEmbedValidationError(t *testing.T) {
+	verr := embedValidationError(2, embedValidationError(0, newValidationError(CodeMissingProperty, "/meta/id", "`meta` block is missing `id` property")))
+	assert.Equal(t, []int{ 2, 0 }, verr.EmbedPath)
+	assert.Equal(t, "/embeds/data/2/embeds/data/0/meta/id", verr.Pointer)
+	assert.Equal(t, "meta", verr.Block)
+	assert.Equal(t, CodeMissingProperty, verr.Code)
+}
@@ -0,0 +1,205 @@
+package stone
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ellcrys/crypto"
+	"github.com/ellcrys/util"
+)
+
+// Format versions. The version is carried in the encoded token and in
+// the JSON form of a stone (`version`); a stone without one is in
+// the first format.
+//
+//  Version 1: block payloads are the JSON of the block in any form. The
+//  `meta` block only has `id`, `type` and `created_at`.
+//
+//  Version 2: block payloads must be canonical JSON (see CanonicalJSON).
+//  The `meta` block may also have `expires_at` and `not_before`.
+//
+//  Version 3: block signatures are linked to the stone (see VerifyLinks).
+//  The meta signature is marked `linked` and the signatures of other
+//  blocks carry the hash of the meta signature in their protected header.
+const (
+	FormatVersion1       = 1
+	FormatVersion2       = 2
+	FormatVersion3       = 3
+	CurrentFormatVersion = FormatVersion3
+)
+
+// A SignerResolver maps the issuer and key id found in the protected
+// header of a block's signature to the Signer of that key. It is used
+// to sign blocks again when a stone is migrated.
+type SignerResolver interface {
+	ResolveSigner(issuer, keyID string) (Signer, error)
+}
+
+// SignerResolverFunc allows an ordinary function to be used as a SignerResolver
+type SignerResolverFunc func(issuer, keyID string) (Signer, error)
+
+// Calls the function
+func (f SignerResolverFunc) ResolveSigner(issuer, keyID string) (Signer, error) {
+	return f(issuer, keyID)
+}
+
+// Returns the format version of a decoded token or of the map form
+// of a stone. A missing version is version 1. False is returned if
+// the version is not supported.
+func formatVersion(v interface{}) (int, bool) {
+	if v == nil {
+		return FormatVersion1, true
+	}
+	version, ok := toInt(v)
+	if !ok || version < FormatVersion1 || version > CurrentFormatVersion {
+		return 0, false
+	}
+	return int(version), true
+}
+
+// Returns an error if the payload of a block's signature is not the
+// canonical JSON of the block, as required by format version 2
+func checkCanonicalPayload(token, blockName string) error {
+
+	payload, err := util.GetJWSPayload(token)
+	if err != nil {
+		return errors.New("invalid " + blockName + " token")
+	}
+
+	blockJSON, err := crypto.FromBase64Raw(payload)
+	if err != nil {
+		return errors.New("invalid " + blockName + " token")
+	}
+
+	var block interface{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(blockJSON)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&block); err != nil {
+		return errors.New("malformed " + blockName + " block")
+	}
+
+	canonical, err := CanonicalJSON(block)
+	if err != nil || !bytes.Equal(canonical, []byte(blockJSON)) {
+		return errors.New(fmt.Sprintf("`%s` block signature payload is not canonical JSON", blockName))
+	}
+
+	return nil
+}
+
+// Upgrade the stone to the current format version. Blocks whose
+// signature does not meet the current format are signed again with the
+// Signer the resolver returns for the issuer and key id of their signature;
+// the new signature keeps that issuer and key id. The block signed is the one
+// in the existing signature, which must verify with the Signer's public key.
+// Signing the meta block again requires the other blocks to be signed again
+// to link them to the new meta signature. Counter-signed blocks and an
+// ownership block with owner signatures cannot be signed again.
+// The stone is left unchanged if any block cannot be signed again.
+func (self *Stone) Migrate(signers SignerResolver) error {
+
+	if self.Version > CurrentFormatVersion {
+		return errors.New(fmt.Sprintf("format version %d is not supported", self.Version))
+	}
+
+	if self.Version == CurrentFormatVersion {
+		return nil
+	}
+
+	if signers == nil {
+		return errors.New("signer resolver is required")
+	}
+
+	// sign on a copy; blocks are replaced, not modified
+	migrated := *self
+	migrated.Version = CurrentFormatVersion
+	migrated.Signatures = make(map[string]interface{})
+	for name, signature := range self.Signatures {
+		migrated.Signatures[name] = signature
+	}
+	migrated.Blocks = make(map[string]map[string]interface{})
+	for name, block := range self.Blocks {
+		migrated.Blocks[name] = block
+	}
+
+	// the meta block comes first so other blocks link to its new signature
+	for _, blockName := range BlockNames() {
+
+		if !migrated.HasSignature(blockName) {
+			continue
+		}
+
+		jws, err := migrated.blockSignature(blockName)
+		if err != nil {
+			return err
+		}
+
+		// version 2 payloads are canonical, version 3 signatures are linked
+		token := jws.token(0)
+		if checkCanonicalPayload(token, blockName) == nil && migrated.checkLink(blockName, token) == nil {
+			if blockName != "meta" {
+				continue
+			}
+			if header, _ := tokenHeader(token); header["linked"] == true {
+				continue
+			}
+		}
+
+		// counter-signers signed the current payload too
+		if len(jws.Signatures) > 1 {
+			return errors.New(fmt.Sprintf("`%s` block is counter-signed and cannot be signed again", blockName))
+		}
+
+		// owners signed the current payload; they would have to sign again
+		if blockName == "ownership" && len(migrated.OwnerSignatures()) > 0 {
+			return errors.New("`ownership` block has owner signatures and cannot be signed again")
+		}
+
+		header, err := migrated.SignatureHeader(blockName)
+		if err != nil {
+			return err
+		}
+
+		issuer, _ := header["iss"].(string)
+		keyID, _ := header["kid"].(string)
+		signer, err := signers.ResolveSigner(issuer, keyID)
+		if err != nil {
+			return errors.New(fmt.Sprintf("unable to resolve signer for `%s` block: %s", blockName, err.Error()))
+		}
+		if signer == nil {
+			return errors.New(fmt.Sprintf("unable to resolve signer for `%s` block", blockName))
+		}
+
+		if _, err := verifyJWS(token, signer.Public()); err != nil {
+			return errors.New(fmt.Sprintf("`%s` block signature could not be verified with the signer's key", blockName))
+		}
+
+		block, err := TokenToBlock(token, blockName)
+		if err != nil {
+			return err
+		}
+
+		payload, err := canonicalBlock(block)
+		if err != nil {
+			return err
+		}
+
+		link, err := migrated.linkHeader(blockName, nil)
+		if err != nil {
+			return err
+		}
+
+		signature, err := signJWSHeader(WithIdentity(signer, issuer, keyID), []byte(payload), link)
+		if err != nil {
+			return errors.New(fmt.Sprintf("failed to sign `%s` block", blockName))
+		}
+
+		if err := migrated.setSignedBlock(blockName, block); err != nil {
+			return err
+		}
+		migrated.Signatures[blockName] = signature
+	}
+
+	*self = migrated
+	return nil
+}
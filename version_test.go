@@ -0,0 +1,129 @@
+package stone
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/ellcrys/crypto"
+	"github.com/ellcrys/util"
+)
+
+// legacyStone returns a version 1 stone whose meta block is signed over indented JSON
+func legacyStone(t *testing.T, signer Signer) *Stone {
+	sh := NewValidStone()
+	payload, _ := json.MarshalIndent(sh.Meta, "", "  ")
+	token, err := signJWS(signer, payload)
+	assert.Nil(t, err)
+	sh.Signatures["meta"] = token
+	sh.Version = FormatVersion1
+	return sh
+}
+
+// encodeEnvelope encodes an envelope the way older versions did
+func encodeEnvelope(envelope map[string]interface{}) string {
+	envelopeJSON, _ := util.MapToJSON(envelope)
+	return crypto.ToBase64Raw([]byte(envelopeJSON))
+}
+
+// TestDecodeLegacyToken tests that a token without a version is decoded as version 1
+func TestDecodeLegacyToken(t *testing.T) {
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	sh := legacyStone(t, signer)
+	decStone, err := Decode(encodeEnvelope(map[string]interface{}{ "meta": sh.Signatures["meta"] }))
+	assert.Nil(t, err)
+	assert.Equal(t, FormatVersion1, decStone.Version)
+	assert.Equal(t, sh.Meta["id"], decStone.Meta["id"])
+}
+
+// TestDecodeRequiresCanonicalPayload tests that version 2 tokens must sign canonical JSON
+func TestDecodeRequiresCanonicalPayload(t *testing.T) {
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	sh := legacyStone(t, signer)
+	_, err := Decode(encodeEnvelope(map[string]interface{}{ "meta": sh.Signatures["meta"], "version": 2 }))
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block signature payload is not canonical JSON", err.Error())
+}
+
+// TestDecodeUnsupportedVersion tests that tokens of an unknown version are rejected
+func TestDecodeUnsupportedVersion(t *testing.T) {
+	sh := NewValidStone()
+	_, err := Decode(encodeEnvelope(map[string]interface{}{ "meta": sh.Signatures["meta"], "version": 99 }))
+	assert.NotNil(t, err)
+	assert.Equal(t, "format version is not supported", err.Error())
+}
+
+// TestValidateVersion tests that validation rules follow the format version
+func TestValidateVersion(t *testing.T) {
+	data, _ := util.JSONToMap(NewValidStone().JSON())
+	assert.Equal(t, json.Number("3"), data["version"])
+	data["meta"].(map[string]interface{})["expires_at"] = 4102444800
+	assert.Nil(t, Validate(data))
+
+	data["version"] = 1
+	err := Validate(data)
+	assert.NotNil(t, err)
+	assert.Equal(t, "`expires_at` property is unexpected in `meta` block", err.Error())
+
+	data["version"] = 99
+	err = Validate(data)
+	assert.NotNil(t, err)
+	assert.Equal(t, CodeUnsupportedVersion, err.(*ValidationError).Code)
+	assert.Equal(t, "/version", err.(*ValidationError).Pointer)
+}
+
+// TestMigrate tests that a version 1 stone is signed again and upgraded
+func TestMigrate(t *testing.T) {
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	sh := legacyStone(t, signer)
+	header, _ := sh.SignatureHeader("meta")
+
+	err := sh.Migrate(SignerResolverFunc(func(issuer, keyID string) (Signer, error) {
+		assert.Equal(t, header["kid"], keyID)
+		return signer, nil
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, CurrentFormatVersion, sh.Version)
+	assert.Nil(t, checkCanonicalPayload(sh.Signatures["meta"].(string), "meta"))
+	newHeader, _ := sh.SignatureHeader("meta")
+	assert.Equal(t, header["kid"], newHeader["kid"])
+
+	decStone, err := DecodeAndVerify(sh.Encode(), staticResolver(util.ReadFromFixtures("tests/fixtures/rsa_pub_1.txt")))
+	assert.Nil(t, err)
+	assert.Equal(t, CurrentFormatVersion, decStone.Version)
+}
+
+// TestMigrateWithoutKey tests that a stone is left unchanged when a block cannot be signed again
+func TestMigrateWithoutKey(t *testing.T) {
+	signer, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/rsa_priv_1.txt"))
+	otherSigner, _ := ParsePrivateKey(util.ReadFromFixtures("tests/fixtures/rsa_priv_2.txt"))
+	sh := legacyStone(t, signer)
+	token := sh.Signatures["meta"]
+
+	err := sh.Migrate(SignerResolverFunc(func(issuer, keyID string) (Signer, error) {
+		return nil, errors.New("key not found")
+	}))
+	assert.NotNil(t, err)
+	assert.Equal(t, "unable to resolve signer for `meta` block: key not found", err.Error())
+
+	err = sh.Migrate(SignerResolverFunc(func(issuer, keyID string) (Signer, error) {
+		return otherSigner, nil
+	}))
+	assert.NotNil(t, err)
+	assert.Equal(t, "`meta` block signature could not be verified with the signer's key", err.Error())
+	assert.Equal(t, FormatVersion1, sh.Version)
+	assert.Equal(t, token, sh.Signatures["meta"])
+}
+
+// TestMigrateCanonicalStone tests that a version 1 stone with canonical payloads is upgraded without signing
+func TestMigrateCanonicalStone(t *testing.T) {
+	sh := NewValidStone()
+	sh.Version = FormatVersion1
+	token := sh.Signatures["meta"]
+	err := sh.Migrate(SignerResolverFunc(func(issuer, keyID string) (Signer, error) {
+		return nil, errors.New("no key expected")
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, CurrentFormatVersion, sh.Version)
+	assert.Equal(t, token, sh.Signatures["meta"])
+}